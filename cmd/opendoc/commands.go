@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
 	"github.com/spf13/cobra"
 
 	opendoc "github.com/cottrellashley/opendoc"
@@ -41,11 +43,31 @@ Get started:
 
 // ── opendoc build ───────────────────────────────────────────
 
+var (
+	buildDrafts   bool
+	buildFuture   bool
+	buildVersions bool
+)
+
+// previewOptions returns the build options selected by --drafts and --future.
+// Build warnings are printed as they occur.
+func previewOptions() core.BuildOptions {
+	return core.BuildOptions{
+		IncludeDrafts: buildDrafts,
+		IncludeFuture: buildFuture,
+		Warn:          core.WarnMsg,
+	}
+}
+
 var buildCmd = &cobra.Command{
 	Use:   "build [project-dir]",
 	Short: "Build the static site",
-	Long:  "Build the static site from markdown content. Defaults to the current directory.",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Build the static site from markdown content. Defaults to the current directory.
+
+With --versions, every git ref listed under versions: in opendoc.yml is
+built into its own subdirectory (e.g. dist/v1/), with the latest version
+also at dist/latest/.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		projectDir := resolveProjectDir(args)
 		config, err := core.LoadConfig(projectDir)
@@ -56,7 +78,21 @@ var buildCmd = &cobra.Command{
 		core.InfoMsg(fmt.Sprintf("Building %s...", core.CLIBold.Render(config.Site.Name)))
 		start := time.Now()
 
-		if err := core.BuildSite(config, projectDir, opendoc.ThemesFS, core.BuildOptions{}); err != nil {
+		build := core.BuildSite
+		if buildVersions {
+			build = core.BuildVersions
+			for _, v := range config.Versions {
+				core.StepMsg(fmt.Sprintf("%s (%s)", v.Name, v.Ref))
+			}
+		}
+		opts := previewOptions()
+		bar := &progressLine{}
+		if isTerminal(os.Stdout) {
+			opts.Progress, opts.Warn = bar.update, bar.warn
+		}
+		err = build(cmd.Context(), config, projectDir, opendoc.ThemesFS, opts)
+		bar.clear()
+		if err != nil {
 			core.ErrMsg(fmt.Sprintf("Build failed: %v", err))
 			return err
 		}
@@ -94,7 +130,7 @@ var serveCmd = &cobra.Command{
 
 		core.InfoMsg(fmt.Sprintf("Building %s...", core.CLIBold.Render(config.Site.Name)))
 		start := time.Now()
-		if err := core.BuildSite(config, projectDir, opendoc.ThemesFS, core.BuildOptions{}); err != nil {
+		if err := core.BuildSite(cmd.Context(), config, projectDir, opendoc.ThemesFS, previewOptions()); err != nil {
 			core.ErrMsg(fmt.Sprintf("Build failed: %v", err))
 			return err
 		}
@@ -162,19 +198,47 @@ var newCmd = &cobra.Command{
 
 // ── opendoc publish ─────────────────────────────────────────
 
-var publishRepo string
+var (
+	publishRepo     string
+	publishTarget   string
+	publishDryRun   bool
+	publishMessage  string
+	publishYes      bool
+	publishDiff     bool
+	publishAudience []string
+)
 
 var publishCmd = &cobra.Command{
 	Use:   "publish [project-dir]",
-	Short: "Build and deploy to GitHub Pages",
+	Short: "Build and deploy the site",
 	Long: `Build the site in publish mode (excluding private pages) and deploy
-to GitHub Pages using the gh CLI.
+it to a target from the deploy block of opendoc.yml: GitHub Pages, a git
+remote, a local directory, an rsync destination, an S3 bucket or a zip or
+tar.gz archive. Without a deploy block, the site goes to GitHub Pages using
+the gh CLI.
+
+Before deploying, the pages that will be added, modified or deleted are
+listed against what is deployed now, and publish asks for confirmation.
+Use --diff to print the text changes of each page, --yes to skip the
+question, and --dry-run to stop after the preview. Without a terminal
+(e.g. in CI), publish deploys without asking.
+
+Use --target to pick a target other than deploy.default.
+
+Pages and entries with a visibility list in their frontmatter are only
+published for those access groups: --audience staff builds a site that
+also includes the pages visible to staff.
 
-The target repository is resolved from:
+Git targets keep the branch's history: each deploy adds one commit with
+the changed files, named after the source commit. Files listed under
+deploy.preserve (default: CNAME and .well-known) are never deleted.
+
+For GitHub Pages, the repository is resolved from:
   1. --repo flag
-  2. settings.json github_repo field
-  3. App config github.default_account + directory name
-  4. Git remote origin`,
+  2. The target's repo field
+  3. settings.json github_repo field
+  4. App config github.default_account + directory name
+  5. Git remote origin`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		projectDir := resolveProjectDir(args)
@@ -184,9 +248,13 @@ The target repository is resolved from:
 		fmt.Println()
 
 		start := time.Now()
-		result, err := core.Publish(core.PublishOptions{
+		plan, err := core.PreparePublish(core.PublishOptions{
 			ProjectDir: projectDir,
 			Repo:       publishRepo,
+			Target:     publishTarget,
+			DryRun:     publishDryRun,
+			Message:    publishMessage,
+			Audience:   publishAudience,
 			ThemesFS:   opendoc.ThemesFS,
 		})
 		if err != nil {
@@ -194,12 +262,45 @@ The target repository is resolved from:
 			return fmt.Errorf("publish failed")
 		}
 
-		elapsed := time.Since(start)
 		fmt.Println()
-		core.DoneMsg(fmt.Sprintf("Published to %s in %ds", core.CLIBold.Render(result.Repo), int(elapsed.Seconds())))
+		printDeployDiff(plan.Diff, publishDiff)
+		if !publishDryRun && !publishYes && !plan.Diff.Empty() && isTerminal(os.Stdin) {
+			if !confirm(fmt.Sprintf("Deploy to %s?", core.CLIBold.Render(plan.Destination))) {
+				core.InfoMsg("Publish cancelled")
+				fmt.Println()
+				return nil
+			}
+			start = time.Now()
+		}
+
+		result, err := plan.Deploy()
+		if err != nil {
+			core.ErrMsg(err.Error())
+			return fmt.Errorf("publish failed")
+		}
+
+		elapsed := time.Since(start)
+		if result.DryRun {
+			core.InfoMsg(fmt.Sprintf("Dry run: %d file(s) would change on %s", len(result.Changes), core.CLIBold.Render(result.Destination)))
+			fmt.Println()
+			return nil
+		}
+		if len(result.Changes) == 0 {
+			core.InfoMsg(fmt.Sprintf("%s is already up to date", core.CLIBold.Render(result.Destination)))
+			fmt.Println()
+			return nil
+		}
+		core.DoneMsg(fmt.Sprintf("Published to %s in %ds", core.CLIBold.Render(result.Destination), int(elapsed.Seconds())))
+		core.StepMsg(changeSummary(result.Changes))
+		if result.Commit != "" {
+			core.StepMsg(fmt.Sprintf("Commit: %s", result.Commit))
+		}
 		if result.URL != "" {
 			core.StepMsg(fmt.Sprintf("URL: %s", core.CLIAccent.Render(result.URL)))
 		}
+		for _, warning := range result.Warnings {
+			core.WarnMsg(warning)
+		}
 		fmt.Println()
 		return nil
 	},
@@ -367,15 +468,214 @@ var configPathCmd = &cobra.Command{
 	},
 }
 
+// ── opendoc user ────────────────────────────────────────────
+
+var (
+	userRole          string
+	userPasswordStdin bool
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage workbench accounts",
+	Long: `Manage the accounts that can sign in to the workbench.
+
+Accounts file: ` + core.UsersPath() + `
+
+Roles, each including the ones before it:
+  viewer      Browse files, previews and build status
+  editor      Edit files, build, chat and change project settings
+  publisher   Deploy the site
+  admin       Manage API keys and integrations, use the console
+
+API tokens let scripts call the workbench API with the account's role:
+  curl -H "Authorization: Bearer <token>" http://localhost:3000/api/files`,
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Create an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role, err := core.ParseRole(userRole)
+		if err != nil {
+			return err
+		}
+		password, err := readNewPassword()
+		if err != nil {
+			return err
+		}
+		if err := openUsers().Add(args[0], password, role); err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("Created %s (%s)", core.CLIBold.Render(args[0]), role))
+		return nil
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List accounts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		users := openUsers().List()
+		if len(users) == 0 {
+			core.InfoMsg("No accounts yet. Create one with: opendoc user add <name> --role admin")
+			return nil
+		}
+		fmt.Println()
+		for _, u := range users {
+			line := fmt.Sprintf("%-10s", u.Role)
+			for _, t := range u.Tokens {
+				line += core.CLIMuted.Render("  token:" + t.Name)
+			}
+			fmt.Println(core.StatusLine(u.Name, line))
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Delete an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := openUsers().Remove(args[0]); err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("Removed %s", core.CLIBold.Render(args[0])))
+		return nil
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <name>",
+	Short: "Set an account's password",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		users := openUsers()
+		if _, ok := users.Get(args[0]); !ok {
+			return fmt.Errorf("no user '%s'", args[0])
+		}
+		password, err := readNewPassword()
+		if err != nil {
+			return err
+		}
+		if err := users.SetPassword(args[0], password); err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("Password changed for %s", core.CLIBold.Render(args[0])))
+		return nil
+	},
+}
+
+var userRoleCmd = &cobra.Command{
+	Use:   "role <name> <role>",
+	Short: "Change an account's role",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role, err := core.ParseRole(args[1])
+		if err != nil {
+			return err
+		}
+		if err := openUsers().SetRole(args[0], role); err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("%s is now %s", core.CLIBold.Render(args[0]), role))
+		return nil
+	},
+}
+
+var userTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens",
+}
+
+var userTokenAddCmd = &cobra.Command{
+	Use:   "add <user> <token-name>",
+	Short: "Create an API token",
+	Long:  "Create an API token for an account. The token is shown once; only its hash is stored.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := openUsers().CreateToken(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("Created token %s for %s", core.CLIBold.Render(args[1]), args[0]))
+		fmt.Println()
+		fmt.Println("  " + token)
+		fmt.Println()
+		core.StepMsg("Store it now, it can't be shown again")
+		return nil
+	},
+}
+
+var userTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <user> <token-name>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := openUsers().RevokeToken(args[0], args[1]); err != nil {
+			return err
+		}
+		core.OkMsg(fmt.Sprintf("Revoked token %s of %s", core.CLIBold.Render(args[1]), args[0]))
+		return nil
+	},
+}
+
+// openUsers opens the workbench user store, exiting on a broken file.
+func openUsers() *core.UserStore {
+	users, err := core.OpenUserStore(core.UsersPath())
+	if err != nil {
+		core.ErrMsg(err.Error())
+		os.Exit(1)
+	}
+	return users
+}
+
+// readNewPassword asks for a password twice on the terminal, or reads one
+// line from stdin with --password-stdin.
+func readNewPassword() (string, error) {
+	if userPasswordStdin || !isTerminal(os.Stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no password on stdin")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Print("  Password: ")
+	first, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	fmt.Print("  Repeat password: ")
+	second, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords don't match")
+	}
+	return string(first), nil
+}
+
 // ── opendoc workbench ───────────────────────────────────────
 
-var workbenchPort string
+var (
+	workbenchPort       string
+	workbenchTrustProxy bool
+)
 
 var workbenchCmd = &cobra.Command{
 	Use:   "workbench [project-dir]",
 	Short: "Start the IDE-like workbench server",
-	Long:  "Start the full workbench with editor, preview, chat, and terminal.",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Start the full workbench with editor, preview, chat, and terminal.
+
+Everyone signs in with an account from 'opendoc user'. While there are no
+accounts, the log prints a one-time setup link for creating the first admin.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		projectDir := resolveProjectDir(args)
 
@@ -385,10 +685,11 @@ var workbenchCmd = &cobra.Command{
 		}
 
 		return server.StartWorkbench(server.WorkbenchConfig{
-			Port:      port,
-			Workspace: projectDir,
-			ThemesFS:  opendoc.ThemesFS,
-			PublicFS:  opendoc.PublicFS,
+			Port:       port,
+			Workspace:  projectDir,
+			ThemesFS:   opendoc.ThemesFS,
+			PublicFS:   opendoc.PublicFS,
+			TrustProxy: workbenchTrustProxy,
 		})
 	},
 }
@@ -417,14 +718,40 @@ var tuiCmd = &cobra.Command{
 func init() {
 	// Flags
 	serveCmd.Flags().StringVarP(&servePort, "port", "p", "8000", "Port to serve on")
+	for _, cmd := range []*cobra.Command{buildCmd, serveCmd} {
+		cmd.Flags().BoolVar(&buildDrafts, "drafts", false, "Include entries marked draft: true")
+		cmd.Flags().BoolVar(&buildFuture, "future", false, "Include entries with a future publish_date")
+	}
+	buildCmd.Flags().BoolVar(&buildVersions, "versions", false, "Build every version listed under versions: from its git ref")
 	workbenchCmd.Flags().StringVarP(&workbenchPort, "port", "p", "3000", "Port for the workbench")
+	workbenchCmd.Flags().BoolVar(&workbenchTrustProxy, "trust-proxy", false, "Trust X-Forwarded-Proto from a reverse proxy for secure cookies")
 	publishCmd.Flags().StringVar(&publishRepo, "repo", "", "GitHub repo (owner/repo) to deploy to")
+	publishCmd.Flags().StringVar(&publishTarget, "target", "", "Deploy target from opendoc.yml (default: deploy.default)")
+	publishCmd.Flags().BoolVar(&publishDryRun, "dry-run", false, "Build and list the files that would change, without deploying")
+	publishCmd.Flags().StringVarP(&publishMessage, "message", "m", "", "Commit message for git targets (default: names the source commit)")
+	publishCmd.Flags().BoolVarP(&publishYes, "yes", "y", false, "Deploy without asking for confirmation")
+	publishCmd.Flags().BoolVar(&publishDiff, "diff", false, "Print the text changes of each changed page")
+	publishCmd.Flags().StringSliceVar(&publishAudience, "audience", nil, "Access groups to publish for: include pages whose visibility lists one of them")
 
 	// Config subcommands
 	configCmd.AddCommand(configShowCmd)
 	configCmd.AddCommand(configSetCmd)
 	configCmd.AddCommand(configPathCmd)
 
+	// User subcommands
+	for _, cmd := range []*cobra.Command{userAddCmd, userPasswdCmd} {
+		cmd.Flags().BoolVar(&userPasswordStdin, "password-stdin", false, "Read the password from stdin")
+	}
+	userAddCmd.Flags().StringVar(&userRole, "role", "editor", "Role: viewer, editor, publisher or admin")
+	userTokenCmd.AddCommand(userTokenAddCmd)
+	userTokenCmd.AddCommand(userTokenRevokeCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userRemoveCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userRoleCmd)
+	userCmd.AddCommand(userTokenCmd)
+
 	// Root commands
 	rootCmd.AddCommand(buildCmd)
 	rootCmd.AddCommand(serveCmd)
@@ -432,6 +759,7 @@ func init() {
 	rootCmd.AddCommand(publishCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(userCmd)
 	rootCmd.AddCommand(workbenchCmd)
 	rootCmd.AddCommand(tuiCmd)
 
@@ -449,6 +777,122 @@ func resolveProjectDir(args []string) string {
 	return abs
 }
 
+// changeSummary counts deploy changes, e.g. "3 added, 1 modified, 0 deleted".
+func changeSummary(changes []core.FileChange) string {
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Status]++
+	}
+	return fmt.Sprintf("%d added, %d modified, %d deleted", counts["added"], counts["modified"], counts["deleted"])
+}
+
+// printDeployDiff lists the pages a deploy changes and, with full set,
+// their text diffs.
+func printDeployDiff(diff *core.DeployDiff, full bool) {
+	switch diff.Baseline {
+	case "none":
+		core.InfoMsg("Nothing deployed yet; every page is new")
+	case "manifest":
+		core.InfoMsg(fmt.Sprintf("Compared with the last deploy from this project (%s)", diff.Since.Local().Format("2006-01-02 15:04")))
+	}
+	if diff.Empty() {
+		core.InfoMsg("No changes since the last deploy")
+		fmt.Println()
+		return
+	}
+
+	markers := map[string]string{
+		"added":    core.CLISuccess.Render("+"),
+		"modified": core.CLIWarn.Render("~"),
+		"deleted":  core.CLIError.Render("-"),
+	}
+	for _, p := range diff.Pages {
+		line := fmt.Sprintf("%s %s  %s", markers[p.Status], p.URL, core.CLIMuted.Render(p.Title))
+		if p.Status == "modified" {
+			line += core.CLIMuted.Render(fmt.Sprintf("  (+%d -%d)", p.Added, p.Removed))
+		}
+		core.StepMsg(line)
+		if full && p.Diff != "" {
+			for _, l := range strings.Split(strings.TrimSuffix(p.Diff, "\n"), "\n")[2:] {
+				switch {
+				case strings.HasPrefix(l, "@@"):
+					l = core.CLIAccent.Render(l)
+				case strings.HasPrefix(l, "+"):
+					l = core.CLISuccess.Render(l)
+				case strings.HasPrefix(l, "-"):
+					l = core.CLIError.Render(l)
+				}
+				fmt.Println("          " + l)
+			}
+			fmt.Println()
+		}
+	}
+	if len(diff.Files) > 0 {
+		core.StepMsg(core.CLIMuted.Render(fmt.Sprintf("%d other file(s): %s", len(diff.Files), changeSummary(diff.Files))))
+	}
+	fmt.Println()
+	core.InfoMsg(fmt.Sprintf("%d page(s) changed", len(diff.Pages)))
+	fmt.Println()
+}
+
+// progressLine draws a build's progress on the terminal, below the
+// warnings printed so far.
+type progressLine struct {
+	shown bool
+	drawn time.Time
+	phase string
+}
+
+func (l *progressLine) update(p core.BuildProgress) {
+	if p.Phase == core.PhaseDone {
+		l.clear()
+		return
+	}
+	// Redraw at most every 50ms, except to show a new phase.
+	if p.Phase == l.phase && time.Since(l.drawn) < 50*time.Millisecond {
+		return
+	}
+	l.shown, l.drawn, l.phase = true, time.Now(), p.Phase
+
+	detail := p.File
+	switch p.Phase {
+	case core.PhaseDiscover:
+		detail = "Reading content"
+	case core.PhaseAssets:
+		detail = "Copying static files"
+	}
+	if p.Lang != "" {
+		detail = "[" + p.Lang + "] " + detail
+	}
+	core.ProgressMsg(p.Done, p.Total, detail)
+}
+
+func (l *progressLine) warn(msg string) {
+	l.clear()
+	core.WarnMsg(msg)
+}
+
+func (l *progressLine) clear() {
+	if l.shown {
+		core.ClearProgress()
+		l.shown = false
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("  %s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Println()
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // parseJSON is a small helper to unmarshal JSON into a struct.
 func parseJSON(data []byte, v any) error {
 	return json.Unmarshal(data, v)
@@ -24,6 +24,7 @@ The workspace contains markdown (.md) files for site content, a opendoc.yml conf
 - **Update site navigation** in opendoc.yml
 - **Create new pages** — blog posts, calendars, planners, notes, anything
 - **Query existing content** — read files and answer questions about what's in them
+- **Search and replace across files** — find where something is mentioned, or rename a term everywhere (preview with a dry run first)
 
 ## Response formatting — IMPORTANT
 
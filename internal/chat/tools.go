@@ -2,10 +2,12 @@ package chat
 
 import (
 	"encoding/json"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/cottrellashley/opendoc/internal/core"
 	"gopkg.in/yaml.v3"
 )
 
@@ -91,6 +93,72 @@ var ToolDefs = []ToolDefinition{
 			},
 		},
 	},
+	{
+		Type: "function",
+		Function: FunctionDefinition{
+			Name:        "search_files",
+			Description: "Search the text of all workspace files. Returns matching files with line numbers and the matching lines.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Text to find, or a regular expression when regex is true",
+					},
+					"regex": map[string]any{
+						"type":        "boolean",
+						"description": "Treat query as a Go regular expression",
+					},
+					"case_sensitive": map[string]any{
+						"type":        "boolean",
+						"description": "Match case (default: ignore case)",
+					},
+					"include": map[string]any{
+						"type":        "string",
+						"description": "Comma-separated globs limiting the files searched (e.g. 'content/**/*.md')",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	},
+	{
+		Type: "function",
+		Function: FunctionDefinition{
+			Name:        "replace_in_files",
+			Description: "Replace text across workspace files. Run with dry_run first to see the diffs, then again without it to apply them.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Text to find, or a regular expression when regex is true",
+					},
+					"replace": map[string]any{
+						"type":        "string",
+						"description": "Replacement text; with regex, $1 refers to the first group",
+					},
+					"regex": map[string]any{
+						"type":        "boolean",
+						"description": "Treat query as a Go regular expression",
+					},
+					"case_sensitive": map[string]any{
+						"type":        "boolean",
+						"description": "Match case (default: ignore case)",
+					},
+					"include": map[string]any{
+						"type":        "string",
+						"description": "Comma-separated globs limiting the files changed (e.g. 'content/**/*.md')",
+					},
+					"dry_run": map[string]any{
+						"type":        "boolean",
+						"description": "Only show what would change",
+					},
+				},
+				"required": []string{"query", "replace"},
+			},
+		},
+	},
 	{
 		Type: "function",
 		Function: FunctionDefinition{
@@ -147,6 +215,10 @@ func ExecuteTool(toolName string, args map[string]any, workspace string, buildFn
 		return toolEditFile(getString(args, "path"), getString(args, "search"), getString(args, "replace"), workspace)
 	case "list_files":
 		return toolListFiles(getString(args, "path"), workspace)
+	case "search_files":
+		return toolSearchFiles(searchOptions(args), workspace)
+	case "replace_in_files":
+		return toolReplaceInFiles(searchOptions(args), getString(args, "replace"), getBool(args, "dry_run"), workspace)
 	case "build":
 		return toolBuild(buildFn)
 	case "get_config":
@@ -161,9 +233,17 @@ func ExecuteTool(toolName string, args map[string]any, workspace string, buildFn
 
 // ── Individual tool implementations ─────────────────────────
 
-func toolReadFile(relPath, workspace string) string {
+// toolPath resolves a path the model asked for, refusing ones outside the
+// workspace and the .git and .opendoc directories (see core.ProtectedPath).
+func toolPath(workspace, relPath string) (string, bool) {
 	absPath := filepath.Join(workspace, relPath)
-	if !strings.HasPrefix(absPath, workspace) {
+	inside := absPath == workspace || strings.HasPrefix(absPath, workspace+string(filepath.Separator))
+	return absPath, inside && !core.ProtectedPath(workspace, absPath)
+}
+
+func toolReadFile(relPath, workspace string) string {
+	absPath, ok := toolPath(workspace, relPath)
+	if !ok {
 		return jsonStr(map[string]string{"error": "Access denied"})
 	}
 	data, err := os.ReadFile(absPath)
@@ -174,23 +254,29 @@ func toolReadFile(relPath, workspace string) string {
 }
 
 func toolWriteFile(relPath, content, workspace string) string {
-	absPath := filepath.Join(workspace, relPath)
-	if !strings.HasPrefix(absPath, workspace) {
+	absPath, ok := toolPath(workspace, relPath)
+	if !ok {
 		return jsonStr(map[string]string{"error": "Access denied"})
 	}
+	core.FileWriteMu.Lock()
+	defer core.FileWriteMu.Unlock()
+	before, _ := os.ReadFile(absPath)
 	dir := filepath.Dir(absPath)
 	os.MkdirAll(dir, 0o755)
-	if err := os.WriteFile(absPath, []byte(content), 0o644); err != nil {
+	if err := core.WriteFileAtomic(absPath, []byte(content)); err != nil {
 		return jsonStr(map[string]string{"error": err.Error()})
 	}
+	recordSave(workspace, relPath, before, []byte(content))
 	return jsonStr(map[string]any{"success": true, "path": relPath, "size": len(content)})
 }
 
 func toolEditFile(relPath, search, replace, workspace string) string {
-	absPath := filepath.Join(workspace, relPath)
-	if !strings.HasPrefix(absPath, workspace) {
+	absPath, ok := toolPath(workspace, relPath)
+	if !ok {
 		return jsonStr(map[string]string{"error": "Access denied"})
 	}
+	core.FileWriteMu.Lock()
+	defer core.FileWriteMu.Unlock()
 	data, err := os.ReadFile(absPath)
 	if err != nil {
 		return jsonStr(map[string]string{"error": "File not found: " + relPath})
@@ -200,7 +286,10 @@ func toolEditFile(relPath, search, replace, workspace string) string {
 		return jsonStr(map[string]string{"error": "Search string not found in " + relPath})
 	}
 	newContent := strings.Replace(content, search, replace, 1)
-	os.WriteFile(absPath, []byte(newContent), 0o644)
+	if err := core.WriteFileAtomic(absPath, []byte(newContent)); err != nil {
+		return jsonStr(map[string]string{"error": err.Error()})
+	}
+	recordSave(workspace, relPath, data, []byte(newContent))
 	return jsonStr(map[string]any{"success": true, "path": relPath})
 }
 
@@ -208,8 +297,8 @@ func toolListFiles(relPath, workspace string) string {
 	if relPath == "" {
 		relPath = "."
 	}
-	absPath := filepath.Join(workspace, relPath)
-	if !strings.HasPrefix(absPath, workspace) {
+	absPath, ok := toolPath(workspace, relPath)
+	if !ok {
 		return jsonStr(map[string]string{"error": "Access denied"})
 	}
 	entries, err := os.ReadDir(absPath)
@@ -232,6 +321,47 @@ func toolListFiles(relPath, workspace string) string {
 	return jsonStr(map[string]any{"path": relPath, "entries": items})
 }
 
+// maxToolMatches keeps search results small enough for the model's
+// context.
+const maxToolMatches = 200
+
+func toolSearchFiles(opts core.SearchOptions, workspace string) string {
+	opts.MaxMatches = maxToolMatches
+	result, err := core.Search(workspace, opts)
+	if err != nil {
+		return jsonStr(map[string]string{"error": err.Error()})
+	}
+	return jsonStr(result)
+}
+
+// maxToolDiffLines caps the diff lines a replacement reports, for the
+// same reason; files past it are listed without their diff.
+const maxToolDiffLines = 400
+
+func toolReplaceInFiles(opts core.SearchOptions, replace string, dryRun bool, workspace string) string {
+	core.FileWriteMu.Lock()
+	result, err := core.Replace(workspace, opts, replace, dryRun)
+	core.FileWriteMu.Unlock()
+	if err != nil {
+		return jsonStr(map[string]string{"error": err.Error()})
+	}
+	lines, truncated := 0, false
+	for i := range result.Files {
+		n := strings.Count(result.Files[i].Diff, "\n")
+		if truncated || lines+n > maxToolDiffLines {
+			result.Files[i].Diff, truncated = "", true
+			continue
+		}
+		lines += n
+	}
+	return jsonStr(map[string]any{
+		"files":           result.Files,
+		"replacements":    result.Replacements,
+		"dry_run":         result.DryRun,
+		"diffs_truncated": truncated,
+	})
+}
+
 func toolBuild(buildFn BuildFunc) string {
 	result := buildFn()
 	return jsonStr(result)
@@ -247,6 +377,8 @@ func toolGetConfig(workspace string) string {
 }
 
 func toolUpdateNav(items []any, workspace string) string {
+	core.FileWriteMu.Lock()
+	defer core.FileWriteMu.Unlock()
 	configPath := filepath.Join(workspace, "opendoc.yml")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -256,7 +388,10 @@ func toolUpdateNav(items []any, workspace string) string {
 	yaml.Unmarshal(data, &raw)
 	raw["nav"] = items
 	newData, _ := yaml.Marshal(raw)
-	os.WriteFile(configPath, newData, 0o644)
+	if err := core.WriteFileAtomic(configPath, newData); err != nil {
+		return jsonStr(map[string]string{"error": err.Error()})
+	}
+	recordSave(workspace, "opendoc.yml", data, newData)
 	return jsonStr(map[string]any{"success": true, "nav": items})
 }
 
@@ -269,6 +404,33 @@ func getString(m map[string]any, key string) string {
 	return ""
 }
 
+// recordSave adds a change made by the assistant to the version history,
+// so it can be undone.
+func recordSave(workspace, relPath string, before, after []byte) {
+	if err := core.ProjectHistory(workspace).RecordSave(relPath, before, after, "", "chat"); err != nil {
+		log.Printf("[history] Failed to record %s: %v", relPath, err)
+	}
+}
+
+func getBool(m map[string]any, key string) bool {
+	v, _ := m[key].(bool)
+	return v
+}
+
+func searchOptions(args map[string]any) core.SearchOptions {
+	opts := core.SearchOptions{
+		Query:         getString(args, "query"),
+		Regex:         getBool(args, "regex"),
+		CaseSensitive: getBool(args, "case_sensitive"),
+	}
+	for _, g := range strings.Split(getString(args, "include"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			opts.Include = append(opts.Include, g)
+		}
+	}
+	return opts
+}
+
 func jsonStr(v any) string {
 	data, _ := json.Marshal(v)
 	return string(data)
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// authorsDir is the output directory of author profile pages.
+const authorsDir = "authors"
+
+// Author is an entry author resolved against the configured profiles.
+// Authors named in frontmatter but missing from the config only have a
+// Name.
+type Author struct {
+	ID     string
+	Name   string
+	Bio    string
+	Avatar string
+	Links  map[string]string
+	Slug   string
+	URL    string
+}
+
+// ── Resolution ──────────────────────────────────────────────
+
+// resolveAuthors reads the entry's author: / authors: frontmatter. An entry
+// without either is credited to site.author, but only when that names a
+// configured profile, so single-author sites don't grow author pages.
+func (b *siteBuild) resolveAuthors(e Entry) []Author {
+	refs := stringList(e.Meta["authors"])
+	if len(refs) == 0 {
+		refs = stringList(e.Meta["author"])
+	}
+	if len(refs) == 0 && b.config.Site.Author != "" {
+		if author, ok := b.lookupAuthor(b.config.Site.Author); ok {
+			return []Author{author}
+		}
+	}
+
+	var authors []Author
+	for _, ref := range refs {
+		author, ok := b.lookupAuthor(ref)
+		if !ok {
+			author = b.newAuthor(slugify(ref), AuthorConfig{Name: ref})
+		}
+		authors = append(authors, author)
+	}
+	return authors
+}
+
+// lookupAuthor finds a configured author by ID or, failing that, by name.
+func (b *siteBuild) lookupAuthor(ref string) (Author, bool) {
+	if cfg, ok := b.config.Authors[ref]; ok {
+		return b.newAuthor(ref, cfg), true
+	}
+	for _, id := range sortedKeys(b.config.Authors) {
+		cfg := b.config.Authors[id]
+		if strings.EqualFold(cfg.Name, ref) {
+			return b.newAuthor(id, cfg), true
+		}
+	}
+	return Author{}, false
+}
+
+func (b *siteBuild) newAuthor(id string, cfg AuthorConfig) Author {
+	slug := slugify(id)
+	avatar := cfg.Avatar
+	if strings.HasPrefix(avatar, "/") {
+		avatar = b.basePath + avatar
+	}
+	return Author{
+		ID:     id,
+		Name:   cfg.Name,
+		Bio:    cfg.Bio,
+		Avatar: avatar,
+		Links:  cfg.Links,
+		Slug:   slug,
+		URL:    b.prefix + "/" + authorsDir + "/" + slug + "/",
+	}
+}
+
+// ── Rendering ───────────────────────────────────────────────
+
+// renderAuthors writes /authors/ and one profile page per author. Every
+// configured author gets a page, plus anyone credited in frontmatter.
+func (b *siteBuild) renderAuthors() error {
+	if _, ok := b.config.Collections[authorsDir]; ok {
+		return nil // the collection owns /authors/
+	}
+	if tax, ok := b.config.Taxonomies[authorsDir]; ok && tax.Scope == "site" {
+		return nil // so does an authors taxonomy, as before profiles existed
+	}
+
+	authors := make(map[string]Author)
+	entries := make(map[string][]Entry)
+	for _, id := range sortedKeys(b.config.Authors) {
+		a := b.newAuthor(id, b.config.Authors[id])
+		authors[a.Slug] = a
+	}
+	for _, collName := range sortedKeys(b.collections) {
+		for _, e := range b.collections[collName] {
+			for _, a := range e.Authors {
+				if _, ok := authors[a.Slug]; !ok {
+					authors[a.Slug] = a
+				}
+				entries[a.Slug] = append(entries[a.Slug], e)
+			}
+		}
+	}
+	if len(authors) == 0 {
+		return nil
+	}
+
+	slugs := sortedKeys(authors)
+	sort.SliceStable(slugs, func(i, j int) bool {
+		return strings.ToLower(authors[slugs[i]].Name) < strings.ToLower(authors[slugs[j]].Name)
+	})
+
+	var list []map[string]any
+	for _, slug := range slugs {
+		m := authorToMap(authors[slug])
+		m["count"] = len(entries[slug])
+		list = append(list, m)
+	}
+
+	// Authors index page
+	ctx := mergePongoCtx(b.siteCtx, pongo2.Context{"authors": list})
+	rendered, err := b.env.RenderTemplate("authors_index.html", ctx)
+	if err != nil {
+		return err
+	}
+	indexDir := filepath.Join(b.outputDir, authorsDir)
+	os.MkdirAll(indexDir, 0o755)
+	os.WriteFile(filepath.Join(indexDir, "index.html"), []byte(rendered), 0o644)
+
+	// Profile pages
+	for i, slug := range slugs {
+		ctx := mergePongoCtx(b.siteCtx, pongo2.Context{
+			"author":  list[i],
+			"entries": entriesToListFormatted(newestFirst(entries[slug]), "%b %d, %Y", b.locale),
+		})
+		rendered, err := b.env.RenderTemplate("author.html", ctx)
+		if err != nil {
+			return err
+		}
+		authorDir := filepath.Join(indexDir, slug)
+		os.MkdirAll(authorDir, 0o755)
+		os.WriteFile(filepath.Join(authorDir, "index.html"), []byte(rendered), 0o644)
+	}
+
+	return nil
+}
+
+// newestFirst sorts entries from several collections by date, newest
+// first, with undated entries last.
+func newestFirst(entries []Entry) []Entry {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return timeOrZero(sorted[i].Date).After(timeOrZero(sorted[j].Date))
+	})
+	return sorted
+}
+
+func authorToMap(a Author) map[string]any {
+	return map[string]any{
+		"id":     a.ID,
+		"name":   a.Name,
+		"bio":    a.Bio,
+		"avatar": a.Avatar,
+		"links":  a.Links,
+		"slug":   a.Slug,
+		"url":    a.URL,
+	}
+}
+
+func authorsToList(authors []Author) []map[string]any {
+	var list []map[string]any
+	for _, a := range authors {
+		list = append(list, authorToMap(a))
+	}
+	return list
+}
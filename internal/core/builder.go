@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"math"
@@ -20,10 +21,19 @@ const wordsPerMinute = 200
 
 // BuildOptions configures the build pipeline.
 type BuildOptions struct {
-	PublishMode       bool   // When true, exclude private pages/collections
-	OutputDirOverride string // Override output directory (e.g. "dist-publish")
-	BasePath          string // URL base path override (e.g. "/bark"). Empty = auto from site.url in publish mode.
-	NoBasePath        bool   // When true, force empty base path even in publish mode
+	PublishMode       bool                // When true, exclude (or encrypt, see build.private_mode) private pages/collections
+	Audience          []string            // Access groups of a publish build: pages with a matching visibility are included
+	OutputDirOverride string              // Override output directory (e.g. "dist-publish")
+	BasePath          string              // URL base path override (e.g. "/bark"). Empty = auto from site.url in publish mode.
+	NoBasePath        bool                // When true, force empty base path even in publish mode
+	IncludeDrafts     bool                // Build entries marked draft: true
+	IncludeFuture     bool                // Build entries whose publish_date is still in the future
+	IncludeExpired    bool                // Build entries whose expiry_date has passed
+	Warn              func(msg string)    // Receives non-fatal problems (e.g. unreadable dates); nil = ignore
+	Progress          func(BuildProgress) // Receives the build's phase and counts as it goes; nil = ignore
+	ChangedFiles      []string            // Project files changed since the last build; static assets alone are copied, not rebuilt
+	Version           string              // Name of the version being built by BuildVersions
+	Versions          []VersionLink       // Every built version, for the version switcher
 }
 
 // CollectionContext holds metadata about a collection for templates.
@@ -37,20 +47,30 @@ type CollectionContext struct {
 
 // ── Main build function ─────────────────────────────────────
 
-// BuildSite runs the full build pipeline.
-func BuildSite(config *OpenDocConfig, projectDir string, themesFS fs.FS, options BuildOptions) error {
+// BuildSite runs the full build pipeline. Cancelling ctx stops the build
+// between pages and returns ctx's error, leaving the previous output in
+// place.
+func BuildSite(ctx context.Context, config *OpenDocConfig, projectDir string, themesFS fs.FS, options BuildOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	outputDirName := config.Build.OutputDir
 	if options.OutputDirOverride != "" {
 		outputDirName = options.OutputDirOverride
 	}
-	outputDir := filepath.Join(projectDir, outputDirName)
-	contentDir := filepath.Join(projectDir, config.Content.Dir)
+	finalDir := filepath.Join(projectDir, outputDirName)
 
-	// Step 1: Clean output directory
-	if _, err := os.Stat(outputDir); err == nil {
-		os.RemoveAll(outputDir)
+	if len(options.ChangedFiles) > 0 && updateStatic(config, projectDir, finalDir, options) {
+		return nil
+	}
+
+	// Step 1: Build into a hidden directory beside the output, which
+	// replaces it only once the build has succeeded.
+	outputDir, err := newStagingDir(finalDir)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
-	os.MkdirAll(outputDir, 0o755)
+	defer os.RemoveAll(outputDir) // gone already once it replaced the output
 
 	// Step 2: Set up renderer
 	md := NewMarkdownRenderer()
@@ -58,10 +78,23 @@ func BuildSite(config *OpenDocConfig, projectDir string, themesFS fs.FS, options
 	if err != nil {
 		return fmt.Errorf("failed to load theme: %w", err)
 	}
+	shortcodes := NewShortcodes(projectDir, env, md)
 
-	// Step 3: Determine which pages/collections are private
+	// Step 3: Determine which pages/collections are private. With
+	// build.private_mode: encrypt they are built and then sealed instead
+	// of being left out.
 	privatePageSlugs := make(map[string]bool)
 	privateCollections := make(map[string]bool)
+	var sealer *pageSealer
+	if options.PublishMode && config.Build.PrivateMode == PrivateEncrypt {
+		passphrase := ResolvePrivatePassphrase()
+		if passphrase == "" {
+			return fmt.Errorf("build.private_mode is encrypt but no passphrase is set: export %s or add private_passphrase to %s", PrivatePassphraseEnv, SecretsPath())
+		}
+		if sealer, err = newPageSealer(passphrase, config.Site); err != nil {
+			return fmt.Errorf("private pages: %w", err)
+		}
+	}
 
 	if options.PublishMode {
 		for _, item := range config.Nav {
@@ -76,151 +109,556 @@ func BuildSite(config *OpenDocConfig, projectDir string, themesFS fs.FS, options
 		}
 	}
 
+	// Compute base_path from site.url for GitHub Pages subpath support
+	basePath := ""
+	if options.NoBasePath {
+		// Explicitly disabled (e.g. workbench publish preview)
+	} else if options.BasePath != "" {
+		basePath = options.BasePath
+	} else if options.PublishMode {
+		basePath = publishBasePath(config)
+	}
+
+	// Step 4: Discover the pages and entries of every language. All content
+	// is loaded before rendering so site-wide taxonomies, series navigation
+	// and translation links can see every page and entry.
+	var gitInfo *GitInfo
+	if config.Build.GitInfo {
+		gitInfo = LoadGitInfo(projectDir)
+	}
+	translations := make(translationIndex)
+	progress := &buildProgress{report: options.Progress, projectDir: projectDir, multilang: len(config.Languages) > 0}
+	var builds []*siteBuild
+	for _, code := range config.LanguageCodes() {
+		progress.send(BuildProgress{Phase: PhaseDiscover, Lang: code})
+		b, err := newSiteBuild(config, options, projectDir, outputDir, basePath, code, md, env, shortcodes)
+		if err != nil {
+			return err
+		}
+		b.ctx = ctx
+		b.progress = progress
+		b.translations = translations
+		b.gitInfo = gitInfo
+		b.sealer = sealer
+		b.privatePages = privatePageSlugs
+		b.privateCollections = privateCollections
+		b.discover()
+		builds = append(builds, b)
+		progress.total += len(b.pages)
+		for _, entries := range b.collections {
+			progress.total += len(entries)
+		}
+	}
+
+	// Step 5: Render each language
+	for _, b := range builds {
+		err := b.render()
+		if err == nil && sealer != nil {
+			err = b.sealPrivate()
+		}
+		if err != nil {
+			if len(builds) > 1 {
+				return fmt.Errorf("language '%s': %w", b.lang, err)
+			}
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Step 6: Copy static assets from theme
+	progress.send(BuildProgress{Phase: PhaseAssets})
+	copyThemeStatic(config.Theme.Name, outputDir, themesFS)
+
+	// Step 7: Write highlight CSS
+	cssDir := filepath.Join(outputDir, "static", "css")
+	os.MkdirAll(cssDir, 0o755)
+	os.WriteFile(filepath.Join(cssDir, "pygments.css"), []byte(GetHighlightCSS()), 0o644)
+
+	// Step 8: Copy user static assets
+	userStatic := filepath.Join(projectDir, config.Content.Dir, "static")
+	if info, err := os.Stat(userStatic); err == nil && info.IsDir() {
+		copyDir(userStatic, filepath.Join(outputDir, "static"))
+	}
+
+	// Step 9: Write build ID for live reload. Publish builds skip it so
+	// an unchanged site deploys as unchanged.
+	if !options.PublishMode {
+		os.WriteFile(filepath.Join(outputDir, ".opendoc-build-id"), []byte(fmt.Sprintf("%d", time.Now().UnixMilli())), 0o644)
+	}
+
+	if err := replaceDir(outputDir, finalDir); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", outputDirName, err)
+	}
+
+	progress.send(BuildProgress{Phase: PhaseDone})
+	return nil
+}
+
+// newStagingDir creates an empty hidden directory beside dir to build
+// into, so it can be renamed over dir.
+func newStagingDir(dir string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-building-")
+	if err != nil {
+		return "", err
+	}
+	return staging, os.Chmod(staging, 0o755)
+}
+
+// replaceDir moves src to dst, replacing whatever dst held.
+func replaceDir(src, dst string) error {
+	old := src + "-old"
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Rename(old, dst)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// ── Language builder ────────────────────────────────────────
+
+// siteBuild carries the state shared by every step of building one
+// language of the site.
+type siteBuild struct {
+	ctx        context.Context // checked between pages, see BuildSite
+	progress   *buildProgress
+	config     *OpenDocConfig
+	options    BuildOptions
+	lang       string // language code
+	files      LanguageFiles
+	contentDir string
+	outputDir  string // site root for the default language, <root>/<lang> otherwise
+	basePath   string // prefix for static assets
+	prefix     string // prefix for content URLs: basePath plus /<lang> for other languages
+	md         goldmark.Markdown
+	env        *TemplateEnv
+	shortcodes *Shortcodes
+	siteCtx    pongo2.Context
+	i18n       map[string]any
+	locale     *DateLocale
+	now        time.Time // reference time for publish_date / expiry_date
+
+	nav          []NavItem // the language's nav, without private items in exclude publish builds
+	pages        []Page
+	collections  map[string][]Entry            // published entries per collection, in sort order
+	terms        map[string]map[string][]Entry // cached term indexes, see termsFor
+	termSlugs    map[string]map[string]string  // cached term slugs, see termSlugsFor
+	translations translationIndex              // shared by all languages of the build
+	gitInfo      *GitInfo                      // nil unless build.git_info is on
+
+	// Publish builds only: private pages and collections from nav, and
+	// the sealer when they are published encrypted.
+	privatePages       map[string]bool
+	privateCollections map[string]bool
+	sealer             *pageSealer
+	sealed             []string // slugs of private pages and entries outside private collections, to encrypt
+}
+
+func newSiteBuild(
+	config *OpenDocConfig,
+	options BuildOptions,
+	projectDir, outputDir, basePath, lang string,
+	md goldmark.Markdown,
+	env *TemplateEnv,
+	shortcodes *Shortcodes,
+) (*siteBuild, error) {
+	langConfig := config.Language(lang)
+
+	contentDir := filepath.Join(projectDir, config.Content.Dir)
+	var files LanguageFiles
+	if len(config.Languages) > 0 {
+		files = LanguageFiles{Code: lang}
+		for _, code := range config.LanguageCodes() {
+			if code != lang {
+				files.Others = append(files.Others, code)
+			}
+		}
+		if langConfig.ContentDir != "" {
+			contentDir = filepath.Join(projectDir, langConfig.ContentDir)
+		} else if lang != config.Site.Language {
+			files.SuffixOnly = true
+		}
+	}
+
+	b := &siteBuild{
+		config:      config,
+		options:     options,
+		lang:        lang,
+		files:       files,
+		contentDir:  contentDir,
+		outputDir:   outputDir,
+		basePath:    basePath,
+		prefix:      basePath,
+		md:          md,
+		env:         env,
+		shortcodes:  shortcodes,
+		now:         time.Now().In(config.Location()),
+		collections: make(map[string][]Entry),
+		terms:       make(map[string]map[string][]Entry),
+		termSlugs:   make(map[string]map[string]string),
+	}
+	if lang != config.Site.Language {
+		b.outputDir = filepath.Join(outputDir, lang)
+		b.prefix = basePath + "/" + lang
+	}
+
+	i18n, err := loadI18n(env, projectDir, lang)
+	if err != nil {
+		return nil, err
+	}
+	b.i18n = i18n
+	b.locale = dateLocale(i18n)
+
 	// Build nav for templates — in publish mode, filter out private items
-	navForTemplates := config.Nav
-	if options.PublishMode {
+	// unless they are published encrypted
+	nav := config.Nav
+	if len(langConfig.Nav) > 0 {
+		nav = langConfig.Nav
+	}
+	if options.PublishMode && config.Build.PrivateMode != PrivateEncrypt {
 		var filtered []NavItem
-		for _, item := range config.Nav {
+		for _, item := range nav {
 			if !item.Private {
 				filtered = append(filtered, item)
 			}
 		}
-		navForTemplates = filtered
+		nav = filtered
 	}
 
-	// Step 4: Discover and render pages
-	pages := DiscoverPages(contentDir)
-	if options.PublishMode {
-		var filtered []Page
-		for _, p := range pages {
-			if !privatePageSlugs[p.Slug] {
-				filtered = append(filtered, p)
-			}
+	b.nav = nav
+	b.siteCtx = pongo2.Context{
+		"site":        siteToMap(config.Site),
+		"nav":         navToList(nav),
+		"config":      configToMap(config),
+		"base_path":   basePath,
+		"lang":        lang,
+		"lang_prefix": b.prefix,
+		"i18n":        i18n,
+		"version":     options.Version,
+		"versions":    versionsToList(options.Versions, options.Version),
+	}
+	return b, nil
+}
+
+// discover loads the language's pages and collection entries (skipping
+// private ones in publish mode) and registers them for translation links.
+func (b *siteBuild) discover() {
+	// Nav paths of pages marked private in their frontmatter, and of
+	// pages left out of the build.
+	privateNav := make(map[string]bool)
+	hiddenNav := make(map[string]bool)
+
+	for _, p := range DiscoverPagesLang(b.contentDir, b.files) {
+		navPath := ""
+		if p.Slug != "" {
+			navPath = p.Slug + "/"
 		}
-		pages = filtered
+		if p.Private {
+			privateNav[navPath] = true
+		}
+		if !b.publishes(p.Slug, p.Private || b.privatePages[p.Slug], p.Visibility) {
+			hiddenNav[navPath] = true
+			continue
+		}
+		p.History = b.history(p.SourcePath)
+		b.pages = append(b.pages, p)
+		b.translations.add(pageTranslationKey(p), b.lang, b.pageURL(p))
 	}
 
-	// Compute base_path from site.url for GitHub Pages subpath support
-	basePath := ""
-	if options.NoBasePath {
-		// Explicitly disabled (e.g. workbench publish preview)
-	} else if options.BasePath != "" {
-		basePath = options.BasePath
-	} else if options.PublishMode {
-		basePath = extractBasePath(config.Site.URL)
+	for _, collName := range sortedKeys(b.config.Collections) {
+		if b.options.PublishMode && b.privateCollections[collName] && b.sealer == nil {
+			continue
+		}
+		b.collections[collName] = b.discoverCollection(collName, b.config.Collections[collName])
+		for _, e := range b.collections[collName] {
+			b.translations.add(entryTranslationKey(e), b.lang, e.URL)
+		}
 	}
 
-	siteCtx := pongo2.Context{
-		"site":      siteToMap(config.Site),
-		"nav":       navToList(navForTemplates),
-		"config":    configToMap(config),
-		"base_path": basePath,
+	if len(privateNav) > 0 || len(hiddenNav) > 0 {
+		var nav []NavItem
+		for _, item := range b.nav {
+			if hiddenNav[item.Path] {
+				continue
+			}
+			if privateNav[item.Path] {
+				item.Private = true
+			}
+			nav = append(nav, item)
+		}
+		b.siteCtx["nav"] = navToList(nav)
 	}
+}
 
-	for _, page := range pages {
-		result := RenderMarkdown(md, page.ContentMarkdown)
-		ctx := mergePongoCtx(siteCtx, pongo2.Context{
-			"page":    pageToMap(page),
+// publishes reports whether a page or entry is part of the build, and
+// queues it for encryption when it is private and published encrypted.
+// Outside publish mode everything is built.
+func (b *siteBuild) publishes(slug string, private bool, visibility []string) bool {
+	if !b.options.PublishMode {
+		return true
+	}
+	if !visibleTo(visibility, b.options.Audience) {
+		return false
+	}
+	if !private {
+		return true
+	}
+	if b.sealer == nil {
+		return false
+	}
+	b.sealed = append(b.sealed, slug)
+	return true
+}
+
+// render writes every page of the language.
+func (b *siteBuild) render() error {
+	b.siteCtx["languages"] = b.languageLinks("")
+
+	// Pages
+	for _, page := range b.pages {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		b.progress.rendering(BuildProgress{Phase: PhasePages, Lang: b.lang, File: page.SourcePath})
+		key := pageTranslationKey(page)
+		pageCtx := mergePongoCtx(b.siteCtx, pongo2.Context{
+			"page":              pageToMap(page),
+			"languages":         b.languageLinks(key),
+			"translations":      b.translationsFor(key),
+			"formatted_created": b.formatHistory(page.History, false),
+			"formatted_updated": b.formatHistory(page.History, true),
+		})
+		body, err := b.shortcodes.Expand(page.ContentMarkdown, page.SourcePath, page.BodyLine, pageCtx)
+		if err != nil {
+			return fmt.Errorf("render page '%s': %w", page.Slug, err)
+		}
+		result := RenderMarkdown(b.md, body)
+		ctx := mergePongoCtx(pageCtx, pongo2.Context{
 			"content": result.HTML,
 			"toc":     result.TOC,
 		})
 
-		rendered, err := env.RenderTemplate("page.html", ctx)
+		rendered, err := b.env.RenderTemplate("page.html", ctx)
 		if err != nil {
 			return fmt.Errorf("render page '%s': %w", page.Slug, err)
 		}
 
 		if page.Slug == "" {
-			os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(rendered), 0o644)
+			os.MkdirAll(b.outputDir, 0o755)
+			os.WriteFile(filepath.Join(b.outputDir, "index.html"), []byte(rendered), 0o644)
 		} else {
-			pageDir := filepath.Join(outputDir, page.Slug)
+			pageDir := filepath.Join(b.outputDir, page.Slug)
 			os.MkdirAll(pageDir, 0o755)
 			os.WriteFile(filepath.Join(pageDir, "index.html"), []byte(rendered), 0o644)
 		}
 	}
 
-	// Step 5: Process each collection (skip private ones in publish mode)
-	for collName, collConfig := range config.Collections {
-		if options.PublishMode && privateCollections[collName] {
+	// Collections
+	for _, collName := range sortedKeys(b.collections) {
+		if err := b.buildCollection(collName, b.config.Collections[collName]); err != nil {
+			return fmt.Errorf("collection '%s': %w", collName, err)
+		}
+	}
+
+	// Site-wide taxonomies
+	for _, taxName := range sortedKeys(b.config.Taxonomies) {
+		tax := b.config.Taxonomies[taxName]
+		if tax.Scope != "site" {
 			continue
 		}
-		if err := buildCollection(collName, collConfig, contentDir, outputDir, md, env, siteCtx, basePath); err != nil {
-			return fmt.Errorf("collection '%s': %w", collName, err)
+		if err := b.renderTaxonomy(taxName, tax, ""); err != nil {
+			return fmt.Errorf("taxonomy '%s': %w", taxName, err)
 		}
 	}
 
-	// Step 6: Copy static assets from theme
-	copyThemeStatic(config.Theme.Name, outputDir, themesFS)
+	// Author profiles
+	if err := b.renderAuthors(); err != nil {
+		return fmt.Errorf("authors: %w", err)
+	}
 
-	// Step 7: Write highlight CSS
-	cssDir := filepath.Join(outputDir, "static", "css")
-	os.MkdirAll(cssDir, 0o755)
-	os.WriteFile(filepath.Join(cssDir, "pygments.css"), []byte(GetHighlightCSS()), 0o644)
+	return nil
+}
 
-	// Step 8: Copy user static assets
-	userStatic := filepath.Join(projectDir, config.Content.Dir, "static")
-	if info, err := os.Stat(userStatic); err == nil && info.IsDir() {
-		copyDir(userStatic, filepath.Join(outputDir, "static"))
+// warn reports a non-fatal problem through BuildOptions.Warn.
+func (b *siteBuild) warn(msg string) {
+	if b.options.Warn == nil {
+		return
 	}
+	if len(b.config.Languages) > 0 {
+		msg = "[" + b.lang + "] " + msg
+	}
+	b.options.Warn(msg)
+}
 
-	// Step 9: Write build ID for live reload
-	os.WriteFile(filepath.Join(outputDir, ".opendoc-build-id"), []byte(fmt.Sprintf("%d", time.Now().UnixMilli())), 0o644)
+// history looks up a source file's history when build.git_info is on,
+// with times in the site's timezone.
+func (b *siteBuild) history(path string) *FileHistory {
+	if b.gitInfo == nil {
+		return nil
+	}
+	h := b.gitInfo.History(path)
+	if h == nil {
+		return nil
+	}
+	local := *h
+	local.Created = h.Created.In(b.config.Location())
+	local.Updated = h.Updated.In(b.config.Location())
+	return &local
+}
 
-	return nil
+// formatHistory formats a file's created (or updated) time with the
+// language's updated_format string.
+func (b *siteBuild) formatHistory(h *FileHistory, updated bool) string {
+	if h == nil {
+		return ""
+	}
+	format, _ := b.i18n["updated_format"].(string)
+	if format == "" {
+		format = "%B %-d, %Y"
+	}
+	t := h.Created
+	if updated {
+		t = h.Updated
+	}
+	return StrftimeIn(&t, format, b.locale)
+}
+
+func (b *siteBuild) pageURL(p Page) string {
+	if p.Slug == "" {
+		return b.prefix + "/"
+	}
+	return b.prefix + "/" + p.Slug + "/"
 }
 
 // ── Collection builder ──────────────────────────────────────
 
-func buildCollection(
-	collName string,
-	collConfig CollectionConfig,
-	contentDir, outputDir string,
-	md goldmark.Markdown,
-	env *TemplateEnv,
-	siteCtx pongo2.Context,
-	basePath string,
-) error {
-	entriesDir := filepath.Join(contentDir, collName)
+// discoverCollection loads a collection's entries, drops drafts, scheduled
+// and expired entries (unless the build options include them) and assigns
+// each entry its collection and URL.
+func (b *siteBuild) discoverCollection(collName string, collConfig CollectionConfig) []Entry {
+	entriesDir := filepath.Join(b.contentDir, collName)
 	isDated := collConfig.Sort != "alphabetical"
-	entries := DiscoverEntries(entriesDir, collConfig.Sort, isDated)
+	entries := DiscoverEntriesLang(entriesDir, collConfig.Sort, isDated, b.files, b.config.Location())
 
-	// Filter drafts
 	var filtered []Entry
+	redated := false
 	for _, e := range entries {
-		if !e.Draft {
-			filtered = append(filtered, e)
+		for _, w := range e.Warnings {
+			b.warn(collName + "/" + w)
+		}
+		if e.Draft && !b.options.IncludeDrafts {
+			continue
+		}
+		if e.IsScheduled(b.now) && !b.options.IncludeFuture {
+			continue
+		}
+		if e.IsExpired(b.now) && !b.options.IncludeExpired {
+			continue
+		}
+		// Entries of a private collection are sealed with the collection.
+		if !b.publishes(collName+"/"+e.Slug, e.Private && !b.privateCollections[collName], e.Visibility) {
+			continue
+		}
+		e.Collection = collName
+		e.URL = b.prefix + "/" + collName + "/" + e.Slug + "/"
+		e.Sealed = b.sealer != nil && (e.Private || b.privateCollections[collName])
+		e.Authors = b.resolveAuthors(e)
+		e.History = b.history(e.SourcePath)
+		// Undated entries were stamped with the build time; the file's
+		// first commit is a better guess.
+		if isDated && e.Meta["date"] == nil && e.History != nil {
+			created := e.History.Created
+			e.Date = &created
+			redated = true
 		}
+		filtered = append(filtered, e)
 	}
-	entries = filtered
+	if redated {
+		sortEntries(filtered, collConfig.Sort)
+	}
+	return filtered
+}
+
+func (b *siteBuild) buildCollection(collName string, collConfig CollectionConfig) error {
+	entries := b.collections[collName]
+	if b.privateCollections[collName] {
+		// Every page of the collection is sealed whole, so its own
+		// listings may show everything.
+		entries = unsealed(entries)
+	}
+	isDated := collConfig.Sort != "alphabetical"
+	env, siteCtx, outputDir := b.env, b.siteCtx, b.outputDir
 
 	collection := CollectionContext{
 		Name:       collName,
 		Label:      titleCase(strings.ReplaceAll(strings.ReplaceAll(collName, "-", " "), "_", " ")),
-		URLPrefix:  basePath + "/" + collName + "/",
+		URLPrefix:  b.prefix + "/" + collName + "/",
 		Layout:     collConfig.Layout,
 		DateFormat: collConfig.DateFormat,
 	}
 
-	allTags := collectTags(entries)
+	allTags := publicTerms(collectTags(entries))
 
 	// Render individual entries
-	for _, entry := range entries {
-		result := RenderMarkdown(md, entry.ContentMarkdown)
+	for i, entry := range entries {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		b.progress.rendering(BuildProgress{Phase: PhaseCollection, Lang: b.lang, Collection: collName, File: entry.SourcePath})
+		entryCtx := mergePongoCtx(siteCtx, pongo2.Context{
+			"entry":      entryToMap(entry.unsealed()),
+			"collection": collectionToMap(collection),
+		})
+		body, err := b.shortcodes.Expand(entry.ContentMarkdown, entry.SourcePath, entry.BodyLine, entryCtx)
+		if err != nil {
+			return fmt.Errorf("render entry '%s': %w", entry.Slug, err)
+		}
+		result := RenderMarkdown(b.md, body)
 		formattedDate := ""
 		if entry.Date != nil {
-			formattedDate = Strftime(entry.Date, collConfig.DateFormat)
+			formattedDate = StrftimeIn(entry.Date, collConfig.DateFormat, b.locale)
 		}
 		readingTime := estimateReadingTime(entry.ContentMarkdown)
+		terms, series := b.entryTaxonomies(entry)
 
+		// Neighbours follow the collection's sort order: prev_entry is the
+		// one listed before this entry on the index page.
+		var prevEntry, nextEntry map[string]any
+		if i > 0 {
+			prevEntry = entryToMap(entries[i-1])
+		}
+		if i+1 < len(entries) {
+			nextEntry = entryToMap(entries[i+1])
+		}
+		related := relatedEntries(entries, i, b.relatedTaxonomies(), collConfig.Related)
+
+		key := entryTranslationKey(entry)
 		ctx := mergePongoCtx(siteCtx, pongo2.Context{
-			"entry":          entryToMap(entry),
-			"post":           entryToMap(entry), // backward compat
-			"content":        result.HTML,
-			"toc":            result.TOC,
-			"formatted_date": formattedDate,
-			"reading_time":   readingTime,
-			"collection":     collectionToMap(collection),
-			"all_tags":       allTags,
+			"entry":             entryToMap(entry.unsealed()),
+			"post":              entryToMap(entry.unsealed()), // backward compat
+			"languages":         b.languageLinks(key),
+			"translations":      b.translationsFor(key),
+			"content":           result.HTML,
+			"toc":               result.TOC,
+			"formatted_date":    formattedDate,
+			"reading_time":      readingTime,
+			"collection":        collectionToMap(collection),
+			"all_tags":          allTags,
+			"terms":             terms,
+			"series":            series,
+			"prev_entry":        prevEntry,
+			"next_entry":        nextEntry,
+			"related":           entriesToListFormatted(related, collConfig.DateFormat, b.locale),
+			"formatted_created": b.formatHistory(entry.History, false),
+			"formatted_updated": b.formatHistory(entry.History, true),
 		})
 
 		rendered, err := env.RenderTemplate("entry.html", ctx)
@@ -234,18 +672,29 @@ func buildCollection(
 	}
 
 	// Render collection index
-	if err := renderCollectionIndex(entries, collConfig, collection, allTags, env, siteCtx, outputDir); err != nil {
+	if err := renderCollectionIndex(entries, collConfig, collection, allTags, env, siteCtx, outputDir, b.locale); err != nil {
 		return err
 	}
 
 	// Render archive (if enabled and dated)
 	if collConfig.Archive && isDated {
-		renderArchive(entries, collection, env, siteCtx, outputDir)
+		renderArchive(entries, collection, env, siteCtx, outputDir, b.locale)
 	}
 
 	// Render tag pages (if enabled)
 	if collConfig.Tags && len(allTags) > 0 {
-		renderTagPages(allTags, collection, env, siteCtx, outputDir)
+		renderTagPages(allTags, collection, env, siteCtx, outputDir, b.locale)
+	}
+
+	// Render collection-scoped taxonomies
+	for _, taxName := range sortedKeys(b.config.Taxonomies) {
+		tax := b.config.Taxonomies[taxName]
+		if tax.Scope != "collection" {
+			continue
+		}
+		if err := b.renderTaxonomy(taxName, tax, collName); err != nil {
+			return fmt.Errorf("taxonomy '%s': %w", taxName, err)
+		}
 	}
 
 	return nil
@@ -259,6 +708,7 @@ func renderCollectionIndex(
 	env *TemplateEnv,
 	siteCtx pongo2.Context,
 	outputDir string,
+	loc *DateLocale,
 ) error {
 	pageEntries := entries
 	if collConfig.ItemsPerPage > 0 && len(entries) > collConfig.ItemsPerPage {
@@ -266,8 +716,8 @@ func renderCollectionIndex(
 	}
 
 	ctx := mergePongoCtx(siteCtx, pongo2.Context{
-		"entries":    entriesToListFormatted(pageEntries, collConfig.DateFormat),
-		"posts":     entriesToListFormatted(pageEntries, collConfig.DateFormat), // backward compat
+		"entries":    entriesToListFormatted(pageEntries, collConfig.DateFormat, loc),
+		"posts":     entriesToListFormatted(pageEntries, collConfig.DateFormat, loc), // backward compat
 		"collection": collectionToMap(collection),
 		"all_tags":  allTags,
 		"layout":    collConfig.Layout,
@@ -290,6 +740,7 @@ func renderArchive(
 	env *TemplateEnv,
 	siteCtx pongo2.Context,
 	outputDir string,
+	loc *DateLocale,
 ) {
 	entriesByYear := make(map[int][]Entry)
 	for _, entry := range entries {
@@ -308,7 +759,7 @@ func renderArchive(
 
 	sortedByYear := make(map[string][]map[string]any)
 	for _, y := range years {
-		sortedByYear[fmt.Sprintf("%d", y)] = entriesToListFormatted(entriesByYear[y], "%b %d")
+		sortedByYear[fmt.Sprintf("%d", y)] = entriesToListFormatted(entriesByYear[y], "%b %d", loc)
 	}
 
 	ctx := mergePongoCtx(siteCtx, pongo2.Context{
@@ -329,6 +780,7 @@ func renderTagPages(
 	env *TemplateEnv,
 	siteCtx pongo2.Context,
 	outputDir string,
+	loc *DateLocale,
 ) {
 	tagsDir := filepath.Join(outputDir, collection.Name, "tags")
 	os.MkdirAll(tagsDir, 0o755)
@@ -346,8 +798,8 @@ func renderTagPages(
 		tagSlug := strings.ToLower(strings.ReplaceAll(tag, " ", "-"))
 		ctx := mergePongoCtx(siteCtx, pongo2.Context{
 			"tag":        tag,
-			"entries":    entriesToListFormatted(tagEntries, "%b %d, %Y"),
-			"posts":     entriesToListFormatted(tagEntries, "%b %d, %Y"),
+			"entries":    entriesToListFormatted(tagEntries, "%b %d, %Y", loc),
+			"posts":     entriesToListFormatted(tagEntries, "%b %d, %Y", loc),
 			"collection": collectionToMap(collection),
 		})
 
@@ -370,13 +822,17 @@ func estimateReadingTime(text string) int {
 }
 
 func collectTags(entries []Entry) map[string][]Entry {
-	tags := make(map[string][]Entry)
-	for _, entry := range entries {
-		for _, tag := range entry.Tags {
-			tags[tag] = append(tags[tag], entry)
-		}
+	return collectTerms(entries, "tags")
+}
+
+// sortedKeys returns the keys of a string-keyed map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	return tags
+	sort.Strings(keys)
+	return keys
 }
 
 func copyThemeStatic(themeName, outputDir string, themesFS fs.FS) {
@@ -410,6 +866,15 @@ func copyDir(src, dst string) {
 	})
 }
 
+// publishBasePath returns the base path of a publish build: none when the
+// site has a custom domain, otherwise the path of site.url.
+func publishBasePath(config *OpenDocConfig) string {
+	if config.Site.CustomDomain != "" {
+		return ""
+	}
+	return extractBasePath(config.Site.URL)
+}
+
 // extractBasePath returns the path component from a URL, for GitHub Pages subpath support.
 // e.g. "https://user.github.io/repo" → "/repo"
 // e.g. "https://example.com" → ""
@@ -441,6 +906,7 @@ func siteToMap(s SiteConfig) map[string]any {
 		"url":         s.URL,
 		"description": s.Description,
 		"author":      s.Author,
+		"language":    s.Language,
 	}
 }
 
@@ -464,38 +930,126 @@ func configToMap(c *OpenDocConfig) map[string]any {
 }
 
 func pageToMap(p Page) map[string]any {
-	return map[string]any{
-		"title": p.Title,
-		"slug":  p.Slug,
-		"meta":  p.Meta,
+	m := map[string]any{
+		"title":      p.Title,
+		"slug":       p.Slug,
+		"private":    p.Private,
+		"visibility": p.Visibility,
+		"meta":       p.Meta,
 	}
+	addHistory(m, p.History)
+	return m
 }
 
+// entryToMap returns the template fields of an entry. Sealed entries, whose
+// pages are encrypted, only give away their title and URL.
 func entryToMap(e Entry) map[string]any {
+	if e.Sealed {
+		return map[string]any{
+			"title":      e.Title,
+			"slug":       e.Slug,
+			"url":        e.URL,
+			"collection": e.Collection,
+			"private":    true,
+			"sealed":     true,
+		}
+	}
 	m := map[string]any{
 		"title":       e.Title,
 		"slug":        e.Slug,
 		"tags":        e.Tags,
 		"description": e.Description,
 		"draft":       e.Draft,
+		"private":     e.Private,
+		"visibility":  e.Visibility,
 		"meta":        e.Meta,
 	}
+	if e.URL != "" {
+		m["url"] = e.URL
+		m["collection"] = e.Collection
+	}
+	if len(e.Authors) > 0 {
+		m["authors"] = authorsToList(e.Authors)
+		m["author"] = authorToMap(e.Authors[0])
+	}
 	if e.Date != nil {
 		m["date"] = *e.Date
 		m["iso_date"] = Isoformat(e.Date)
 	}
+	now := time.Now()
+	m["scheduled"] = e.IsScheduled(now)
+	m["expired"] = e.IsExpired(now)
+	if e.PublishDate != nil {
+		m["publish_date"] = *e.PublishDate
+	}
+	if e.ExpiryDate != nil {
+		m["expiry_date"] = *e.ExpiryDate
+	}
+	addHistory(m, e.History)
 	return m
 }
 
-// entryToMapFormatted returns an entry map with a pre-formatted date string.
-func entryToMapFormatted(e Entry, dateFormat string) map[string]any {
+// addHistory adds a source file's created/updated times and contributors
+// to a page or entry map.
+func addHistory(m map[string]any, h *FileHistory) {
+	if h == nil {
+		return
+	}
+	m["created"] = h.Created
+	m["updated"] = h.Updated
+	m["iso_updated"] = Isoformat(&h.Updated)
+	var contributors []map[string]any
+	for _, c := range h.Contributors {
+		contributors = append(contributors, map[string]any{
+			"name":    c.Name,
+			"email":   c.Email,
+			"commits": c.Commits,
+		})
+	}
+	m["contributors"] = contributors
+}
+
+// entryToMapFormatted returns an entry map with a date string formatted
+// in the given locale.
+func entryToMapFormatted(e Entry, dateFormat string, loc *DateLocale) map[string]any {
 	m := entryToMap(e)
-	if e.Date != nil {
-		m["formatted_date"] = Strftime(e.Date, dateFormat)
+	if e.Date != nil && !e.Sealed {
+		m["formatted_date"] = StrftimeIn(e.Date, dateFormat, loc)
 	}
 	return m
 }
 
+// unsealed returns e as shown on its own page, which is encrypted whole.
+func (e Entry) unsealed() Entry {
+	e.Sealed = false
+	return e
+}
+
+func unsealed(entries []Entry) []Entry {
+	out := make([]Entry, len(entries))
+	for i, e := range entries {
+		out[i] = e.unsealed()
+	}
+	return out
+}
+
+// publicTerms replaces sealed entries in a term index handed to templates
+// as-is with copies holding only what entryToMap shows of them.
+func publicTerms(terms map[string][]Entry) map[string][]Entry {
+	out := make(map[string][]Entry, len(terms))
+	for term, entries := range terms {
+		list := make([]Entry, len(entries))
+		for i, e := range entries {
+			if e.Sealed {
+				e = Entry{Title: e.Title, Slug: e.Slug, URL: e.URL, Collection: e.Collection, Private: true, Sealed: true}
+			}
+			list[i] = e
+		}
+		out[term] = list
+	}
+	return out
+}
+
 func entriesToList(entries []Entry) []map[string]any {
 	var list []map[string]any
 	for _, e := range entries {
@@ -504,10 +1058,10 @@ func entriesToList(entries []Entry) []map[string]any {
 	return list
 }
 
-func entriesToListFormatted(entries []Entry, dateFormat string) []map[string]any {
+func entriesToListFormatted(entries []Entry, dateFormat string, loc *DateLocale) []map[string]any {
 	var list []map[string]any
 	for _, e := range entries {
-		list = append(list, entryToMapFormatted(e, dateFormat))
+		list = append(list, entryToMapFormatted(e, dateFormat, loc))
 	}
 	return list
 }
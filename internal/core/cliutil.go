@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
@@ -27,6 +28,33 @@ func WarnMsg(msg string)    { fmt.Println(CLIWarn.Render("  warn") + "  " + msg)
 func StepMsg(msg string)    { fmt.Println(CLIMuted.Render("     ·") + "  " + msg) }
 func DoneMsg(msg string)    { fmt.Println(CLISuccess.Render("  done") + "  " + msg) }
 
+// ── Progress line ───────────────────────────────────────────
+
+// ProgressBar renders done out of total as a bar width cells wide.
+func ProgressBar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(done*width/total, width)
+	}
+	return CLIAccent.Render(strings.Repeat("█", filled)) + CLIMuted.Render(strings.Repeat("░", width-filled))
+}
+
+// ProgressMsg redraws the current line as a progress bar. Call
+// ClearProgress before printing anything else.
+func ProgressMsg(done, total int, detail string) {
+	if r := []rune(detail); len(r) > 48 {
+		detail = "…" + string(r[len(r)-47:])
+	}
+	count := ""
+	if total > 0 {
+		count = fmt.Sprintf("%d/%d", done, total)
+	}
+	fmt.Printf("\r\033[K%s  %s %s  %s", CLIMuted.Render("     ·"), ProgressBar(done, total, 24), CLIMuted.Render(count), detail)
+}
+
+// ClearProgress erases the progress line.
+func ClearProgress() { fmt.Print("\r\033[K") }
+
 // StatusLine returns a labelled value line for status output.
 func StatusLine(label, value string) string {
 	return fmt.Sprintf("  %s  %s", CLIMuted.Render(fmt.Sprintf("%16s", label)), value)
@@ -4,8 +4,12 @@ package core
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+	_ "time/tzdata" // site.timezone must work on hosts without a zoneinfo database
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,6 +18,7 @@ import (
 
 var ValidLayouts = []string{"timeline", "grid", "minimal"}
 var ValidSorts = []string{"newest_first", "oldest_first", "alphabetical"}
+var ValidTaxonomyScopes = []string{"site", "collection"}
 
 func isValidLayout(l string) bool {
 	for _, v := range ValidLayouts {
@@ -33,13 +38,31 @@ func isValidSort(s string) bool {
 	return false
 }
 
+func isValidTaxonomyScope(s string) bool {
+	for _, v := range ValidTaxonomyScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // ── Config types ────────────────────────────────────────────
 
 type SiteConfig struct {
-	Name        string `yaml:"name"`
-	URL         string `yaml:"url"`
-	Description string `yaml:"description"`
-	Author      string `yaml:"author"`
+	Name         string `yaml:"name"`
+	URL          string `yaml:"url"`
+	Description  string `yaml:"description"`
+	Author       string `yaml:"author"`
+	Language     string `yaml:"language"`      // default content language, e.g. "en"
+	Timezone     string `yaml:"timezone"`      // IANA zone for entry dates, e.g. "Europe/Berlin"; empty = UTC
+	CustomDomain string `yaml:"custom_domain"` // domain the published site is served from, e.g. docs.example.com
+}
+
+// HasURL reports whether site.url is set to something other than the
+// placeholder that new projects and the defaults start with.
+func (s SiteConfig) HasURL() bool {
+	return s.URL != "" && s.URL != DefaultSite.URL
 }
 
 type ContentConfig struct {
@@ -47,7 +70,9 @@ type ContentConfig struct {
 }
 
 type BuildConfig struct {
-	OutputDir string `yaml:"output_dir"`
+	OutputDir   string `yaml:"output_dir"`
+	GitInfo     bool   `yaml:"git_info"`     // created/updated dates and contributors from git log
+	PrivateMode string `yaml:"private_mode"` // private pages in publish builds: "exclude" or "encrypt"
 }
 
 type CollectionConfig struct {
@@ -57,6 +82,75 @@ type CollectionConfig struct {
 	Tags         bool   `yaml:"tags"`
 	Archive      bool   `yaml:"archive"`
 	Layout       string `yaml:"layout"`
+	Related      int    `yaml:"related"` // max related entries on each entry page (0 = off)
+}
+
+// TaxonomyConfig describes a frontmatter key (e.g. categories, series)
+// whose values get their own term index and term pages.
+type TaxonomyConfig struct {
+	Label   string `yaml:"label"`
+	Scope   string `yaml:"scope"`   // "site" (one index for all collections) or "collection"
+	Ordered bool   `yaml:"ordered"` // prev/next navigation through each term's entries (series)
+}
+
+// AuthorConfig is a person's profile, keyed by author ID in the authors
+// map of opendoc.yml or data/authors.yml.
+type AuthorConfig struct {
+	Name   string            `yaml:"name"`
+	Bio    string            `yaml:"bio"`
+	Avatar string            `yaml:"avatar"`
+	Links  map[string]string `yaml:"links"` // label → URL, e.g. github: https://github.com/me
+}
+
+// LanguageConfig describes one content language. The default language
+// (site.language) is built at the site root, every other one under /<code>/.
+type LanguageConfig struct {
+	Code       string
+	Name       string    // shown in the language switcher
+	ContentDir string    // own content tree; empty = name.<code>.md files in content.dir
+	Weight     int       // switcher order after the default language
+	Nav        []NavItem // optional translated nav; empty = the top-level nav
+}
+
+// VersionConfig is one version of the documentation, built from a git
+// branch, tag or commit by `opendoc build --versions`.
+type VersionConfig struct {
+	Name   string `yaml:"name"`   // URL segment, e.g. v2
+	Ref    string `yaml:"ref"`    // git ref to build; defaults to Name
+	Label  string `yaml:"label"`  // shown in the version switcher; defaults to Name
+	Latest bool   `yaml:"latest"` // also published under /latest/
+}
+
+// DeployConfig lists the destinations `opendoc publish` can deploy to.
+type DeployConfig struct {
+	Default  string                  // target used without --target
+	Targets  map[string]DeployTarget // by name
+	Preserve []string                // paths or globs at the destination that deploys never delete
+}
+
+// DefaultDeployPreserve keeps files that are usually added to a deployed
+// site by hand: a GitHub Pages custom domain and well-known URIs.
+var DefaultDeployPreserve = []string{"CNAME", ".well-known"}
+
+// DeployTarget is one deploy destination. Which fields apply depends on
+// Type.
+type DeployTarget struct {
+	Type     string `yaml:"type"`     // github-pages, git, local, rsync, s3 or archive
+	Repo     string `yaml:"repo"`     // github-pages: owner/repo (default: resolved from the project)
+	Remote   string `yaml:"remote"`   // git: remote URL
+	Branch   string `yaml:"branch"`   // git, github-pages: branch to push (default: gh-pages)
+	Path     string `yaml:"path"`     // local: directory; rsync: destination; archive: output file
+	Bucket   string `yaml:"bucket"`   // s3: bucket name, optionally followed by /prefix
+	Endpoint string `yaml:"endpoint"` // s3: endpoint URL of an S3-compatible service
+	Region   string `yaml:"region"`   // s3: bucket region
+	Format   string `yaml:"format"`   // archive: zip or tar.gz (default: from the file extension)
+}
+
+// HistoryConfig is how long the workbench keeps earlier versions of
+// files (see History).
+type HistoryConfig struct {
+	KeepDays    int `yaml:"keep_days"`     // revisions and deleted files older than this are dropped
+	KeepPerFile int `yaml:"keep_per_file"` // at most this many revisions of each file
 }
 
 type ThemeConfig struct {
@@ -74,6 +168,13 @@ type OpenDocConfig struct {
 	Content     ContentConfig
 	Build       BuildConfig
 	Collections map[string]CollectionConfig
+	Taxonomies  map[string]TaxonomyConfig
+	Authors     map[string]AuthorConfig
+	Languages   map[string]LanguageConfig
+	Versions    []VersionConfig
+	Deploy      DeployConfig
+	History     HistoryConfig
+	Watch       WatchConfig
 	Theme       ThemeConfig
 	Nav         []NavItem
 }
@@ -85,11 +186,13 @@ var DefaultSite = SiteConfig{
 	URL:         "https://example.com",
 	Description: "",
 	Author:      "",
+	Language:    "en",
 }
 
 var DefaultContent = ContentConfig{Dir: "content"}
-var DefaultBuild = BuildConfig{OutputDir: "dist"}
+var DefaultBuild = BuildConfig{OutputDir: "dist", PrivateMode: PrivateExclude}
 var DefaultTheme = ThemeConfig{Name: "default"}
+var DefaultHistory = HistoryConfig{KeepDays: 30, KeepPerFile: 50}
 
 var DefaultCollection = CollectionConfig{
 	ItemsPerPage: 10,
@@ -98,6 +201,7 @@ var DefaultCollection = CollectionConfig{
 	Tags:         true,
 	Archive:      true,
 	Layout:       "timeline",
+	Related:      3,
 }
 
 // ── Raw YAML structures ─────────────────────────────────────
@@ -108,10 +212,30 @@ type rawConfig struct {
 	Build       *BuildConfig                  `yaml:"build"`
 	Collections map[string]map[string]any     `yaml:"collections"`
 	Blog        map[string]any                `yaml:"blog"`
+	Taxonomies  map[string]map[string]any     `yaml:"taxonomies"`
+	Authors     map[string]AuthorConfig       `yaml:"authors"`
+	Languages   map[string]rawLanguage        `yaml:"languages"`
+	Versions    []VersionConfig               `yaml:"versions"`
+	Deploy      *rawDeploy                    `yaml:"deploy"`
+	History     *HistoryConfig                `yaml:"history"`
+	Watch       *WatchConfig                  `yaml:"watch"`
 	Theme       *ThemeConfig                  `yaml:"theme"`
 	Nav         []map[string]string           `yaml:"nav"`
 }
 
+type rawLanguage struct {
+	Name       string              `yaml:"name"`
+	ContentDir string              `yaml:"content_dir"`
+	Weight     int                 `yaml:"weight"`
+	Nav        []map[string]string `yaml:"nav"`
+}
+
+type rawDeploy struct {
+	Default  string                  `yaml:"default"`
+	Targets  map[string]DeployTarget `yaml:"targets"`
+	Preserve []string                `yaml:"preserve"`
+}
+
 // ── Loader ──────────────────────────────────────────────────
 
 // LoadConfig reads opendoc.yml from projectDir and returns a validated config.
@@ -134,6 +258,9 @@ func LoadConfig(projectDir string) (*OpenDocConfig, error) {
 		Build:       DefaultBuild,
 		Theme:       DefaultTheme,
 		Collections: make(map[string]CollectionConfig),
+		Taxonomies:  make(map[string]TaxonomyConfig),
+		Authors:     make(map[string]AuthorConfig),
+		Languages:   make(map[string]LanguageConfig),
 	}
 
 	if raw.Site != nil {
@@ -149,22 +276,109 @@ func LoadConfig(projectDir string) (*OpenDocConfig, error) {
 		if raw.Site.Author != "" {
 			cfg.Site.Author = raw.Site.Author
 		}
+		if raw.Site.Language != "" {
+			cfg.Site.Language = raw.Site.Language
+		}
+		if raw.Site.Timezone != "" {
+			if _, err := time.LoadLocation(raw.Site.Timezone); err != nil {
+				return nil, fmt.Errorf("invalid site.timezone '%s': %w", raw.Site.Timezone, err)
+			}
+			cfg.Site.Timezone = raw.Site.Timezone
+		}
+		if raw.Site.CustomDomain != "" {
+			domain := strings.ToLower(strings.TrimSpace(raw.Site.CustomDomain))
+			domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+			domain = strings.TrimSuffix(domain, "/")
+			if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "/: ") {
+				return nil, fmt.Errorf("invalid site.custom_domain '%s': use a bare domain such as docs.example.com", raw.Site.CustomDomain)
+			}
+			cfg.Site.CustomDomain = domain
+		}
 	}
 
 	if raw.Content != nil && raw.Content.Dir != "" {
 		cfg.Content.Dir = raw.Content.Dir
 	}
 
-	if raw.Build != nil && raw.Build.OutputDir != "" {
-		cfg.Build.OutputDir = raw.Build.OutputDir
+	if raw.Build != nil {
+		if raw.Build.OutputDir != "" {
+			cfg.Build.OutputDir = raw.Build.OutputDir
+		}
+		cfg.Build.GitInfo = raw.Build.GitInfo
+		switch raw.Build.PrivateMode {
+		case "", PrivateExclude:
+		case PrivateEncrypt:
+			cfg.Build.PrivateMode = PrivateEncrypt
+		default:
+			return nil, fmt.Errorf("invalid build.private_mode '%s': must be one of %s, %s", raw.Build.PrivateMode, PrivateExclude, PrivateEncrypt)
+		}
+	}
+
+	cfg.History = DefaultHistory
+	if raw.History != nil {
+		if raw.History.KeepDays < 0 || raw.History.KeepPerFile < 0 {
+			return nil, fmt.Errorf("history.keep_days and history.keep_per_file can't be negative")
+		}
+		if raw.History.KeepDays > 0 {
+			cfg.History.KeepDays = raw.History.KeepDays
+		}
+		if raw.History.KeepPerFile > 0 {
+			cfg.History.KeepPerFile = raw.History.KeepPerFile
+		}
+	}
+
+	if raw.Watch != nil {
+		for _, g := range append(append([]string{}, raw.Watch.Include...), raw.Watch.Exclude...) {
+			if _, err := path.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("invalid watch glob '%s': %w", g, err)
+			}
+		}
+		cfg.Watch = *raw.Watch
 	}
 
 	if raw.Theme != nil && raw.Theme.Name != "" {
 		cfg.Theme.Name = raw.Theme.Name
 	}
 
-	// Parse nav items — trailing ? marks a page as private.
-	for _, item := range raw.Nav {
+	cfg.Nav = parseNav(raw.Nav)
+
+	// Parse collections.
+	if err := parseCollections(&raw, cfg); err != nil {
+		return nil, err
+	}
+
+	// Parse taxonomies.
+	if err := parseTaxonomies(&raw, cfg); err != nil {
+		return nil, err
+	}
+
+	// Parse authors.
+	if err := parseAuthors(&raw, cfg, projectDir); err != nil {
+		return nil, err
+	}
+
+	// Parse languages.
+	if err := parseLanguages(&raw, cfg); err != nil {
+		return nil, err
+	}
+
+	// Parse versions.
+	if err := parseVersions(&raw, cfg); err != nil {
+		return nil, err
+	}
+
+	// Parse deploy targets.
+	if err := parseDeploy(&raw, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parseNav converts nav items — a trailing ? marks a page as private.
+func parseNav(items []map[string]string) []NavItem {
+	var nav []NavItem
+	for _, item := range items {
 		for label, rawPath := range item {
 			path := rawPath
 			isPrivate := strings.HasSuffix(path, "?")
@@ -176,20 +390,248 @@ func LoadConfig(projectDir string) (*OpenDocConfig, error) {
 			} else if strings.HasSuffix(path, ".md") {
 				path = strings.TrimSuffix(path, ".md") + "/"
 			}
-			cfg.Nav = append(cfg.Nav, NavItem{
+			nav = append(nav, NavItem{
 				Label:   label,
 				Path:    path,
 				Private: isPrivate,
 			})
 		}
 	}
+	return nav
+}
 
-	// Parse collections.
-	if err := parseCollections(&raw, cfg); err != nil {
-		return nil, err
+// parseLanguages reads the languages map. A site without one has a single
+// language, site.language, built exactly as before.
+func parseLanguages(raw *rawConfig, cfg *OpenDocConfig) error {
+	for code, rl := range raw.Languages {
+		if code == "" || strings.ContainsAny(code, "/. ") {
+			return fmt.Errorf("invalid language code '%s'", code)
+		}
+		if _, ok := cfg.Collections[code]; ok {
+			return fmt.Errorf("language '%s' has the same name as a collection", code)
+		}
+		lang := LanguageConfig{
+			Code:       code,
+			Name:       rl.Name,
+			ContentDir: rl.ContentDir,
+			Weight:     rl.Weight,
+			Nav:        parseNav(rl.Nav),
+		}
+		if lang.Name == "" {
+			lang.Name = code
+		}
+		cfg.Languages[code] = lang
 	}
 
-	return cfg, nil
+	if len(cfg.Languages) > 0 {
+		if _, ok := cfg.Languages[cfg.Site.Language]; !ok {
+			return fmt.Errorf("site.language '%s' is not listed under languages", cfg.Site.Language)
+		}
+	}
+	return nil
+}
+
+// parseVersions reads the versions list. Exactly one version is the
+// latest: the one marked latest: true, or else the first.
+func parseVersions(raw *rawConfig, cfg *OpenDocConfig) error {
+	seen := make(map[string]bool)
+	latest := -1
+	for i, v := range raw.Versions {
+		if v.Name == "" || strings.ContainsAny(v.Name, "/\\ ") || v.Name == "." || v.Name == ".." {
+			return fmt.Errorf("invalid version name '%s'", v.Name)
+		}
+		if v.Name == latestVersion {
+			return fmt.Errorf("version name '%s' is reserved", latestVersion)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate version '%s'", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Latest {
+			if latest >= 0 {
+				return fmt.Errorf("versions '%s' and '%s' are both marked latest", raw.Versions[latest].Name, v.Name)
+			}
+			latest = i
+		}
+		if v.Ref == "" {
+			v.Ref = v.Name
+		}
+		if v.Label == "" {
+			v.Label = v.Name
+		}
+		cfg.Versions = append(cfg.Versions, v)
+	}
+	if latest < 0 && len(cfg.Versions) > 0 {
+		cfg.Versions[0].Latest = true
+	}
+	return nil
+}
+
+// parseDeploy reads the deploy block. Without one, the site has a single
+// github-pages target, matching the behaviour before deploy targets.
+func parseDeploy(raw *rawConfig, cfg *OpenDocConfig) error {
+	cfg.Deploy.Targets = make(map[string]DeployTarget)
+	cfg.Deploy.Preserve = DefaultDeployPreserve
+	if raw.Deploy != nil && raw.Deploy.Preserve != nil {
+		for _, p := range raw.Deploy.Preserve {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("deploy.preserve: invalid pattern '%s'", p)
+			}
+		}
+		cfg.Deploy.Preserve = raw.Deploy.Preserve
+	}
+	if raw.Deploy == nil || len(raw.Deploy.Targets) == 0 {
+		cfg.Deploy.Default = DeployGitHubPages
+		cfg.Deploy.Targets[DeployGitHubPages] = DeployTarget{Type: DeployGitHubPages}
+		return nil
+	}
+
+	for name, t := range raw.Deploy.Targets {
+		var missing string
+		switch t.Type {
+		case DeployGitHubPages:
+		case DeployGit:
+			if t.Remote == "" {
+				missing = "remote"
+			}
+		case DeployLocal, DeployRsync, DeployArchive:
+			if t.Path == "" {
+				missing = "path"
+			}
+		case DeployS3:
+			if t.Bucket == "" {
+				missing = "bucket"
+			}
+		default:
+			return fmt.Errorf("deploy target '%s': unknown type '%s' (use github-pages, git, local, rsync, s3 or archive)", name, t.Type)
+		}
+		if missing != "" {
+			return fmt.Errorf("deploy target '%s': %s is required for type %s", name, missing, t.Type)
+		}
+		if t.Type == DeployArchive && t.Format != "" && t.Format != "zip" && t.Format != "tar.gz" {
+			return fmt.Errorf("deploy target '%s': unknown archive format '%s' (use zip or tar.gz)", name, t.Format)
+		}
+		cfg.Deploy.Targets[name] = t
+	}
+
+	cfg.Deploy.Default = raw.Deploy.Default
+	if cfg.Deploy.Default == "" {
+		if len(cfg.Deploy.Targets) > 1 {
+			return fmt.Errorf("deploy.default must name one of the deploy targets")
+		}
+		for name := range cfg.Deploy.Targets {
+			cfg.Deploy.Default = name
+		}
+	}
+	if _, ok := cfg.Deploy.Targets[cfg.Deploy.Default]; !ok {
+		return fmt.Errorf("deploy.default '%s' is not a deploy target", cfg.Deploy.Default)
+	}
+	return nil
+}
+
+// Location returns the time zone that entry dates are read and shown in.
+func (c *OpenDocConfig) Location() *time.Location {
+	if c.Site.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.Site.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LanguageCodes returns the site's languages: the default language first,
+// then the others by weight and code.
+func (c *OpenDocConfig) LanguageCodes() []string {
+	codes := []string{c.Site.Language}
+	var others []string
+	for code := range c.Languages {
+		if code != c.Site.Language {
+			others = append(others, code)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		wi, wj := c.Languages[others[i]].Weight, c.Languages[others[j]].Weight
+		if wi != wj {
+			return wi < wj
+		}
+		return others[i] < others[j]
+	})
+	return append(codes, others...)
+}
+
+// Language returns the settings of a language, with defaults filled in for
+// sites that declare no languages map.
+func (c *OpenDocConfig) Language(code string) LanguageConfig {
+	if lang, ok := c.Languages[code]; ok {
+		return lang
+	}
+	return LanguageConfig{Code: code, Name: code}
+}
+
+// authorsDataFile holds author profiles outside opendoc.yml.
+const authorsDataFile = "data/authors.yml"
+
+// parseAuthors merges data/authors.yml with the authors map of opendoc.yml.
+// Entries in opendoc.yml win over the data file.
+func parseAuthors(raw *rawConfig, cfg *OpenDocConfig, projectDir string) error {
+	if data, err := os.ReadFile(filepath.Join(projectDir, filepath.FromSlash(authorsDataFile))); err == nil {
+		var fromFile map[string]AuthorConfig
+		if err := yaml.Unmarshal(data, &fromFile); err != nil {
+			return fmt.Errorf("invalid %s: %w", authorsDataFile, err)
+		}
+		for id, author := range fromFile {
+			cfg.Authors[id] = author
+		}
+	}
+	for id, author := range raw.Authors {
+		cfg.Authors[id] = author
+	}
+
+	for id, author := range cfg.Authors {
+		if author.Name == "" {
+			author.Name = id
+			cfg.Authors[id] = author
+		}
+	}
+	return nil
+}
+
+func parseTaxonomies(raw *rawConfig, cfg *OpenDocConfig) error {
+	for name, settings := range raw.Taxonomies {
+		tax := TaxonomyConfig{
+			Label: titleCase(strings.ReplaceAll(strings.ReplaceAll(name, "-", " "), "_", " ")),
+			Scope: "site",
+		}
+
+		if v, ok := settings["label"]; ok {
+			if s, ok := v.(string); ok {
+				tax.Label = s
+			}
+		}
+		if v, ok := settings["scope"]; ok {
+			if s, ok := v.(string); ok {
+				tax.Scope = s
+			}
+		}
+		if v, ok := settings["ordered"]; ok {
+			if b, ok := v.(bool); ok {
+				tax.Ordered = b
+			}
+		}
+
+		if !isValidTaxonomyScope(tax.Scope) {
+			return fmt.Errorf("invalid scope '%s' for taxonomy '%s'. Must be one of: %s",
+				tax.Scope, name, strings.Join(ValidTaxonomyScopes, ", "))
+		}
+		if _, ok := cfg.Collections[name]; ok && tax.Scope == "site" {
+			return fmt.Errorf("taxonomy '%s' has the same name as a collection; use scope: collection or rename it", name)
+		}
+
+		cfg.Taxonomies[name] = tax
+	}
+	return nil
 }
 
 func parseCollections(raw *rawConfig, cfg *OpenDocConfig) error {
@@ -227,6 +669,11 @@ func parseCollections(raw *rawConfig, cfg *OpenDocConfig) error {
 					coll.Layout = s
 				}
 			}
+			if v, ok := settings["related"]; ok {
+				if n, ok := toInt(v); ok && n >= 0 {
+					coll.Related = n
+				}
+			}
 
 			if !isValidLayout(coll.Layout) {
 				return fmt.Errorf("invalid layout '%s' for collection '%s'. Must be one of: %s",
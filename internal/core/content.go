@@ -1,8 +1,10 @@
 package core
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -18,7 +20,11 @@ type Page struct {
 	Slug            string
 	SourcePath      string
 	ContentMarkdown string
+	BodyLine        int // 1-based line in SourcePath where the markdown body starts
 	Meta            map[string]any
+	Private         bool         // like a ? nav item: left out of (or encrypted in) publish builds
+	Visibility      []string     // access groups allowed to see the page; empty = everyone
+	History         *FileHistory // set by the builder when build.git_info is on
 }
 
 // Entry represents a collection entry (blog post, guide article, etc.).
@@ -31,7 +37,47 @@ type Entry struct {
 	Tags            []string
 	Description     string
 	Draft           bool
+	Private         bool       // left out of (or encrypted in) publish builds
+	Visibility      []string   // access groups allowed to see the entry; empty = everyone
+	PublishDate     *time.Time // hidden from builds before this time
+	ExpiryDate      *time.Time // hidden from builds from this time on
+	BodyLine        int        // 1-based line in SourcePath where the markdown body starts
 	Meta            map[string]any
+	Warnings        []string // problems found in the frontmatter, reported by the build
+
+	// Set by the builder once the entry is placed in a collection.
+	Collection string
+	URL        string
+	Authors    []Author
+	History    *FileHistory // only when build.git_info is on
+	Sealed     bool         // published encrypted: listed by title and URL only
+}
+
+// LanguageFiles selects the markdown files of one language in a content
+// directory. Translations are named name.<code>.md; the zero value accepts
+// every file and keeps any suffix in the slug.
+type LanguageFiles struct {
+	Code       string   // accept name.<Code>.md as name
+	SuffixOnly bool     // reject files without a language suffix
+	Others     []string // codes of the other languages, whose files are skipped
+}
+
+// Stem returns the slug stem of a markdown file name and whether the file
+// belongs to the language.
+func (lf LanguageFiles) Stem(filename string) (string, bool) {
+	stem := strings.TrimSuffix(filename, ".md")
+	if ext := filepath.Ext(stem); ext != "" {
+		code := ext[1:]
+		if lf.Code != "" && code == lf.Code {
+			return strings.TrimSuffix(stem, ext), true
+		}
+		for _, other := range lf.Others {
+			if code == other {
+				return "", false
+			}
+		}
+	}
+	return stem, !lf.SuffixOnly
 }
 
 // ── Frontmatter parsing ─────────────────────────────────────
@@ -55,14 +101,65 @@ func ParseFrontmatter(text string) (meta map[string]any, body string) {
 	yamlBlock := rest[:idx]
 	body = strings.TrimSpace(rest[idx+4:])
 
-	_ = yaml.Unmarshal([]byte(yamlBlock), &meta)
+	var doc yaml.Node
+	if yaml.Unmarshal([]byte(yamlBlock), &doc) == nil && len(doc.Content) > 0 {
+		_ = doc.Content[0].Decode(&meta)
+		markFloatingTimes(doc.Content[0], meta)
+	}
 	return meta, body
 }
 
+// floatingZone marks frontmatter timestamps written without a zone, which
+// YAML decodes as UTC like those ending in Z, so that parseDate can read
+// them in the site's time zone.
+var floatingZone = time.FixedZone("UTC", 0)
+
+// timestampZoneRe matches the zone at the end of a YAML timestamp's time.
+var timestampZoneRe = regexp.MustCompile(`(?i)(z|[+-]\d{1,2}(:?\d{2})?)$`)
+
+// markFloatingTimes moves the top-level timestamps of mapping that have no
+// zone in their source text into floatingZone.
+func markFloatingTimes(mapping *yaml.Node, meta map[string]any) {
+	if mapping.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.ShortTag() != "!!timestamp" {
+			continue
+		}
+		text := strings.TrimSpace(value.Value)
+		if len(text) > 10 && timestampZoneRe.MatchString(text[10:]) {
+			continue
+		}
+		if t, ok := meta[key.Value].(time.Time); ok {
+			meta[key.Value] = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), floatingZone)
+		}
+	}
+}
+
+// bodyStartLine returns the 1-based line of text on which body begins.
+func bodyStartLine(text, body string) int {
+	if body == "" {
+		return 1
+	}
+	idx := strings.Index(text, body)
+	if idx < 0 {
+		return 1
+	}
+	return strings.Count(text[:idx], "\n") + 1
+}
+
 // ── Page discovery ──────────────────────────────────────────
 
 // DiscoverPages finds all top-level .md files in contentDir.
 func DiscoverPages(contentDir string) []Page {
+	return DiscoverPagesLang(contentDir, LanguageFiles{})
+}
+
+// DiscoverPagesLang finds the top-level .md files in contentDir that belong
+// to one language.
+func DiscoverPagesLang(contentDir string, lang LanguageFiles) []Page {
 	entries, err := os.ReadDir(contentDir)
 	if err != nil {
 		return nil
@@ -76,6 +173,10 @@ func DiscoverPages(contentDir string) []Page {
 		if filepath.Ext(entry.Name()) != ".md" {
 			continue
 		}
+		stem, ok := lang.Stem(entry.Name())
+		if !ok {
+			continue
+		}
 
 		filePath := filepath.Join(contentDir, entry.Name())
 		data, err := os.ReadFile(filePath)
@@ -85,7 +186,6 @@ func DiscoverPages(contentDir string) []Page {
 
 		meta, body := ParseFrontmatter(string(data))
 
-		stem := strings.TrimSuffix(entry.Name(), ".md")
 		title := stem
 		if t, ok := meta["title"].(string); ok && t != "" {
 			title = t
@@ -98,12 +198,16 @@ func DiscoverPages(contentDir string) []Page {
 			slug = ""
 		}
 
+		private, visibility := accessMeta(meta)
 		pages = append(pages, Page{
 			Title:           title,
 			Slug:            slug,
 			SourcePath:      filePath,
 			ContentMarkdown: body,
+			BodyLine:        bodyStartLine(string(data), body),
 			Meta:            meta,
+			Private:         private,
+			Visibility:      visibility,
 		})
 	}
 
@@ -117,6 +221,12 @@ func DiscoverPages(contentDir string) []Page {
 
 // DiscoverEntries finds collection entries in entriesDir with sorting.
 func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []Entry {
+	return DiscoverEntriesLang(entriesDir, sortOrder, requireDate, LanguageFiles{}, time.UTC)
+}
+
+// DiscoverEntriesLang finds the collection entries in entriesDir that
+// belong to one language. Dates without a UTC offset are read in loc.
+func DiscoverEntriesLang(entriesDir string, sortOrder string, requireDate bool, lang LanguageFiles, loc *time.Location) []Entry {
 	dirEntries, err := os.ReadDir(entriesDir)
 	if err != nil {
 		return nil
@@ -130,6 +240,10 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 		if filepath.Ext(de.Name()) != ".md" {
 			continue
 		}
+		stem, ok := lang.Stem(de.Name())
+		if !ok {
+			continue
+		}
 
 		filePath := filepath.Join(entriesDir, de.Name())
 		data, err := os.ReadFile(filePath)
@@ -139,7 +253,6 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 
 		meta, body := ParseFrontmatter(string(data))
 
-		stem := strings.TrimSuffix(de.Name(), ".md")
 		title := stem
 		if t, ok := meta["title"].(string); ok && t != "" {
 			title = t
@@ -147,39 +260,24 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 			title = titleCase(strings.ReplaceAll(stem, "-", " "))
 		}
 
-		var entryDate *time.Time
-		if d := meta["date"]; d != nil {
-			if t, ok := d.(time.Time); ok {
-				entryDate = &t
-			} else if s, ok := d.(string); ok {
-				if t, err := time.Parse("2006-01-02", s); err == nil {
-					entryDate = &t
-				} else if t, err := time.Parse(time.RFC3339, s); err == nil {
-					entryDate = &t
-				}
+		var warnings []string
+		dateField := func(key string) *time.Time {
+			t, err := parseDate(meta[key], loc)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %s: %v", de.Name(), key, err))
 			}
+			return t
 		}
-		if entryDate == nil && requireDate {
-			now := time.Now()
+
+		entryDate := dateField("date")
+		if entryDate == nil && requireDate && meta["date"] == nil {
+			now := time.Now().In(loc)
 			entryDate = &now
 		}
+		publishDate := dateField("publish_date")
+		expiryDate := dateField("expiry_date")
 
-		var tags []string
-		switch v := meta["tags"].(type) {
-		case []any:
-			for _, t := range v {
-				if s, ok := t.(string); ok {
-					tags = append(tags, s)
-				}
-			}
-		case string:
-			for _, t := range strings.Split(v, ",") {
-				t = strings.TrimSpace(t)
-				if t != "" {
-					tags = append(tags, t)
-				}
-			}
-		}
+		tags := stringList(meta["tags"])
 
 		desc := ""
 		if s, ok := meta["description"].(string); ok {
@@ -190,6 +288,7 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 		if b, ok := meta["draft"].(bool); ok {
 			draft = b
 		}
+		private, visibility := accessMeta(meta)
 
 		items = append(items, Entry{
 			Title:           title,
@@ -200,11 +299,23 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 			Tags:            tags,
 			Description:     desc,
 			Draft:           draft,
+			Private:         private,
+			Visibility:      visibility,
+			PublishDate:     publishDate,
+			ExpiryDate:      expiryDate,
+			BodyLine:        bodyStartLine(string(data), body),
 			Meta:            meta,
+			Warnings:        warnings,
 		})
 	}
 
-	// Sort.
+	sortEntries(items, sortOrder)
+	return items
+}
+
+// sortEntries orders entries by a collection's sort setting: newest_first
+// (the default), oldest_first or alphabetical.
+func sortEntries(items []Entry, sortOrder string) {
 	switch sortOrder {
 	case "alphabetical":
 		sort.Slice(items, func(i, j int) bool {
@@ -223,12 +334,128 @@ func DiscoverEntries(entriesDir string, sortOrder string, requireDate bool) []En
 			return ti.After(tj)
 		})
 	}
+}
 
-	return items
+// ── Scheduling ──────────────────────────────────────────────
+
+// IsScheduled reports whether the entry is not yet published at now: its
+// publish_date (or, failing that, its frontmatter date) lies in the future.
+// A date filled in for an undated entry never schedules it.
+func (e Entry) IsScheduled(now time.Time) bool {
+	publish := e.PublishDate
+	if publish == nil && e.Meta["date"] != nil {
+		publish = e.Date
+	}
+	return publish != nil && publish.After(now)
+}
+
+// IsExpired reports whether the entry's expiry_date has passed at now.
+func (e Entry) IsExpired(now time.Time) bool {
+	return e.ExpiryDate != nil && !e.ExpiryDate.After(now)
+}
+
+// ── Access ──────────────────────────────────────────────────
+
+// accessMeta reads the private and visibility frontmatter keys.
+// visibility is a list of access groups, or a comma-separated string.
+func accessMeta(meta map[string]any) (private bool, visibility []string) {
+	private, _ = meta["private"].(bool)
+	for _, group := range stringList(meta["visibility"]) {
+		visibility = append(visibility, strings.ToLower(group))
+	}
+	return private, visibility
+}
+
+// visibleTo reports whether content restricted to groups is part of a
+// build for audience. Content without groups is visible to everyone.
+func visibleTo(groups, audience []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, a := range audience {
+			if strings.EqualFold(group, a) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // ── Helpers ─────────────────────────────────────────────────
 
+// dateLayouts are the frontmatter date formats accepted besides YAML
+// timestamps. Layouts without a zone are read in the site's time zone.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// parseDate reads a frontmatter date in loc. It returns nil without an
+// error for missing values, and an error for values it cannot read.
+func parseDate(v any, loc *time.Location) (*time.Time, error) {
+	switch d := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		// Timestamps written without a zone (including plain dates) are
+		// read as wall-clock time in the site's zone; explicit offsets,
+		// Z included, are kept.
+		if d.Location() == floatingZone {
+			d = time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), d.Minute(), d.Second(), d.Nanosecond(), loc)
+		}
+		return &d, nil
+	case string:
+		s := strings.TrimSpace(d)
+		if s == "" {
+			return nil, nil
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return &t, nil
+			}
+		}
+		return nil, fmt.Errorf("unrecognised date %q", s)
+	}
+	return nil, fmt.Errorf("unrecognised date %v", v)
+}
+
+// stringList reads a frontmatter value that may be a YAML list or a
+// comma-separated string.
+func stringList(v any) []string {
+	var list []string
+	switch v := v.(type) {
+	case []any:
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				list = append(list, s)
+			}
+		}
+	case string:
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t != "" {
+				list = append(list, t)
+			}
+		}
+	}
+	return list
+}
+
 func timeOrZero(t *time.Time) time.Time {
 	if t == nil {
 		return time.Time{}
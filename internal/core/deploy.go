@@ -0,0 +1,725 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Deploy target types, as written in the deploy block of opendoc.yml.
+const (
+	DeployGitHubPages = "github-pages"
+	DeployGit         = "git"
+	DeployLocal       = "local"
+	DeployRsync       = "rsync"
+	DeployS3          = "s3"
+	DeployArchive     = "archive"
+)
+
+// Deployer sends a built site to a deploy target.
+type Deployer interface {
+	// Describe names the destination for messages, e.g. "s3://docs-bucket".
+	Describe() string
+	// Check verifies the tools and settings the deploy needs. Publish calls
+	// it before building so a misconfigured target fails fast.
+	Check() error
+	// Deploy publishes the contents of siteDir, never deleting the
+	// destination's preserved files.
+	Deploy(siteDir string, opts DeployOptions) (*DeployReport, error)
+}
+
+// deployedReader is implemented by deployers that can read back the site
+// currently at the destination, so a deploy can be previewed against it.
+type deployedReader interface {
+	// deployedManifest returns the manifest of the deployed site, or nil
+	// if nothing has been deployed yet.
+	deployedManifest() (*DeployManifest, error)
+}
+
+// DeployOptions controls a single deploy.
+type DeployOptions struct {
+	DryRun  bool   // report what would change without touching the destination
+	Message string // commit message for git targets
+}
+
+// DeployReport describes what a deploy changed, or would change in a dry
+// run.
+type DeployReport struct {
+	Changes []FileChange
+	Commit  string // commit pushed by git targets; empty if nothing changed
+}
+
+// FileChange is a file added, modified or deleted at the destination.
+type FileChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // added, modified or deleted
+}
+
+// NewDeployer returns the deployer for the named target in config (the
+// default target when name is empty). repo overrides the repository of a
+// github-pages target.
+func NewDeployer(config *OpenDocConfig, projectDir, name, repo string) (Deployer, error) {
+	if name == "" {
+		name = config.Deploy.Default
+	}
+	target, ok := config.Deploy.Targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown deploy target '%s' (configured: %s)", name, strings.Join(sortedKeys(config.Deploy.Targets), ", "))
+	}
+
+	branch := target.Branch
+	if branch == "" {
+		branch = "gh-pages"
+	}
+	path := target.Path
+	if path != "" && target.Type != DeployRsync && !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	preserve := config.Deploy.Preserve
+
+	switch target.Type {
+	case DeployGitHubPages:
+		if repo == "" {
+			repo = target.Repo
+		}
+		if repo == "" {
+			repo = resolveRepo(projectDir)
+		}
+		if repo == "" {
+			return nil, fmt.Errorf("no GitHub repository configured\n\nSet it with one of:\n  opendoc publish --repo owner/repo\n  deploy.targets.<name>.repo in opendoc.yml\n  opendoc config set github.default_account <account>\n  Edit settings.json in your project with github_repo")
+		}
+		return &gitDeployer{
+			remote:   fmt.Sprintf("https://github.com/%s.git", repo),
+			branch:   branch,
+			repo:     repo,
+			noJekyll: true,
+			preserve: preserve,
+		}, nil
+	case DeployGit:
+		return &gitDeployer{remote: target.Remote, branch: branch, preserve: preserve}, nil
+	case DeployLocal:
+		return &localDeployer{dir: path, projectDir: projectDir, outputDir: filepath.Join(projectDir, config.Build.OutputDir), preserve: preserve}, nil
+	case DeployRsync:
+		return &rsyncDeployer{dest: path, preserve: preserve}, nil
+	case DeployS3:
+		return &s3Deployer{bucket: target.Bucket, endpoint: target.Endpoint, region: target.Region, preserve: preserve}, nil
+	case DeployArchive:
+		format := target.Format
+		if format == "" {
+			format = "zip"
+			if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+				format = "tar.gz"
+			}
+		}
+		return &archiveDeployer{path: path, format: format}, nil
+	}
+	return nil, fmt.Errorf("deploy target '%s': unknown type '%s'", name, target.Type)
+}
+
+// ── Git ─────────────────────────────────────────────────────
+
+// gitDeployer commits the site to a branch of a git remote. With a repo
+// set, the remote is GitHub and the push goes through the gh CLI's
+// credentials.
+type gitDeployer struct {
+	remote   string
+	branch   string
+	repo     string // owner/repo for GitHub Pages, empty otherwise
+	noJekyll bool   // add .nojekyll so GitHub serves files as-is
+	preserve []string
+}
+
+func (d *gitDeployer) Describe() string {
+	if d.repo != "" {
+		return d.repo + " (" + d.branch + ")"
+	}
+	return d.remote + " (" + d.branch + ")"
+}
+
+func (d *gitDeployer) Check() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git not found on PATH")
+	}
+	if d.repo == "" {
+		return nil
+	}
+	if err := checkGH(); err != nil {
+		return err
+	}
+	return checkGHAuth()
+}
+
+// Deploy checks out the tip of the branch, replaces its files with the
+// site (keeping preserved ones) and pushes one commit with the
+// difference. The branch's history is kept; a branch that doesn't exist
+// yet is created.
+func (d *gitDeployer) Deploy(siteDir string, opts DeployOptions) (*DeployReport, error) {
+	// Use a temporary directory for the git operations
+	tmpDir, err := os.MkdirTemp("", "opendoc-deploy-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	git := gitIn(tmpDir)
+	exists, err := d.checkout(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if out, err := git("checkout", "-q", "--orphan", d.branch); err != nil {
+			return nil, fmt.Errorf("git checkout: %s", out)
+		}
+	}
+
+	// Replace the branch's files with the site.
+	if err := removeUnpreserved(tmpDir, d.preserve); err != nil {
+		return nil, err
+	}
+	if err := copyTree(siteDir, tmpDir); err != nil {
+		return nil, fmt.Errorf("copy files: %w", err)
+	}
+	if d.noJekyll {
+		if err := os.WriteFile(filepath.Join(tmpDir, ".nojekyll"), []byte(""), 0o644); err != nil {
+			return nil, fmt.Errorf("write .nojekyll: %w", err)
+		}
+	}
+
+	if out, err := git("add", "-A"); err != nil {
+		return nil, fmt.Errorf("git add: %s", out)
+	}
+	diff, err := git("diff", "--cached", "--name-status", "--no-renames", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %s", diff)
+	}
+	report := &DeployReport{Changes: parseNameStatus(diff)}
+	if len(report.Changes) == 0 || opts.DryRun {
+		return report, nil
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = "Deploy via OpenDoc"
+	}
+	if out, err := git("commit", "-q", "-m", message); err != nil {
+		return nil, fmt.Errorf("git commit: %s", out)
+	}
+	report.Commit, _ = git("rev-parse", "--short", "HEAD")
+
+	pushOut, err := git("push", "-q", d.remote, "HEAD:"+d.branch)
+	if err != nil {
+		if strings.Contains(pushOut, "rejected") {
+			return nil, fmt.Errorf("git push rejected: the %s branch changed during the deploy; publish again\n\n%s", d.branch, pushOut)
+		}
+		return nil, d.remoteError("git push", pushOut)
+	}
+	return report, nil
+}
+
+// deployedManifest reads the tip of the branch.
+func (d *gitDeployer) deployedManifest() (*DeployManifest, error) {
+	tmpDir, err := os.MkdirTemp("", "opendoc-deployed-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	exists, err := d.checkout(tmpDir)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return BuildManifest(tmpDir)
+}
+
+// checkout initialises a repository in dir and checks out the tip of the
+// branch. It returns false, leaving the repository empty, if the branch
+// doesn't exist on the remote yet.
+func (d *gitDeployer) checkout(dir string) (bool, error) {
+	git := gitIn(dir)
+	if out, err := git("init", "-q"); err != nil {
+		return false, fmt.Errorf("git init: %s", out)
+	}
+
+	// Configure git user for the commit
+	git("config", "user.email", "opendoc@deploy")
+	git("config", "user.name", "OpenDoc Deploy")
+
+	heads, err := git("ls-remote", "--heads", d.remote, d.branch)
+	if err != nil {
+		return false, d.remoteError("git ls-remote", heads)
+	}
+	if heads == "" {
+		return false, nil
+	}
+	if out, err := git("fetch", "-q", "--depth", "1", d.remote, d.branch); err != nil {
+		return false, d.remoteError("git fetch", out)
+	}
+	if out, err := git("checkout", "-q", "-B", d.branch, "FETCH_HEAD"); err != nil {
+		return false, fmt.Errorf("git checkout: %s", out)
+	}
+	return true, nil
+}
+
+// remoteError explains a failed git command against the remote.
+func (d *gitDeployer) remoteError(step, out string) error {
+	if d.repo != "" {
+		return fmt.Errorf("%s failed: %s\n\nMake sure:\n  1. The repository %s exists\n  2. You have push access\n  3. Enable GitHub Pages (source: %s branch) at:\n     https://github.com/%s/settings/pages", step, out, d.repo, d.branch, d.repo)
+	}
+	return fmt.Errorf("%s failed: %s", step, out)
+}
+
+// parseNameStatus reads `git diff --name-status -z` output.
+func parseNameStatus(out string) []FileChange {
+	var changes []FileChange
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := "modified"
+		switch fields[i] {
+		case "A":
+			status = "added"
+		case "D":
+			status = "deleted"
+		}
+		changes = append(changes, FileChange{Path: fields[i+1], Status: status})
+	}
+	return changes
+}
+
+// ── Local directory ─────────────────────────────────────────
+
+// localDeployer mirrors the site into a directory: files are copied over
+// and files the site no longer has are removed, unless preserved.
+type localDeployer struct {
+	dir        string
+	projectDir string
+	outputDir  string // the project's build output, the one place inside it allowed
+	preserve   []string
+}
+
+func (d *localDeployer) Describe() string { return d.dir }
+
+func (d *localDeployer) Check() error {
+	// Mirroring deletes stale files, so never point it at the project's
+	// sources: not the project itself, a directory containing it, or one
+	// inside it other than the build output.
+	dir, project, output := resolvedPath(d.dir), resolvedPath(d.projectDir), resolvedPath(d.outputDir)
+	if pathInside(project, dir) {
+		return fmt.Errorf("deploy path %s contains the project; choose a directory outside it", d.dir)
+	}
+	if pathInside(dir, project) && !pathInside(dir, output) {
+		return fmt.Errorf("deploy path %s is inside the project; choose a directory outside it, or the build output", d.dir)
+	}
+	return nil
+}
+
+// resolvedPath makes path absolute and resolves symlinks in as much of it
+// as exists.
+func resolvedPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest)
+		}
+		if filepath.Dir(dir) == dir {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// pathInside reports whether path is dir or inside it.
+func pathInside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (d *localDeployer) Deploy(siteDir string, opts DeployOptions) (*DeployReport, error) {
+	report := &DeployReport{}
+	err := walkFiles(siteDir, func(rel string, info os.FileInfo) error {
+		dest, err := os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(rel)))
+		if err != nil {
+			report.Changes = append(report.Changes, FileChange{Path: rel, Status: "added"})
+			return nil
+		}
+		src, err := os.ReadFile(filepath.Join(siteDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(src, dest) {
+			report.Changes = append(report.Changes, FileChange{Path: rel, Status: "modified"})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(d.dir); err == nil {
+		walkFiles(d.dir, func(rel string, info os.FileInfo) error {
+			if isPreserved(rel, d.preserve) {
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(siteDir, filepath.FromSlash(rel))); os.IsNotExist(err) {
+				report.Changes = append(report.Changes, FileChange{Path: rel, Status: "deleted"})
+			}
+			return nil
+		})
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := copyTree(siteDir, d.dir); err != nil {
+		return nil, fmt.Errorf("copy files: %w", err)
+	}
+	for _, c := range report.Changes {
+		if c.Status == "deleted" {
+			if err := os.Remove(filepath.Join(d.dir, filepath.FromSlash(c.Path))); err != nil {
+				return nil, err
+			}
+			removeEmptyDirs(d.dir, path.Dir(c.Path))
+		}
+	}
+	return report, nil
+}
+
+// removeEmptyDirs removes rel, a directory under root, and then each of
+// its parents below root, for as long as they are empty.
+func removeEmptyDirs(root, rel string) {
+	for ; rel != "." && rel != "/"; rel = path.Dir(rel) {
+		if os.Remove(filepath.Join(root, filepath.FromSlash(rel))) != nil {
+			return // not empty, or already gone
+		}
+	}
+}
+
+// deployedManifest reads the directory the site is mirrored into.
+func (d *localDeployer) deployedManifest() (*DeployManifest, error) {
+	if _, err := os.Stat(d.dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return BuildManifest(d.dir)
+}
+
+// ── rsync ───────────────────────────────────────────────────
+
+// rsyncDeployer syncs the site to a local or remote (user@host:path)
+// destination with rsync --delete. Preserved paths are protected from
+// deletion with rsync filter rules.
+type rsyncDeployer struct {
+	dest     string
+	preserve []string
+}
+
+func (d *rsyncDeployer) Describe() string { return d.dest }
+
+func (d *rsyncDeployer) Check() error {
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return fmt.Errorf("rsync not found on PATH")
+	}
+	return nil
+}
+
+func (d *rsyncDeployer) Deploy(siteDir string, opts DeployOptions) (*DeployReport, error) {
+	dest := d.dest
+	if !strings.HasSuffix(dest, "/") {
+		dest += "/"
+	}
+	args := []string{"-az", "--delete", "--itemize-changes"}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	for _, p := range d.preserve {
+		args = append(args, "--filter=P /"+p)
+	}
+	args = append(args, siteDir+string(filepath.Separator), dest)
+	out, err := exec.Command("rsync", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("rsync failed: %s", strings.TrimSpace(string(out)))
+	}
+	return &DeployReport{Changes: parseItemizedChanges(string(out))}, nil
+}
+
+// parseItemizedChanges reads the file changes from rsync --itemize-changes
+// output, e.g. ">f+++++++++ about/index.html" or "*deleting   old.html".
+func parseItemizedChanges(out string) []FileChange {
+	var changes []FileChange
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "*deleting "):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "*deleting "))
+			if !strings.HasSuffix(path, "/") {
+				changes = append(changes, FileChange{Path: path, Status: "deleted"})
+			}
+		case len(line) > 12 && (line[0] == '>' || line[0] == 'c') && line[1] == 'f':
+			status := "modified"
+			if strings.HasPrefix(line[2:11], "+++++++++") {
+				status = "added"
+			}
+			changes = append(changes, FileChange{Path: line[12:], Status: status})
+		}
+	}
+	return changes
+}
+
+// ── S3 ──────────────────────────────────────────────────────
+
+// s3Deployer syncs the site to an S3 (or S3-compatible) bucket with the
+// AWS CLI, which supplies the credentials. Preserved paths are excluded
+// from the sync, which also keeps them from being deleted.
+type s3Deployer struct {
+	bucket   string
+	endpoint string
+	region   string
+	preserve []string
+}
+
+func (d *s3Deployer) Describe() string { return "s3://" + d.bucket }
+
+func (d *s3Deployer) Check() error {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return fmt.Errorf("aws CLI not found\n\nInstall it from: https://aws.amazon.com/cli/")
+	}
+	return nil
+}
+
+func (d *s3Deployer) Deploy(siteDir string, opts DeployOptions) (*DeployReport, error) {
+	args := []string{"s3", "sync", siteDir, "s3://" + d.bucket, "--delete", "--no-progress"}
+	if opts.DryRun {
+		args = append(args, "--dryrun")
+	}
+	for _, p := range d.preserve {
+		args = append(args, "--exclude", p, "--exclude", p+"/*")
+	}
+	if d.endpoint != "" {
+		args = append(args, "--endpoint-url", d.endpoint)
+	}
+	if d.region != "" {
+		args = append(args, "--region", d.region)
+	}
+	out, err := exec.Command("aws", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("aws s3 sync failed: %s", strings.TrimSpace(string(out)))
+	}
+	return &DeployReport{Changes: d.parseSyncOutput(string(out))}, nil
+}
+
+// parseSyncOutput reads the file changes from `aws s3 sync` output. S3
+// doesn't say whether an upload replaces an object, so every upload is
+// reported as modified.
+func (d *s3Deployer) parseSyncOutput(out string) []FileChange {
+	prefix := "s3://" + strings.TrimSuffix(d.bucket, "/") + "/"
+	var changes []FileChange
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "(dryrun) ")
+		switch {
+		case strings.HasPrefix(line, "upload: "):
+			if i := strings.LastIndex(line, " to "+prefix); i >= 0 {
+				changes = append(changes, FileChange{Path: line[i+len(" to "+prefix):], Status: "modified"})
+			}
+		case strings.HasPrefix(line, "delete: "+prefix):
+			changes = append(changes, FileChange{Path: strings.TrimPrefix(line, "delete: "+prefix), Status: "deleted"})
+		}
+	}
+	return changes
+}
+
+// ── Archive ─────────────────────────────────────────────────
+
+// archiveDeployer packs the site into a zip or tar.gz file.
+type archiveDeployer struct {
+	path   string
+	format string // zip or tar.gz
+}
+
+func (d *archiveDeployer) Describe() string { return d.path }
+
+func (d *archiveDeployer) Check() error { return nil }
+
+// Deploy writes the archive. The archive is rewritten as a whole, so the
+// report lists every file as added.
+func (d *archiveDeployer) Deploy(siteDir string, opts DeployOptions) (*DeployReport, error) {
+	report := &DeployReport{}
+	walkFiles(siteDir, func(rel string, info os.FileInfo) error {
+		report.Changes = append(report.Changes, FileChange{Path: rel, Status: "added"})
+		return nil
+	})
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+		return nil, err
+	}
+	// Write to a temporary file first so a failed deploy leaves any
+	// previous archive intact.
+	tmp := d.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if d.format == "tar.gz" {
+		err = writeTarGz(f, siteDir)
+	} else {
+		err = writeZip(f, siteDir)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func writeZip(w io.Writer, siteDir string) error {
+	zw := zip.NewWriter(w)
+	err := walkFiles(siteDir, func(rel string, info os.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(fw, filepath.Join(siteDir, filepath.FromSlash(rel)))
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, siteDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := walkFiles(siteDir, func(rel string, info os.FileInfo) error {
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		return copyFileTo(tw, filepath.Join(siteDir, filepath.FromSlash(rel)))
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ── Helpers ─────────────────────────────────────────────────
+
+// gitIn returns a helper running git in dir, returning its trimmed
+// combined output.
+func gitIn(dir string) func(args ...string) (string, error) {
+	return func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		return strings.TrimSpace(string(out)), err
+	}
+}
+
+// walkFiles calls fn for every regular file under dir, with its
+// slash-separated path relative to dir.
+func walkFiles(dir string, fn func(rel string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+// isPreserved reports whether a slash-separated path relative to the
+// destination root matches a preserve entry: the entry itself, a file
+// inside it, or a glob match.
+func isPreserved(rel string, preserve []string) bool {
+	for _, p := range preserve {
+		p = strings.Trim(p, "/")
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUnpreserved deletes every file under dir except preserved ones
+// and the .git directory.
+func removeUnpreserved(dir string, preserve []string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || isPreserved(rel, preserve) {
+			return nil
+		}
+		return os.Remove(p)
+	})
+}
+
+// copyTree copies every file under src into dst, creating directories as
+// needed and overwriting existing files.
+func copyTree(src, dst string) error {
+	return walkFiles(src, func(rel string, info os.FileInfo) error {
+		destPath := filepath.Join(dst, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(destPath), 0o755)
+		data, err := os.ReadFile(filepath.Join(src, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(destPath, data, 0o644)
+	})
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// deployManifestDir holds one manifest per deploy target, recording what
+// was last deployed there.
+const deployManifestDir = ".opendoc/deploy"
+
+// DeployManifest describes a deployed site: a hash of every file, and the
+// title and text of every page so later deploys can show what changed.
+type DeployManifest struct {
+	Target      string                  `json:"target"`
+	Destination string                  `json:"destination"`
+	Deployed    time.Time               `json:"deployed"`
+	Commit      string                  `json:"commit,omitempty"`
+	Files       map[string]ManifestFile `json:"files"`
+}
+
+// ManifestFile is one file of a deployed site. Title and Text are only
+// set for HTML pages.
+type ManifestFile struct {
+	Hash  string `json:"hash"`
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// DeployDiff is what a deploy will change, compared with the site that is
+// live now.
+type DeployDiff struct {
+	// Baseline is what the new site was compared with: "deployed" (read
+	// from the destination), "manifest" (recorded by the last deploy from
+	// this project) or "none" when nothing is known about the destination.
+	Baseline string     `json:"baseline"`
+	Since    time.Time  `json:"since,omitempty"` // time of the last recorded deploy
+	Pages    []PageDiff `json:"pages"`
+	// Files lists other changed files: assets, and pages whose text is
+	// unchanged but whose markup differs (e.g. a new navigation link).
+	Files []FileChange `json:"files"`
+}
+
+// PageDiff is a page whose text was added, modified or deleted.
+type PageDiff struct {
+	Path    string `json:"path"`
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Status  string `json:"status"` // added, modified or deleted
+	Diff    string `json:"diff"`   // unified diff of the page text
+	Added   int    `json:"added"`  // lines added
+	Removed int    `json:"removed"`
+}
+
+// ── Manifests ───────────────────────────────────────────────
+
+// BuildManifest hashes every file of the site in dir and extracts the
+// text of its pages. Version control metadata is skipped.
+func BuildManifest(dir string) (*DeployManifest, error) {
+	m := &DeployManifest{Files: make(map[string]ManifestFile)}
+	err := walkFiles(dir, func(rel string, info os.FileInfo) error {
+		if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		f := ManifestFile{Hash: hex.EncodeToString(sum[:])}
+		if strings.HasSuffix(rel, ".html") {
+			f.Title, f.Text = pageText(string(data))
+		}
+		m.Files[rel] = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadDeployManifest returns the manifest of the last deploy to target,
+// or nil if there is none.
+func LoadDeployManifest(projectDir, target string) *DeployManifest {
+	data, err := os.ReadFile(deployManifestPath(projectDir, target))
+	if err != nil {
+		return nil
+	}
+	var m DeployManifest
+	if json.Unmarshal(data, &m) != nil || m.Files == nil {
+		return nil
+	}
+	return &m
+}
+
+// SaveDeployManifest records m as the last deploy to its target.
+func SaveDeployManifest(projectDir string, m *DeployManifest) error {
+	path := deployManifestPath(projectDir, m.Target)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func deployManifestPath(projectDir, target string) string {
+	return filepath.Join(projectDir, filepath.FromSlash(deployManifestDir), slugify(target)+".json")
+}
+
+// fingerprint hashes the paths and hashes of every file, identifying the
+// site independent of when it was built.
+func (m *DeployManifest) fingerprint() string {
+	paths := sortedKeys(m.Files)
+	h := sha256.New()
+	for _, rel := range paths {
+		h.Write([]byte(rel + "\x00" + m.Files[rel].Hash + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ── Diffing ─────────────────────────────────────────────────
+
+// DiffManifests compares the next site with the deployed one. Preserved
+// files and .nojekyll, which deploys manage themselves, are left out.
+// old may be nil, in which case every file is new.
+func DiffManifests(old, next *DeployManifest, preserve []string) *DeployDiff {
+	diff := &DeployDiff{Baseline: "none", Pages: []PageDiff{}, Files: []FileChange{}}
+	if old == nil {
+		old = &DeployManifest{}
+	}
+	skip := func(rel string) bool {
+		return rel == ".nojekyll" || isPreserved(rel, preserve)
+	}
+
+	for rel, nf := range next.Files {
+		if skip(rel) {
+			continue
+		}
+		of, existed := old.Files[rel]
+		switch {
+		case existed && of.Hash == nf.Hash:
+			// unchanged
+		case !strings.HasSuffix(rel, ".html"):
+			status := "added"
+			if existed {
+				status = "modified"
+			}
+			diff.Files = append(diff.Files, FileChange{Path: rel, Status: status})
+		case !existed:
+			diff.Pages = append(diff.Pages, newPageDiff(rel, "added", ManifestFile{}, nf))
+		case of.Text == nf.Text:
+			diff.Files = append(diff.Files, FileChange{Path: rel, Status: "modified"})
+		default:
+			diff.Pages = append(diff.Pages, newPageDiff(rel, "modified", of, nf))
+		}
+	}
+	for rel, of := range old.Files {
+		if _, ok := next.Files[rel]; ok || skip(rel) {
+			continue
+		}
+		if strings.HasSuffix(rel, ".html") {
+			diff.Pages = append(diff.Pages, newPageDiff(rel, "deleted", of, ManifestFile{}))
+		} else {
+			diff.Files = append(diff.Files, FileChange{Path: rel, Status: "deleted"})
+		}
+	}
+
+	sort.Slice(diff.Pages, func(i, j int) bool { return diff.Pages[i].Path < diff.Pages[j].Path })
+	sort.Slice(diff.Files, func(i, j int) bool { return diff.Files[i].Path < diff.Files[j].Path })
+	return diff
+}
+
+// Empty reports whether the deploy changes nothing.
+func (d *DeployDiff) Empty() bool {
+	return len(d.Pages) == 0 && len(d.Files) == 0
+}
+
+func newPageDiff(rel, status string, old, next ManifestFile) PageDiff {
+	p := PageDiff{
+		Path:   rel,
+		URL:    "/" + strings.TrimSuffix(strings.TrimSuffix(rel, "index.html"), "/"),
+		Title:  next.Title,
+		Status: status,
+		Diff:   unifiedDiff("a/"+rel, "b/"+rel, old.Text, next.Text, 3),
+	}
+	if p.URL != "/" && strings.HasSuffix(rel, "index.html") {
+		p.URL += "/"
+	}
+	if p.Title == "" {
+		p.Title = old.Title
+	}
+	for _, line := range strings.Split(p.Diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			p.Added++
+		case strings.HasPrefix(line, "-"):
+			p.Removed++
+		}
+	}
+	return p
+}
+
+// ── Page text ───────────────────────────────────────────────
+
+var (
+	reMain       = regexp.MustCompile(`(?is)<main[^>]*>(.*)</main>`)
+	reBody       = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+	reTitle      = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	reH1         = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+	reNonContent = regexp.MustCompile(`(?is)<(script|style|svg|noscript)[^>]*>.*?</(script|style|svg|noscript)>`)
+	rePre        = regexp.MustCompile(`(?is)<pre[^>]*>.*?</pre>`)
+	reBlockTag   = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|li|ul|ol|tr|table|blockquote|pre|dt|dd|section|article|header|footer|figure|figcaption|hr|br)\b[^>]*>`)
+	reTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	reSpaces     = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// pageText returns the title of an HTML page and the text of its main
+// content, one block element per line, for diffing. Whitespace inside
+// <pre> blocks is kept.
+func pageText(page string) (title, text string) {
+	if m := reH1.FindStringSubmatch(page); m != nil {
+		title = inlineText(m[1])
+	} else if m := reTitle.FindStringSubmatch(page); m != nil {
+		title = inlineText(m[1])
+	}
+
+	content := page
+	if m := reMain.FindStringSubmatch(page); m != nil {
+		content = m[1]
+	} else if m := reBody.FindStringSubmatch(page); m != nil {
+		content = m[1]
+	}
+	content = reNonContent.ReplaceAllString(content, "")
+
+	var lines []string
+	addBlocks := func(s string) {
+		s = reSpaces.ReplaceAllString(s, " ")
+		s = reBlockTag.ReplaceAllString(s, "\n")
+		for _, line := range strings.Split(s, "\n") {
+			if line = inlineText(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	last := 0
+	for _, loc := range rePre.FindAllStringIndex(content, -1) {
+		addBlocks(content[last:loc[0]])
+		code := html.UnescapeString(reTag.ReplaceAllString(content[loc[0]:loc[1]], ""))
+		for _, line := range strings.Split(strings.Trim(code, "\n"), "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+		last = loc[1]
+	}
+	addBlocks(content[last:])
+	return title, strings.Join(lines, "\n")
+}
+
+// inlineText strips tags and entities from an HTML fragment and collapses
+// its whitespace.
+func inlineText(s string) string {
+	s = html.UnescapeString(reTag.ReplaceAllString(s, ""))
+	return strings.TrimSpace(reSpaces.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// What publish builds do with private pages (build.private_mode).
+const (
+	PrivateExclude = "exclude" // leave them out (default)
+	PrivateEncrypt = "encrypt" // publish them encrypted with a shared passphrase
+)
+
+// PrivatePassphraseEnv names the environment variable holding the
+// passphrase for build.private_mode: encrypt.
+const PrivatePassphraseEnv = "OPENDOC_PRIVATE_PASSPHRASE"
+
+// pbkdf2Iterations is the key derivation cost, following the OWASP
+// recommendation for PBKDF2-HMAC-SHA256. The browser pays it once per
+// unlock.
+const pbkdf2Iterations = 600000
+
+// ResolvePrivatePassphrase returns the passphrase for encrypted private
+// pages. Priority: environment variable > secrets file.
+func ResolvePrivatePassphrase() string {
+	if p := os.Getenv(PrivatePassphraseEnv); p != "" {
+		return p
+	}
+	return LoadSecrets().PrivatePassphrase
+}
+
+// ── Sealing ─────────────────────────────────────────────────
+
+// pageSealer encrypts pages with AES-256-GCM under a key derived from the
+// passphrase. Encryption is deterministic so an unchanged page deploys
+// as unchanged: the salt comes from the site's identity and each page's
+// nonce from an HMAC of its content, which only reveals whether two
+// encrypted pages are identical. The HMAC and AES keys are separate
+// HKDF subkeys ("nonce" and "enc") of the PBKDF2 key.
+type pageSealer struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+	salt     []byte
+}
+
+// sealedPage is the payload embedded in an encrypted page, read by
+// static/js/decrypt.js. Binary fields are base64.
+type sealedPage struct {
+	Version    int    `json:"v"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	IV         string `json:"iv"`
+	Data       string `json:"data"` // ciphertext followed by the GCM tag
+}
+
+func newPageSealer(passphrase string, site SiteConfig) (*pageSealer, error) {
+	sum := sha256.Sum256([]byte("opendoc private pages\x00" + site.URL + "\x00" + site.Name))
+	salt := sum[:16]
+	master, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	nonceKey, err := hkdf.Key(sha256.New, master, nil, "nonce", 32)
+	if err != nil {
+		return nil, err
+	}
+	encKey, err := hkdf.Key(sha256.New, master, nil, "enc", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &pageSealer{aead: aead, nonceKey: nonceKey, salt: salt}, nil
+}
+
+func (s *pageSealer) seal(plaintext []byte) *sealedPage {
+	mac := hmac.New(sha256.New, s.nonceKey)
+	mac.Write(plaintext)
+	iv := mac.Sum(nil)[:s.aead.NonceSize()]
+	return &sealedPage{
+		Version:    2,
+		Iterations: pbkdf2Iterations,
+		Salt:       base64.StdEncoding.EncodeToString(s.salt),
+		IV:         base64.StdEncoding.EncodeToString(iv),
+		Data:       base64.StdEncoding.EncodeToString(s.aead.Seal(nil, iv, plaintext, nil)),
+	}
+}
+
+// sealPrivate replaces the rendered private pages and entries of the
+// language, and every page under private collections, with
+// encrypted.html: a shell holding the encrypted page and a passphrase form.
+func (b *siteBuild) sealPrivate() error {
+	var files []string
+	for _, slug := range b.sealed {
+		files = append(files, filepath.Join(b.outputDir, filepath.FromSlash(slug), "index.html"))
+	}
+	for coll := range b.privateCollections {
+		dir := filepath.Join(b.outputDir, coll)
+		walkFiles(dir, func(rel string, info os.FileInfo) error {
+			if strings.HasSuffix(rel, ".html") {
+				files = append(files, filepath.Join(dir, filepath.FromSlash(rel)))
+			}
+			return nil
+		})
+	}
+
+	for _, path := range files {
+		page, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		payload, _ := json.Marshal(b.sealer.seal(page))
+		ctx := mergePongoCtx(b.siteCtx, pongo2.Context{
+			"encrypted_payload": string(payload),
+		})
+		rendered, err := b.env.RenderTemplate("encrypted.html", ctx)
+		if err != nil {
+			return fmt.Errorf("render encrypted page: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(rendered), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package extensions
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	shortcodeTagRe    = regexp.MustCompile(`\{\{<\s*(/?)\s*([A-Za-z0-9_-]+)(.*?)\s*(/?)>\}\}`)
+	shortcodeEscapeRe = regexp.MustCompile(`\{\{</\*(.*?)\*/>\}\}`)
+	shortcodeArgRe    = regexp.MustCompile(`([A-Za-z0-9_-]+)\s*=\s*(?:"((?:[^"\\]|\\.)*)"|'([^']*)'|(\S+))|"((?:[^"\\]|\\.)*)"|'([^']*)'|(\S+)`)
+	fenceRe           = regexp.MustCompile("^\\s*(`{3,}|~{3,})(.*)$")
+)
+
+// Shortcode is a single parsed {{< name ... >}} invocation.
+type Shortcode struct {
+	Name       string
+	Args       map[string]string // named arguments (key="value")
+	Positional []string          // unnamed arguments, in order
+	Inner      string            // raw content between paired tags (already expanded)
+	Paired     bool              // true for {{< name >}}...{{< /name >}}
+	Line       int               // 1-based line of the opening tag in the source
+}
+
+// ShortcodeFunc renders a shortcode to the HTML that replaces it.
+type ShortcodeFunc func(sc Shortcode) (string, error)
+
+// ShortcodeError reports a shortcode that failed to parse or render.
+type ShortcodeError struct {
+	Line int
+	Name string
+	Err  error
+}
+
+func (e *ShortcodeError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: shortcode %q: %v", e.Line, e.Name, e.Err)
+}
+
+func (e *ShortcodeError) Unwrap() error { return e.Err }
+
+type shortcodeTag struct {
+	name       string
+	args       string
+	closing    bool
+	selfClose  bool
+	start, end int
+	line       int
+}
+
+// PreprocessShortcodes expands {{< name >}} and {{< name >}}...{{< /name >}}
+// shortcodes using render. Tags inside fenced code blocks are left alone,
+// and {{</* name */>}} is emitted literally as {{< name >}}.
+func PreprocessShortcodes(source string, render ShortcodeFunc) (string, error) {
+	if !strings.Contains(source, "{{<") {
+		return source, nil
+	}
+	return expandShortcodes(source, 1, render)
+}
+
+func expandShortcodes(source string, firstLine int, render ShortcodeFunc) (string, error) {
+	tags := findShortcodeTags(source, firstLine)
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		if tag.closing {
+			return "", &ShortcodeError{Line: tag.line, Name: tag.name, Err: fmt.Errorf("closing tag without matching opening tag")}
+		}
+
+		sc := Shortcode{Name: tag.name, Line: tag.line}
+		sc.Args, sc.Positional = parseShortcodeArgs(tag.args)
+		end := tag.end
+
+		// Look for a matching closing tag, allowing same-name nesting.
+		if !tag.selfClose {
+			depth := 0
+			for j := i + 1; j < len(tags); j++ {
+				if tags[j].name != tag.name || tags[j].selfClose {
+					continue
+				}
+				if !tags[j].closing {
+					depth++
+					continue
+				}
+				if depth > 0 {
+					depth--
+					continue
+				}
+				innerLine := tag.line + strings.Count(source[tag.start:tag.end], "\n")
+				inner, err := expandShortcodes(source[tag.end:tags[j].start], innerLine, render)
+				if err != nil {
+					return "", err
+				}
+				sc.Inner = strings.Trim(inner, "\n")
+				sc.Paired = true
+				end = tags[j].end
+				i = j
+				break
+			}
+		}
+
+		// Skip any tags swallowed by a paired shortcode's body.
+		for i+1 < len(tags) && tags[i+1].start < end {
+			i++
+		}
+
+		out, err := render(sc)
+		if err != nil {
+			if _, ok := err.(*ShortcodeError); ok {
+				return "", err
+			}
+			return "", &ShortcodeError{Line: sc.Line, Name: sc.Name, Err: err}
+		}
+
+		b.WriteString(source[pos:tag.start])
+		b.WriteString(strings.TrimSpace(out))
+		pos = end
+	}
+	b.WriteString(source[pos:])
+
+	return shortcodeEscapeRe.ReplaceAllString(b.String(), "{{<$1>}}"), nil
+}
+
+// findShortcodeTags returns every shortcode tag outside fenced code blocks.
+func findShortcodeTags(source string, firstLine int) []shortcodeTag {
+	// Mark byte ranges covered by fenced code blocks.
+	type span struct{ start, end int }
+	var fences []span
+	offset := 0
+	inFence := false
+	fenceStart := 0
+	fenceMarker := ""
+	for _, line := range strings.SplitAfter(source, "\n") {
+		if m := fenceRe.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+			if !inFence {
+				inFence, fenceStart, fenceMarker = true, offset, m[1]
+			} else if isClosingFence(m[1], m[2], fenceMarker) {
+				inFence = false
+				fences = append(fences, span{fenceStart, offset + len(line)})
+			}
+		}
+		offset += len(line)
+	}
+	if inFence {
+		fences = append(fences, span{fenceStart, len(source)})
+	}
+
+	var tags []shortcodeTag
+	for _, m := range shortcodeTagRe.FindAllStringSubmatchIndex(source, -1) {
+		start, end := m[0], m[1]
+		fenced := false
+		for _, f := range fences {
+			if start >= f.start && start < f.end {
+				fenced = true
+				break
+			}
+		}
+		if fenced {
+			continue
+		}
+		tags = append(tags, shortcodeTag{
+			closing:   m[3] > m[2],
+			name:      source[m[4]:m[5]],
+			args:      strings.TrimSpace(source[m[6]:m[7]]),
+			selfClose: m[9] > m[8],
+			start:     start,
+			end:       end,
+			line:      firstLine + strings.Count(source[:start], "\n"),
+		})
+	}
+	return tags
+}
+
+// isClosingFence reports whether a fence line with the given marker and
+// trailing text closes a block opened by open: the same character, at
+// least as many of them, and no info string.
+func isClosingFence(marker, rest, open string) bool {
+	return marker[0] == open[0] && len(marker) >= len(open) && strings.TrimSpace(rest) == ""
+}
+
+// parseShortcodeArgs splits `key="value" other positional` into named and
+// positional arguments.
+func parseShortcodeArgs(s string) (map[string]string, []string) {
+	named := make(map[string]string)
+	var positional []string
+	for _, m := range shortcodeArgRe.FindAllStringSubmatchIndex(s, -1) {
+		group := func(n int) (string, bool) {
+			if m[2*n] < 0 {
+				return "", false
+			}
+			return s[m[2*n]:m[2*n+1]], true
+		}
+		if key, ok := group(1); ok {
+			if v, ok := group(2); ok {
+				named[key] = strings.ReplaceAll(v, `\"`, `"`)
+			} else if v, ok := group(3); ok {
+				named[key] = v
+			} else {
+				named[key], _ = group(4)
+			}
+			continue
+		}
+		if v, ok := group(5); ok {
+			positional = append(positional, strings.ReplaceAll(v, `\"`, `"`))
+		} else if v, ok := group(6); ok {
+			positional = append(positional, v)
+		} else {
+			v, _ := group(7)
+			positional = append(positional, v)
+		}
+	}
+	return named, positional
+}
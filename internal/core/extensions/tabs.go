@@ -15,8 +15,6 @@ var (
 	tabDelimRe  = regexp.MustCompile(`^===\s+(.+)$`)
 )
 
-var tabGroupCounter int
-
 // renderTabContent renders markdown content for a tab panel.
 func renderTabContent(lines []string) string {
 	md := goldmark.New(goldmark.WithRendererOptions(html.WithUnsafe()))
@@ -34,6 +32,10 @@ func PreprocessTabs(source string) string {
 	var newLines []string
 	i := 0
 
+	// Group IDs are numbered per page so rebuilding an unchanged page
+	// produces identical HTML.
+	tabGroupCounter := 0
+
 	for i < len(lines) {
 		if tabsOpenRe.MatchString(strings.TrimSpace(lines[i])) {
 			i++
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gitInfoCacheFile caches file histories between builds, keyed by HEAD.
+const gitInfoCacheFile = ".opendoc/cache/gitinfo.json"
+
+// FileHistory is the creation and modification history of a source file.
+type FileHistory struct {
+	Created      time.Time     `json:"created"`
+	Updated      time.Time     `json:"updated"`
+	Contributors []Contributor `json:"contributors,omitempty"` // most commits first
+	Source       string        `json:"source"`                 // "git" or "mtime"
+}
+
+// Contributor is a commit author of a file.
+type Contributor struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Commits int    `json:"commits"`
+}
+
+// GitInfo answers history lookups for the files of a project, from one
+// pass over `git log`. Files outside a repository, or not yet committed,
+// fall back to their modification time.
+type GitInfo struct {
+	root  string // repository root; empty when the project isn't in a repo
+	files map[string]*FileHistory
+}
+
+type gitInfoCache struct {
+	Version int                     `json:"version"`
+	Head    string                  `json:"head"`
+	Files   map[string]*FileHistory `json:"files"`
+}
+
+// gitInfoCacheVersion changes when cached paths are read differently, so
+// older caches are rebuilt.
+const gitInfoCacheVersion = 2
+
+// LoadGitInfo reads the history of every file under projectDir. Results are
+// cached in .opendoc/cache/gitinfo.json and reused while HEAD is unchanged.
+func LoadGitInfo(projectDir string) *GitInfo {
+	g := &GitInfo{files: make(map[string]*FileHistory)}
+
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = projectDir
+		out, err := cmd.Output()
+		return string(out), err
+	}
+
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return g
+	}
+	head, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return g // repository without commits
+	}
+	g.root = strings.TrimSpace(root)
+	head = strings.TrimSpace(head)
+
+	cachePath := filepath.Join(projectDir, filepath.FromSlash(gitInfoCacheFile))
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var cache gitInfoCache
+		if json.Unmarshal(data, &cache) == nil && cache.Version == gitInfoCacheVersion && cache.Head == head && cache.Files != nil {
+			g.files = cache.Files
+			return g
+		}
+	}
+
+	// One pass over the log, newest commit first. Each commit starts with a
+	// \x1e-prefixed header, followed by the files it touched; with -z, all
+	// are NUL-terminated and paths are not quoted.
+	out, err := git("log", "--no-renames", "--name-only", "-z", "--format=%x1e%aI%x1f%an%x1f%ae", "--", ".")
+	if err != nil {
+		return g
+	}
+	contributors := make(map[string]map[string]*Contributor)
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(record, "\x00")
+		header := strings.Split(fields[0], "\x1f")
+		if len(header) != 3 {
+			continue
+		}
+		when, err := time.Parse(time.RFC3339, header[0])
+		if err != nil {
+			continue
+		}
+		name, email := header[1], header[2]
+
+		for _, file := range fields[1:] {
+			file = strings.TrimPrefix(file, "\n")
+			if file == "" {
+				continue
+			}
+			h, ok := g.files[file]
+			if !ok {
+				h = &FileHistory{Updated: when, Source: "git"}
+				g.files[file] = h
+				contributors[file] = make(map[string]*Contributor)
+			}
+			h.Created = when
+
+			key := strings.ToLower(email)
+			c, ok := contributors[file][key]
+			if !ok {
+				c = &Contributor{Name: name, Email: email}
+				contributors[file][key] = c
+			}
+			c.Commits++
+		}
+	}
+	for file, byEmail := range contributors {
+		list := make([]Contributor, 0, len(byEmail))
+		for _, c := range byEmail {
+			list = append(list, *c)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Commits != list[j].Commits {
+				return list[i].Commits > list[j].Commits
+			}
+			return list[i].Name < list[j].Name
+		})
+		g.files[file].Contributors = list
+	}
+
+	if data, err := json.Marshal(gitInfoCache{Version: gitInfoCacheVersion, Head: head, Files: g.files}); err == nil {
+		os.MkdirAll(filepath.Dir(cachePath), 0o755)
+		os.WriteFile(cachePath, data, 0o644)
+	}
+	return g
+}
+
+// History returns the history of the file at path, falling back to its
+// modification time when git knows nothing about it. It returns nil if the
+// file can't be read either.
+func (g *GitInfo) History(path string) *FileHistory {
+	if g.root != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			abs, _ = filepath.EvalSymlinks(abs)
+			if rel, err := filepath.Rel(g.root, abs); err == nil {
+				if h, ok := g.files[filepath.ToSlash(rel)]; ok {
+					return h
+				}
+			}
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	return &FileHistory{Created: info.ModTime(), Updated: info.ModTime(), Source: "mtime"}
+}
@@ -0,0 +1,510 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyDir holds the version history of a project's files: a log of
+// revisions and a content-addressed store of what each one contained.
+const historyDir = ".opendoc/history"
+
+// Files larger than this are left out of the history, and pruning runs at
+// most this often.
+const (
+	maxHistoryFileSize = 20 << 20
+	historyPruneEvery  = time.Hour
+)
+
+// Revision actions.
+const (
+	RevisionSave     = "save"     // written by the workbench or a tool
+	RevisionDelete   = "delete"   // deleted; Hash is what the file held
+	RevisionRestore  = "restore"  // an earlier revision written back
+	RevisionRecover  = "recover"  // a deleted file brought back
+	RevisionExternal = "external" // found changed outside the workbench before a save
+)
+
+// Revision is one recorded version of a file.
+type Revision struct {
+	ID     int64     `json:"id"`
+	Path   string    `json:"path"` // relative to the project, forward slashes
+	Action string    `json:"action"`
+	Hash   string    `json:"hash"` // SHA-256 of the content
+	Size   int64     `json:"size"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Source string    `json:"source,omitempty"` // what made the change: editor, chat, co-edit…
+}
+
+// ErrNoRevision is returned for a revision that isn't in the history.
+var ErrNoRevision = errors.New("no such revision")
+
+// History is the version history of one project. Use ProjectHistory to
+// get it; it is safe for concurrent use.
+type History struct {
+	projectDir string
+	dir        string
+
+	mu        sync.Mutex
+	loaded    bool
+	revs      []Revision // oldest first
+	nextID    int64
+	lastPrune time.Time
+}
+
+var histories sync.Map // project dir → *History
+
+// ProjectHistory returns the history of the project in projectDir.
+func ProjectHistory(projectDir string) *History {
+	projectDir = filepath.Clean(projectDir)
+	h, _ := histories.LoadOrStore(projectDir, &History{
+		projectDir: projectDir,
+		dir:        filepath.Join(projectDir, historyDir),
+	})
+	return h.(*History)
+}
+
+// ── Recording ───────────────────────────────────────────────
+
+// RecordSave records that rel now holds after. before is what it held
+// until then, or nil for a new file; if the history doesn't have it yet
+// (the file was changed outside the workbench), it is recorded first so
+// the save can be undone. Content too large to keep is left out, and the
+// error wraps ErrTooLargeForHistory.
+func (h *History) RecordSave(rel string, before, after []byte, user, source string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+	rel = historyPath(rel)
+	var tooLarge error
+	if before != nil {
+		if err := h.recordUnseen(rel, before); errors.Is(err, ErrTooLargeForHistory) {
+			tooLarge = err
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := h.add(Revision{Path: rel, Action: RevisionSave, User: user, Source: source}, after); err != nil {
+		return err
+	}
+	return tooLarge
+}
+
+// ErrTooLargeForHistory is returned for a file the history can't keep,
+// so a delete can be refused and a save logged.
+var ErrTooLargeForHistory = fmt.Errorf("larger than %d MB, too large to keep in the history", maxHistoryFileSize>>20)
+
+// RecordDelete records the files at rel, a file or a directory, as
+// deleted, hidden ones included. Call it before deleting them. If any
+// file is too large to keep, nothing is recorded and the error wraps
+// ErrTooLargeForHistory; if the directory holds a .git or .opendoc
+// directory, it wraps ErrProtectedPath.
+func (h *History) RecordDelete(rel, user, source string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+	root := filepath.Join(h.projectDir, filepath.FromSlash(rel))
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != root && ProtectedPath(h.projectDir, p) {
+			dirRel, _ := filepath.Rel(h.projectDir, p)
+			return fmt.Errorf("%s: %w", filepath.ToSlash(dirRel), ErrProtectedPath)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fileRel, _ := filepath.Rel(h.projectDir, p)
+		fileRel = filepath.ToSlash(fileRel)
+		if info.Size() > maxHistoryFileSize {
+			return fmt.Errorf("%s is %w", fileRel, ErrTooLargeForHistory)
+		}
+		files = append(files, fileRel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, fileRel := range files {
+		data, err := os.ReadFile(filepath.Join(h.projectDir, filepath.FromSlash(fileRel)))
+		if err != nil {
+			return err
+		}
+		if len(data) > maxHistoryFileSize {
+			return fmt.Errorf("%s is %w", fileRel, ErrTooLargeForHistory)
+		}
+		if err := h.recordUnseen(fileRel, data); err != nil {
+			return err
+		}
+		if err := h.add(Revision{Path: fileRel, Action: RevisionDelete, User: user, Source: source}, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordUnseen records data as an external change unless it is what the
+// history last saw of rel.
+func (h *History) recordUnseen(rel string, data []byte) error {
+	if last, ok := h.latest(rel); ok && last.Action != RevisionDelete && last.Hash == ContentHash(data) {
+		return nil
+	}
+	return h.add(Revision{Path: rel, Action: RevisionExternal}, data)
+}
+
+// add stores content and appends a revision for it to the log.
+func (h *History) add(rev Revision, content []byte) error {
+	if len(content) > maxHistoryFileSize {
+		return fmt.Errorf("%s is %w", rev.Path, ErrTooLargeForHistory)
+	}
+	rev.ID = h.nextID
+	rev.Hash = ContentHash(content)
+	rev.Size = int64(len(content))
+	if rev.Time.IsZero() {
+		rev.Time = time.Now().UTC()
+	}
+	if err := h.storeObject(rev.Hash, content); err != nil {
+		return err
+	}
+	line, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(h.dir, "log.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	h.nextID++
+	h.revs = append(h.revs, rev)
+
+	if time.Since(h.lastPrune) > historyPruneEvery {
+		return h.prune()
+	}
+	return nil
+}
+
+// ── Reading ─────────────────────────────────────────────────
+
+// Revisions lists the revisions of rel, newest first.
+func (h *History) Revisions(rel string) ([]Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	rel = historyPath(rel)
+	revs := []Revision{}
+	for i := len(h.revs) - 1; i >= 0; i-- {
+		if h.revs[i].Path == rel {
+			revs = append(revs, h.revs[i])
+		}
+	}
+	return revs, nil
+}
+
+// Revision returns a revision and its content.
+func (h *History) Revision(id int64) (Revision, []byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return Revision{}, nil, err
+	}
+	return h.revision(id)
+}
+
+func (h *History) revision(id int64) (Revision, []byte, error) {
+	for _, rev := range h.revs {
+		if rev.ID == id {
+			data, err := os.ReadFile(h.objectPath(rev.Hash))
+			if err != nil {
+				return rev, nil, fmt.Errorf("revision %d: %w", id, err)
+			}
+			return rev, data, nil
+		}
+	}
+	return Revision{}, nil, ErrNoRevision
+}
+
+// Diff returns a unified diff from revision from to revision to, or to
+// the file as it is now when to is 0.
+func (h *History) Diff(from, to int64) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return "", err
+	}
+	a, aData, err := h.revision(from)
+	if err != nil {
+		return "", err
+	}
+	bName, bData := "current", []byte(nil)
+	if to == 0 {
+		bData, _ = os.ReadFile(filepath.Join(h.projectDir, filepath.FromSlash(a.Path)))
+	} else {
+		var b Revision
+		if b, bData, err = h.revision(to); err != nil {
+			return "", err
+		}
+		bName = fmt.Sprintf("revision %d", b.ID)
+	}
+	return unifiedDiff(
+		fmt.Sprintf("%s (revision %d)", a.Path, a.ID),
+		fmt.Sprintf("%s (%s)", a.Path, bName),
+		string(aData), string(bData), 3,
+	), nil
+}
+
+// Deleted lists files whose latest revision is a deletion and which
+// haven't been created again, newest first.
+func (h *History) Deleted() ([]Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h.deleted(""), nil
+}
+
+// deleted lists deleted files at or under prefix ("" for all).
+func (h *History) deleted(prefix string) []Revision {
+	latest := make(map[string]Revision)
+	for _, rev := range h.revs {
+		latest[rev.Path] = rev
+	}
+	deleted := []Revision{}
+	for path, rev := range latest {
+		if rev.Action != RevisionDelete {
+			continue
+		}
+		if prefix != "" && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(h.projectDir, filepath.FromSlash(path))); err == nil {
+			continue
+		}
+		deleted = append(deleted, rev)
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].ID > deleted[j].ID })
+	return deleted
+}
+
+// ── Restoring ───────────────────────────────────────────────
+
+// Restore writes a revision back to its file and returns the content.
+func (h *History) Restore(id int64, user, source string) (Revision, []byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return Revision{}, nil, err
+	}
+	rev, data, err := h.revision(id)
+	if err != nil {
+		return rev, nil, err
+	}
+	abs := filepath.Join(h.projectDir, filepath.FromSlash(rev.Path))
+	if current, err := os.ReadFile(abs); err == nil {
+		if err := h.recordUnseen(rev.Path, current); err != nil {
+			return rev, nil, err
+		}
+	}
+	if err := h.writeBack(abs, data); err != nil {
+		return rev, nil, err
+	}
+	return rev, data, h.add(Revision{Path: rev.Path, Action: RevisionRestore, User: user, Source: source}, data)
+}
+
+// Recover brings back the deleted files at rel, a file or a directory,
+// as they were when deleted. It returns the paths it recovered.
+func (h *History) Recover(rel, user, source string) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	rel = historyPath(rel)
+	recovered := []string{}
+	for _, rev := range h.deleted(rel) {
+		data, err := os.ReadFile(h.objectPath(rev.Hash))
+		if err != nil {
+			return recovered, fmt.Errorf("%s: %w", rev.Path, err)
+		}
+		if err := h.writeBack(filepath.Join(h.projectDir, filepath.FromSlash(rev.Path)), data); err != nil {
+			return recovered, err
+		}
+		if err := h.add(Revision{Path: rev.Path, Action: RevisionRecover, User: user, Source: source}, data); err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, rev.Path)
+	}
+	sort.Strings(recovered)
+	return recovered, nil
+}
+
+func (h *History) writeBack(abs string, data []byte) error {
+	if ProtectedPath(h.projectDir, abs) {
+		return ErrProtectedPath
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(abs, data)
+}
+
+// ── Storage ─────────────────────────────────────────────────
+
+// ContentHash identifies a version of a file: the hex SHA-256 of its
+// content.
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *History) objectPath(hash string) string {
+	return filepath.Join(h.dir, "objects", hash[:2], hash[2:])
+}
+
+func (h *History) storeObject(hash string, content []byte) error {
+	p := h.objectPath(hash)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(p, content)
+}
+
+// load reads the log the first time the history is used.
+func (h *History) load() error {
+	if h.loaded {
+		return nil
+	}
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(h.dir, "log.jsonl"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	h.nextID = 1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var rev Revision
+		if json.Unmarshal(scanner.Bytes(), &rev) != nil || rev.Hash == "" {
+			continue // a line cut short by a crash
+		}
+		h.revs = append(h.revs, rev)
+		h.nextID = max(h.nextID, rev.ID+1)
+	}
+	h.loaded = true
+	return h.prune()
+}
+
+// historyPath is the form of a project-relative path the log uses.
+func historyPath(rel string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(rel)), "/")
+}
+
+func (h *History) latest(rel string) (Revision, bool) {
+	for i := len(h.revs) - 1; i >= 0; i-- {
+		if h.revs[i].Path == rel {
+			return h.revs[i], true
+		}
+	}
+	return Revision{}, false
+}
+
+// ── Retention ───────────────────────────────────────────────
+
+// prune applies the project's history settings: revisions older than
+// KeepDays, and all but the newest KeepPerFile of each file, are
+// dropped. A file's latest revision is kept however old it is, unless it
+// is a deletion, so deleted files can be recovered for KeepDays.
+func (h *History) prune() error {
+	h.lastPrune = time.Now()
+	settings := DefaultHistory
+	if cfg, err := LoadConfig(h.projectDir); err == nil {
+		settings = cfg.History
+	}
+	cutoff := time.Now().AddDate(0, 0, -settings.KeepDays)
+
+	newer := make(map[string]int) // revisions of each path seen so far, newest first
+	keep := make([]bool, len(h.revs))
+	dropped := false
+	for i := len(h.revs) - 1; i >= 0; i-- {
+		rev := h.revs[i]
+		n := newer[rev.Path]
+		newer[rev.Path]++
+		if n == 0 {
+			keep[i] = rev.Action != RevisionDelete || rev.Time.After(cutoff)
+		} else {
+			keep[i] = n < settings.KeepPerFile && rev.Time.After(cutoff)
+		}
+		dropped = dropped || !keep[i]
+	}
+	if !dropped {
+		return nil
+	}
+
+	var kept []Revision
+	var sb strings.Builder
+	used := make(map[string]bool)
+	for i, rev := range h.revs {
+		if !keep[i] {
+			continue
+		}
+		kept = append(kept, rev)
+		used[rev.Hash] = true
+		line, _ := json.Marshal(rev)
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+	if err := WriteFileAtomic(filepath.Join(h.dir, "log.jsonl"), []byte(sb.String())); err != nil {
+		return err
+	}
+	h.revs = kept
+
+	// Remove content no revision refers to any more.
+	objects := filepath.Join(h.dir, "objects")
+	return filepath.WalkDir(objects, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(objects, p)
+		if hash := strings.ReplaceAll(filepath.ToSlash(rel), "/", ""); !used[hash] {
+			os.Remove(p)
+		}
+		return nil
+	})
+}
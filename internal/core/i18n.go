@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// i18nDir holds string tables (<lang>.yml), both in the project root and
+// inside a theme.
+const i18nDir = "i18n"
+
+// ── String tables ───────────────────────────────────────────
+
+// loadI18n builds the string table of a language: the theme's English
+// table, overlaid with the theme's table for lang, overlaid with the
+// project's i18n/<lang>.yml. Missing keys therefore fall back to English.
+func loadI18n(env *TemplateEnv, projectDir, lang string) (map[string]any, error) {
+	table := make(map[string]any)
+	overlay := func(data []byte) error {
+		var m map[string]any
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		for k, v := range m {
+			table[k] = v
+		}
+		return nil
+	}
+
+	themeFiles := []string{"en"}
+	if lang != "en" {
+		themeFiles = append(themeFiles, lang)
+	}
+	for _, name := range themeFiles {
+		if data, err := env.ReadFile(i18nDir + "/" + name + ".yml"); err == nil {
+			if err := overlay(data); err != nil {
+				return nil, fmt.Errorf("theme %s/%s.yml: %w", i18nDir, name, err)
+			}
+		}
+	}
+
+	projectFile := filepath.Join(projectDir, i18nDir, lang+".yml")
+	if data, err := os.ReadFile(projectFile); err == nil {
+		if err := overlay(data); err != nil {
+			return nil, fmt.Errorf("%s/%s.yml: %w", i18nDir, lang, err)
+		}
+	}
+	return table, nil
+}
+
+// dateLocale reads month and weekday names from a string table, keeping
+// the English names for any list that is missing or the wrong length.
+func dateLocale(table map[string]any) *DateLocale {
+	names := func(key string, fallback []string) []string {
+		list := stringList(table[key])
+		if len(list) != len(fallback) {
+			return fallback
+		}
+		return list
+	}
+	return &DateLocale{
+		Months:      names("months", EnglishDates.Months),
+		MonthsShort: names("months_short", EnglishDates.MonthsShort),
+		Days:        names("weekdays", EnglishDates.Days),
+		DaysShort:   names("weekdays_short", EnglishDates.DaysShort),
+	}
+}
+
+// ── Translations ────────────────────────────────────────────
+
+// translationIndex maps a translation key to the URL of each language's
+// variant of a page or entry.
+type translationIndex map[string]map[string]string
+
+func (idx translationIndex) add(key, lang, url string) {
+	if idx[key] == nil {
+		idx[key] = make(map[string]string)
+	}
+	idx[key][lang] = url
+}
+
+// pageTranslationKey links variants of a page across languages: the slug,
+// unless frontmatter sets translation_key.
+func pageTranslationKey(p Page) string {
+	if key, ok := p.Meta["translation_key"].(string); ok && key != "" {
+		return key
+	}
+	return "/" + p.Slug
+}
+
+// entryTranslationKey links variants of an entry across languages: the
+// collection and slug, unless frontmatter sets translation_key.
+func entryTranslationKey(e Entry) string {
+	if key, ok := e.Meta["translation_key"].(string); ok && key != "" {
+		return key
+	}
+	return "/" + e.Collection + "/" + e.Slug
+}
+
+// translationsFor lists the other languages' variants of the page with the
+// given key.
+func (b *siteBuild) translationsFor(key string) []map[string]any {
+	var list []map[string]any
+	for _, code := range b.config.LanguageCodes() {
+		if code == b.lang {
+			continue
+		}
+		if url, ok := b.translations[key][code]; ok {
+			list = append(list, map[string]any{
+				"lang": code,
+				"name": b.config.Language(code).Name,
+				"url":  url,
+			})
+		}
+	}
+	return list
+}
+
+// languageLinks returns one link per site language for the language
+// switcher: to the variant of the page with the given key when it exists,
+// otherwise to that language's home page.
+func (b *siteBuild) languageLinks(key string) []map[string]any {
+	var list []map[string]any
+	for _, code := range b.config.LanguageCodes() {
+		url, translated := b.translations[key][code]
+		if !translated {
+			url = b.basePath + "/"
+			if code != b.config.Site.Language {
+				url = b.basePath + "/" + code + "/"
+			}
+		}
+		list = append(list, map[string]any{
+			"lang":       code,
+			"name":       b.config.Language(code).Name,
+			"url":        url,
+			"current":    code == b.lang,
+			"translated": translated,
+		})
+	}
+	return list
+}
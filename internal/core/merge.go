@@ -0,0 +1,140 @@
+package core
+
+import (
+	"slices"
+	"strings"
+)
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Text      string `json:"text"`
+	Conflicts int    `json:"conflicts"` // number of conflict blocks in Text
+}
+
+// Conflict markers, as git writes them.
+const (
+	conflictOurs   = "<<<<<<< ours"
+	conflictSep    = "======="
+	conflictTheirs = ">>>>>>> theirs"
+)
+
+// Merge3 merges two edited versions of base line by line. Changes to
+// different parts of the text are combined; where both versions changed
+// the same lines differently, the result holds a conflict block with
+// ours first, between git-style markers.
+func Merge3(base, ours, theirs string) MergeResult {
+	switch {
+	case ours == theirs, theirs == base:
+		return MergeResult{Text: ours}
+	case ours == base:
+		return MergeResult{Text: theirs}
+	}
+
+	baseLines := splitLines(base)
+	a := editHunks(diffLines(baseLines, splitLines(ours)))
+	b := editHunks(diffLines(baseLines, splitLines(theirs)))
+
+	var out []string
+	var res MergeResult
+	pos := 0
+	for len(a) > 0 || len(b) > 0 {
+		// Start a region at the first hunk of either side and grow it
+		// while the other side has hunks touching it.
+		var start int
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0].start <= b[0].start):
+			start = a[0].start
+		default:
+			start = b[0].start
+		}
+		end := start
+		na, nb := 0, 0
+	grow:
+		for {
+			switch {
+			case na < len(a) && a[na].start <= end:
+				end = max(end, a[na].end)
+				na++
+			case nb < len(b) && b[nb].start <= end:
+				end = max(end, b[nb].end)
+				nb++
+			default:
+				break grow
+			}
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		oursRegion := applyHunks(baseLines, start, end, a[:na])
+		theirsRegion := applyHunks(baseLines, start, end, b[:nb])
+		switch {
+		case nb == 0:
+			out = append(out, oursRegion...)
+		case na == 0, slices.Equal(oursRegion, theirsRegion):
+			out = append(out, theirsRegion...)
+		default:
+			out = append(out, conflictOurs)
+			out = append(out, oursRegion...)
+			out = append(out, conflictSep)
+			out = append(out, theirsRegion...)
+			out = append(out, conflictTheirs)
+			res.Conflicts++
+		}
+		a, b = a[na:], b[nb:]
+		pos = end
+	}
+	out = append(out, baseLines[pos:]...)
+
+	// Lines are compared without their CR; write them back with the line
+	// endings theirs, the file on disk, already uses.
+	newline := "\n"
+	if strings.Contains(theirs, "\r\n") || (theirs == "" && strings.Contains(ours, "\r\n")) {
+		newline = "\r\n"
+	}
+	res.Text = strings.Join(out, newline)
+	if len(out) > 0 && (strings.HasSuffix(ours, "\n") || strings.HasSuffix(theirs, "\n")) {
+		res.Text += newline
+	}
+	return res
+}
+
+// editHunk replaces base lines [start, end) with lines.
+type editHunk struct {
+	start, end int
+	lines      []string
+}
+
+// editHunks groups a line diff against base into runs of changes.
+func editHunks(ops []diffOp) []editHunk {
+	var hunks []editHunk
+	i := 0
+	for k := 0; k < len(ops); {
+		if ops[k].Kind == ' ' {
+			i++
+			k++
+			continue
+		}
+		h := editHunk{start: i, end: i}
+		for ; k < len(ops) && ops[k].Kind != ' '; k++ {
+			if ops[k].Kind == '-' {
+				h.end++
+			} else {
+				h.lines = append(h.lines, ops[k].Text)
+			}
+		}
+		i = h.end
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// applyHunks returns base lines [start, end) with the hunks applied.
+func applyHunks(base []string, start, end int, hunks []editHunk) []string {
+	var out []string
+	cur := start
+	for _, h := range hunks {
+		out = append(out, base[cur:h.start]...)
+		out = append(out, h.lines...)
+		cur = h.end
+	}
+	return append(out, base[cur:end]...)
+}
@@ -0,0 +1,56 @@
+package core
+
+import "path/filepath"
+
+// Build phases, in order, as reported by BuildProgress.
+const (
+	PhaseDiscover   = "discover"   // reading pages and entries
+	PhasePages      = "pages"      // rendering pages
+	PhaseCollection = "collection" // rendering a collection's entries
+	PhaseAssets     = "assets"     // copying static files
+	PhaseDone       = "done"
+)
+
+// BuildProgress reports how far a build has got, through
+// BuildOptions.Progress. Done and Total count the pages and entries of
+// every language; Total is 0 until discovery has finished.
+type BuildProgress struct {
+	Phase      string `json:"phase"`
+	Lang       string `json:"lang,omitempty"`       // on multilingual sites
+	Collection string `json:"collection,omitempty"` // in the collection phase
+	File       string `json:"file,omitempty"`       // source file being rendered, relative to the project
+	Done       int    `json:"done"`
+	Total      int    `json:"total"`
+}
+
+// buildProgress counts rendered pages and entries for BuildOptions.Progress.
+// It is shared by the languages of a build.
+type buildProgress struct {
+	report      func(BuildProgress)
+	projectDir  string
+	multilang   bool
+	done, total int
+}
+
+// send reports p's phase with the current counts.
+func (bp *buildProgress) send(p BuildProgress) {
+	if bp.report == nil {
+		return
+	}
+	if !bp.multilang {
+		p.Lang = ""
+	}
+	if p.File != "" {
+		if rel, err := filepath.Rel(bp.projectDir, p.File); err == nil {
+			p.File = filepath.ToSlash(rel)
+		}
+	}
+	p.Done, p.Total = bp.done, bp.total
+	bp.report(p)
+}
+
+// rendering reports the page or entry about to be rendered, and counts it.
+func (bp *buildProgress) rendering(p BuildProgress) {
+	bp.send(p)
+	bp.done++
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
@@ -8,154 +9,298 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // PublishOptions configures the publish operation.
 type PublishOptions struct {
 	ProjectDir string
-	Repo       string // "owner/repo" override
-	ThemesFS   fs.FS
+	Repo       string   // "owner/repo" override for github-pages targets
+	Target     string   // deploy target name; empty = deploy.default
+	DryRun     bool     // build and report the changes without deploying
+	Message    string   // commit message for git targets; empty = describe the source commit
+	Audience   []string // access groups to publish for (see visibility in frontmatter)
+	// Expect is the fingerprint of a previewed plan. If set, the deploy is
+	// refused when the site built now differs from the one previewed.
+	Expect   string
+	ThemesFS fs.FS
 }
 
 // PublishResult holds the outcome of a publish.
 type PublishResult struct {
-	Repo      string
-	OutputDir string
-	URL       string
+	Repo        string // GitHub repository, for github-pages targets
+	Target      string // deploy target name
+	Destination string // where the site went, e.g. "owner/repo (gh-pages)"
+	OutputDir   string
+	URL         string
+	Changes     []FileChange // files added, modified or deleted at the destination
+	Diff        *DeployDiff  // page-level preview computed before deploying
+	Commit      string       // deploy commit, for git targets
+	DryRun      bool
+	Warnings    []string // problems that didn't stop the deploy
 }
 
-// Publish builds in publish mode and deploys to GitHub Pages via gh.
+// PublishPlan is a site built for a deploy target and not yet deployed,
+// with a preview of what deploying it will change.
+type PublishPlan struct {
+	Target      string
+	Destination string
+	Diff        *DeployDiff
+	// Fingerprint identifies the built site; pass it back as
+	// PublishOptions.Expect to deploy only what was previewed.
+	Fingerprint string
+
+	opts       PublishOptions
+	projectDir string
+	config     *OpenDocConfig
+	deployer   Deployer
+	outputDir  string
+	manifest   *DeployManifest
+	pagesRepo  string // owner/repo for github-pages targets
+}
+
+// Publish builds in publish mode and deploys to a deploy target. The CLI
+// and the workbench both publish through here.
 func Publish(opts PublishOptions) (*PublishResult, error) {
+	plan, err := PreparePublish(opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Deploy()
+}
+
+// PreparePublish builds the site for a deploy target and compares it with
+// what is deployed there now: the destination itself for git and local
+// targets, otherwise the manifest recorded by the last deploy.
+func PreparePublish(opts PublishOptions) (*PublishPlan, error) {
 	projectDir := opts.ProjectDir
 	if projectDir == "" {
 		projectDir = "."
 	}
 	projectDir, _ = filepath.Abs(projectDir)
 
-	// 1. Resolve repo
-	repo := opts.Repo
-	if repo == "" {
-		repo = resolveRepo(projectDir)
-	}
-	if repo == "" {
-		return nil, fmt.Errorf("no GitHub repository configured\n\nSet it with one of:\n  opendoc publish --repo owner/repo\n  opendoc config set github.default_account <account>\n  Edit settings.json in your project with github_repo")
+	// 1. Load config
+	config, err := LoadConfig(projectDir)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
 	}
 
-	// 2. Check gh is installed
-	if err := checkGH(); err != nil {
+	// 2. Resolve the deploy target and check its tools
+	targetName := opts.Target
+	if targetName == "" {
+		targetName = config.Deploy.Default
+	}
+	deployer, err := NewDeployer(config, projectDir, targetName, opts.Repo)
+	if err != nil {
 		return nil, err
 	}
-
-	// 3. Check gh is authenticated
-	if err := checkGHAuth(); err != nil {
+	if err := deployer.Check(); err != nil {
 		return nil, err
 	}
 
-	// 4. Load config and build
-	config, err := LoadConfig(projectDir)
-	if err != nil {
-		return nil, fmt.Errorf("load config: %w", err)
+	// A user or organisation pages repo (owner.github.io) is served from
+	// the domain root, like a custom domain. A project repo without a
+	// site.url is served from /<repo>.
+	plan := &PublishPlan{
+		Target:      targetName,
+		Destination: deployer.Describe(),
+		opts:        opts,
+		projectDir:  projectDir,
+		config:      config,
+		deployer:    deployer,
+		outputDir:   filepath.Join(projectDir, "dist-publish"),
 	}
-
-	outputDir := filepath.Join(projectDir, "dist-publish")
-	err = BuildSite(config, projectDir, opts.ThemesFS, BuildOptions{
+	if gd, ok := deployer.(*gitDeployer); ok {
+		plan.pagesRepo = gd.repo
+	}
+	buildOpts := BuildOptions{
 		PublishMode:       true,
 		OutputDirOverride: "dist-publish",
-	})
+		Audience:          opts.Audience,
+	}
+	if plan.pagesRepo != "" && config.Site.CustomDomain == "" {
+		if isUserPagesRepo(plan.pagesRepo) {
+			buildOpts.NoBasePath = true
+		} else if !config.Site.HasURL() {
+			_, name, _ := strings.Cut(plan.pagesRepo, "/")
+			buildOpts.BasePath = "/" + name
+		}
+	}
+
+	// 3. Build
+	err = BuildSite(context.Background(), config, projectDir, opts.ThemesFS, buildOpts)
 	if err != nil {
 		return nil, fmt.Errorf("build failed: %w", err)
 	}
-
-	// 5. Deploy by pushing to gh-pages branch
-	if err := deployToGHPages(outputDir, repo); err != nil {
-		return nil, err
+	if plan.pagesRepo != "" && config.Site.CustomDomain != "" {
+		if err := os.WriteFile(filepath.Join(plan.outputDir, "CNAME"), []byte(config.Site.CustomDomain+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("write CNAME: %w", err)
+		}
 	}
 
-	// 6. Build result
-	parts := strings.SplitN(repo, "/", 2)
-	var url string
-	if len(parts) == 2 {
-		url = fmt.Sprintf("https://%s.github.io/%s/", parts[0], parts[1])
+	// 4. Compare with the deployed site
+	plan.manifest, err = BuildManifest(plan.outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("read build: %w", err)
 	}
-
-	return &PublishResult{
-		Repo:      repo,
-		OutputDir: outputDir,
-		URL:       url,
-	}, nil
+	plan.Fingerprint = plan.manifest.fingerprint()
+
+	var deployed *DeployManifest
+	baseline := "none"
+	if r, ok := deployer.(deployedReader); ok {
+		// An unreachable destination falls back to the manifest; the
+		// deploy itself reports the error.
+		if m, err := r.deployedManifest(); err == nil && m != nil {
+			deployed, baseline = m, "deployed"
+		}
+	}
+	recorded := LoadDeployManifest(projectDir, targetName)
+	if recorded != nil && recorded.Destination != plan.Destination {
+		recorded = nil
+	}
+	if deployed == nil && recorded != nil {
+		deployed, baseline = recorded, "manifest"
+	}
+	plan.Diff = DiffManifests(deployed, plan.manifest, config.Deploy.Preserve)
+	plan.Diff.Baseline = baseline
+	if recorded != nil {
+		plan.Diff.Since = recorded.Deployed
+	}
+	return plan, nil
 }
 
-// deployToGHPages pushes the contents of outputDir to the gh-pages branch of the repo.
-func deployToGHPages(outputDir, repo string) error {
-	// Get the authenticated HTTPS remote URL via gh
-	remoteURL := fmt.Sprintf("https://github.com/%s.git", repo)
+// Deploy sends the built site to the target and records it as the
+// target's deployed manifest.
+func (p *PublishPlan) Deploy() (*PublishResult, error) {
+	opts, config := p.opts, p.config
+	if opts.Expect != "" && opts.Expect != p.Fingerprint {
+		return nil, fmt.Errorf("the site changed since it was previewed; review the changes again before deploying")
+	}
 
-	// Use a temporary directory for the git operations
-	tmpDir, err := os.MkdirTemp("", "opendoc-deploy-*")
+	// 5. Deploy
+	message := opts.Message
+	if message == "" {
+		message = deployMessage(p.projectDir)
+	}
+	report, err := p.deployer.Deploy(p.outputDir, DeployOptions{DryRun: opts.DryRun, Message: message})
 	if err != nil {
-		return fmt.Errorf("create temp dir: %w", err)
+		return nil, err
 	}
-	defer os.RemoveAll(tmpDir)
-
-	// Helper to run git in tmpDir
-	git := func(args ...string) (string, error) {
-		cmd := exec.Command("git", args...)
-		cmd.Dir = tmpDir
-		out, err := cmd.CombinedOutput()
-		return strings.TrimSpace(string(out)), err
+	if !opts.DryRun {
+		p.manifest.Target = p.Target
+		p.manifest.Destination = p.Destination
+		p.manifest.Deployed = time.Now().UTC()
+		p.manifest.Commit = report.Commit
+		SaveDeployManifest(p.projectDir, p.manifest)
 	}
 
-	// Init a new repo
-	if _, err := git("init"); err != nil {
-		return fmt.Errorf("git init: %w", err)
+	// 6. Build result
+	result := &PublishResult{
+		Target:      p.Target,
+		Destination: p.Destination,
+		OutputDir:   p.outputDir,
+		Changes:     report.Changes,
+		Diff:        p.Diff,
+		Commit:      report.Commit,
+		DryRun:      opts.DryRun,
 	}
-
-	// Configure git user for the commit
-	git("config", "user.email", "opendoc@deploy")
-	git("config", "user.name", "OpenDoc Deploy")
-
-	// Copy dist-publish contents into the tmp repo
-	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, walkErr error) error {
-		if walkErr != nil || info.IsDir() {
-			return nil
+	switch p.deployer.(type) {
+	case *gitDeployer:
+		if p.pagesRepo != "" {
+			result.Repo = p.pagesRepo
+			result.URL = pagesURL(config, p.pagesRepo)
+		} else {
+			result.URL = publishedURL(config)
 		}
-		relPath, _ := filepath.Rel(outputDir, path)
-		destPath := filepath.Join(tmpDir, relPath)
-		os.MkdirAll(filepath.Dir(destPath), 0o755)
-		data, readErr := os.ReadFile(path)
-		if readErr != nil {
-			return readErr
+	case *rsyncDeployer, *s3Deployer:
+		result.URL = publishedURL(config)
+	}
+
+	// 7. Ask GitHub to serve the custom domain over HTTPS. The certificate
+	// is only issued once DNS points at GitHub, so this may fail on the
+	// first deploys; that isn't a deploy failure.
+	if p.pagesRepo != "" && config.Site.CustomDomain != "" && !opts.DryRun {
+		if err := enforcePagesHTTPS(p.pagesRepo, config.Site.CustomDomain); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("HTTPS is not enforced for %s yet (%v). GitHub issues a certificate once the domain's DNS points at GitHub Pages; enable it at https://github.com/%s/settings/pages", config.Site.CustomDomain, err, p.pagesRepo))
 		}
-		return os.WriteFile(destPath, data, 0o644)
-	})
-	if err != nil {
-		return fmt.Errorf("copy files: %w", err)
 	}
+	return result, nil
+}
 
-	// Add a .nojekyll file so GitHub serves raw HTML
-	os.WriteFile(filepath.Join(tmpDir, ".nojekyll"), []byte(""), 0o644)
+// isUserPagesRepo reports whether repo is a user or organisation pages
+// repository (owner/owner.github.io), which GitHub serves at the root.
+func isUserPagesRepo(repo string) bool {
+	owner, name, ok := strings.Cut(repo, "/")
+	return ok && strings.EqualFold(name, owner+".github.io")
+}
 
-	// Stage all files
-	if _, err := git("add", "-A"); err != nil {
-		return fmt.Errorf("git add: %w", err)
+// pagesURL returns the address a GitHub Pages site is served at: the
+// custom domain, the root of a user pages repo, or owner.github.io/repo/.
+func pagesURL(config *OpenDocConfig, repo string) string {
+	if config.Site.CustomDomain != "" {
+		return "https://" + config.Site.CustomDomain + "/"
 	}
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return ""
+	}
+	if isUserPagesRepo(repo) {
+		return fmt.Sprintf("https://%s.github.io/", strings.ToLower(owner))
+	}
+	return fmt.Sprintf("https://%s.github.io/%s/", strings.ToLower(owner), name)
+}
 
-	// Commit
-	if _, err := git("commit", "-m", "Deploy via OpenDoc"); err != nil {
-		return fmt.Errorf("git commit: %w", err)
+// publishedURL returns the address of a site deployed to a non-GitHub
+// target: the custom domain if set, otherwise site.url, or "" if unknown.
+func publishedURL(config *OpenDocConfig) string {
+	if config.Site.CustomDomain != "" {
+		return "https://" + config.Site.CustomDomain + "/"
+	}
+	if !config.Site.HasURL() {
+		return ""
 	}
+	return config.Site.URL
+}
 
-	// Force push to gh-pages branch
-	pushOut, err := git("push", "--force", remoteURL, "HEAD:gh-pages")
+// enforcePagesHTTPS sets the repository's Pages custom domain and turns on
+// HTTPS enforcement through the GitHub API.
+func enforcePagesHTTPS(repo, domain string) error {
+	out, err := exec.Command("gh", "api", "-X", "PUT", "repos/"+repo+"/pages",
+		"-f", "cname="+domain, "-F", "https_enforced=true").CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("git push failed: %s\n\nMake sure:\n  1. The repository %s exists\n  2. You have push access\n  3. Enable GitHub Pages (source: gh-pages branch) at:\n     https://github.com/%s/settings/pages", pushOut, repo, repo)
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("%s", msg)
 	}
-
 	return nil
 }
 
 // ── Helpers ─────────────────────────────────────────────────
 
+// deployMessage describes the source commit a deploy was built from, e.g.
+// "Deploy 3f2a1c9: Fix typo in install guide".
+func deployMessage(projectDir string) string {
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = projectDir
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	out, err := git("log", "-1", "--format=%h%x1f%H%x1f%s")
+	parts := strings.SplitN(out, "\x1f", 3)
+	if err != nil || len(parts) != 3 {
+		return "Deploy via OpenDoc"
+	}
+	subject := fmt.Sprintf("Deploy %s: %s", parts[0], parts[2])
+	if status, _ := git("status", "--porcelain", "--untracked-files=no"); status != "" {
+		subject += " (with uncommitted changes)"
+	}
+	return subject + "\n\nBuilt by OpenDoc from " + parts[1] + "."
+}
+
 // resolveRepo finds the GitHub repo from settings.json, app config, or git remote.
 func resolveRepo(projectDir string) string {
 	// Try settings.json first
@@ -0,0 +1,358 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ── Link rewriting ──────────────────────────────────────────
+
+var (
+	reInlineLink = regexp.MustCompile(`(\]\(\s*<?)([^)\s>]+)`)
+	reRefLink    = regexp.MustCompile(`(?m)^( {0,3}\[[^\]]+\]:\s*<?)(\S+?)(>?(?:\s|$))`)
+	reHTMLLink   = regexp.MustCompile(`(\b(?:href|src)\s*=\s*")([^"]+)`)
+	reCodeFence  = regexp.MustCompile("(?ms)^[ \t]*(```|~~~)[^\n]*\n.*?^[ \t]*(```|~~~)[ \t]*$")
+)
+
+// RelinkMoved updates links after files were moved within the project.
+// moves maps old paths to new ones, relative to projectDir with forward
+// slashes; the files must already be at their new paths.
+//
+// In every markdown file of each content tree (content.dir and the
+// languages' content_dir), links to a moved file are pointed at its new
+// location: site URLs (/guide/setup/, /static/a.png) and paths relative
+// to the linking file (../static/a.png, setup.md). Relative links of
+// moved files are adjusted to their new directory, and nav entries in
+// opendoc.yml follow moved pages and directories. It returns the files it
+// changed. Links inside fenced code blocks are left alone.
+func RelinkMoved(projectDir string, moves map[string]string) ([]string, error) {
+	config, err := LoadConfig(projectDir)
+	if err != nil {
+		config = &OpenDocConfig{Content: DefaultContent}
+	}
+
+	var changed []string
+	treeMoves := make(map[string]map[string]string) // tree dir → its moves
+	for _, tree := range contentTrees(config) {
+		m, c, err := relinkTree(projectDir, tree, moves)
+		changed = append(changed, c...)
+		if err != nil {
+			return changed, err
+		}
+		treeMoves[tree.dir] = m
+	}
+
+	// Nav entries name pages relative to their language's content tree.
+	configPath := filepath.Join(projectDir, "opendoc.yml")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return changed, nil
+	}
+	navMoves := func(lang string) map[string]string {
+		if l, ok := config.Languages[lang]; ok && l.ContentDir != "" {
+			return treeMoves[path.Clean(filepath.ToSlash(l.ContentDir))]
+		}
+		return treeMoves[path.Clean(filepath.ToSlash(config.Content.Dir))]
+	}
+	text := relinkNav(string(data), navMoves)
+	if text != string(data) {
+		if err := WriteFileAtomic(configPath, []byte(text)); err != nil {
+			return changed, err
+		}
+		if err := ProjectHistory(projectDir).RecordSave("opendoc.yml", data, []byte(text), "", "move"); err != nil && !errors.Is(err, ErrTooLargeForHistory) {
+			return changed, err
+		}
+		changed = append(changed, "opendoc.yml")
+	}
+	return changed, nil
+}
+
+// contentTree is a directory of pages and the URL prefix they are
+// served under.
+type contentTree struct {
+	dir    string // relative to the project, slash-separated
+	prefix string // "" or "/<language>"
+}
+
+// contentTrees lists content.dir and every language's own content_dir.
+func contentTrees(config *OpenDocConfig) []contentTree {
+	trees := []contentTree{{dir: path.Clean(filepath.ToSlash(config.Content.Dir))}}
+	for code, lang := range config.Languages {
+		if lang.ContentDir == "" {
+			continue
+		}
+		tree := contentTree{dir: path.Clean(filepath.ToSlash(lang.ContentDir))}
+		if code != config.Site.Language {
+			tree.prefix = "/" + code
+		}
+		if !slices.ContainsFunc(trees, func(t contentTree) bool { return t.dir == tree.dir }) {
+			trees = append(trees, tree)
+		}
+	}
+	return trees
+}
+
+// relinkTree rewrites the links in one content tree. It returns the moves
+// within the tree, relative to it, and the files it changed.
+func relinkTree(projectDir string, tree contentTree, moves map[string]string) (map[string]string, []string, error) {
+	contentDir := filepath.Join(projectDir, filepath.FromSlash(tree.dir))
+	oldOf := make(map[string]string, len(moves)) // new content path → old
+	urls := make(map[string]string)              // old site URL → new
+	contentMoves := make(map[string]string)      // old content path → new
+	for from, to := range moves {
+		f, okFrom := treeRel(from, tree.dir)
+		t, okTo := treeRel(to, tree.dir)
+		if !okFrom || !okTo {
+			continue
+		}
+		contentMoves[f] = t
+		oldOf[t] = f
+		urls[tree.prefix+contentURL(f)] = tree.prefix + contentURL(t)
+	}
+	if len(contentMoves) == 0 {
+		return nil, nil, nil
+	}
+
+	var changed []string
+	err := walkFiles(contentDir, func(rel string, info os.FileInfo) error {
+		if !strings.HasSuffix(rel, ".md") {
+			return nil
+		}
+		abs := filepath.Join(contentDir, filepath.FromSlash(rel))
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return err
+		}
+		oldRel := rel
+		if o, ok := oldOf[rel]; ok {
+			oldRel = o
+		}
+		rewrite := func(target string) string {
+			return relinkTarget(target, oldRel, rel, contentDir, contentMoves, urls)
+		}
+		text := rewriteLinks(string(data), rewrite)
+		if text == string(data) {
+			return nil
+		}
+		if err := WriteFileAtomic(abs, []byte(text)); err != nil {
+			return err
+		}
+		projectRel := path.Join(tree.dir, rel)
+		if err := ProjectHistory(projectDir).RecordSave(projectRel, data, []byte(text), "", "move"); err != nil && !errors.Is(err, ErrTooLargeForHistory) {
+			return err
+		}
+		changed = append(changed, projectRel)
+		return nil
+	})
+	return contentMoves, changed, err
+}
+
+// relinkNav points the entries of the top-level nav, and of each
+// language's nav, at moved pages and directories. movesFor gives the
+// moves within the content tree a language's nav is relative to ("" for
+// the top-level nav). Only the values are replaced, so the rest of the
+// file keeps its formatting.
+func relinkNav(text string, movesFor func(lang string) map[string]string) string {
+	var doc yaml.Node
+	if yaml.Unmarshal([]byte(text), &doc) != nil || len(doc.Content) == 0 {
+		return text
+	}
+	type edit struct {
+		start, end int
+		value      string
+	}
+	var edits []edit
+	lineStarts := []int{0}
+	for i, c := range text {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	relinkItems := func(nav *yaml.Node, moves map[string]string) {
+		if nav == nil || nav.Kind != yaml.SequenceNode || len(moves) == 0 {
+			return
+		}
+		for _, item := range nav.Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 1; i < len(item.Content); i += 2 {
+				v := item.Content[i]
+				if v.Kind != yaml.ScalarNode || v.Line < 1 || v.Line > len(lineStarts) {
+					continue
+				}
+				p, private := strings.CutSuffix(v.Value, "?")
+				to, ok := movedNavPath(p, moves)
+				if !ok {
+					continue
+				}
+				start := lineStarts[v.Line-1]
+				for n := 1; n < v.Column && start < len(text); n++ {
+					_, size := utf8.DecodeRuneInString(text[start:])
+					start += size
+				}
+				if v.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+					start++
+				}
+				if start+len(v.Value) > len(text) || text[start:start+len(v.Value)] != v.Value {
+					continue // written with escapes; leave it
+				}
+				if private {
+					to += "?"
+				}
+				edits = append(edits, edit{start, start + len(v.Value), to})
+			}
+		}
+	}
+
+	root := doc.Content[0]
+	relinkItems(mappingValue(root, "nav"), movesFor(""))
+	if langs := mappingValue(root, "languages"); langs != nil && langs.Kind == yaml.MappingNode {
+		for i := 1; i < len(langs.Content); i += 2 {
+			relinkItems(mappingValue(langs.Content[i], "nav"), movesFor(langs.Content[i-1].Value))
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		text = text[:e.start] + e.value + text[e.end:]
+	}
+	return text
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// movedNavPath returns where a nav path went: a moved page, or a
+// directory (writing/) whose files all moved to one new directory.
+func movedNavPath(p string, moves map[string]string) (string, bool) {
+	if to, ok := moves[p]; ok {
+		return to, true
+	}
+	dir := strings.TrimSuffix(p, "/")
+	if dir == "" || path.Ext(dir) == ".md" {
+		return "", false
+	}
+	newDir := ""
+	for from, to := range moves {
+		rest, ok := strings.CutPrefix(from, dir+"/")
+		if !ok {
+			continue
+		}
+		d, ok := strings.CutSuffix(to, "/"+rest)
+		if !ok || (newDir != "" && d != newDir) {
+			return "", false
+		}
+		newDir = d
+	}
+	if newDir == "" {
+		return "", false
+	}
+	return newDir + p[len(dir):], true
+}
+
+// rewriteLinks applies fn to the target of every link in a markdown
+// document outside fenced code blocks.
+func rewriteLinks(text string, fn func(string) string) string {
+	replace := func(re *regexp.Regexp, s string) string {
+		return re.ReplaceAllStringFunc(s, func(m string) string {
+			sub := re.FindStringSubmatchIndex(m)
+			return m[:sub[4]] + fn(m[sub[4]:sub[5]]) + m[sub[5]:]
+		})
+	}
+	var sb strings.Builder
+	last := 0
+	for _, loc := range append(reCodeFence.FindAllStringIndex(text, -1), []int{len(text), len(text)}) {
+		prose := text[last:loc[0]]
+		for _, re := range []*regexp.Regexp{reInlineLink, reRefLink, reHTMLLink} {
+			prose = replace(re, prose)
+		}
+		sb.WriteString(prose)
+		sb.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	return sb.String()
+}
+
+// relinkTarget returns the new form of one link target in the file now at
+// fileRel, which was at oldFileRel.
+func relinkTarget(target, oldFileRel, fileRel, contentDir string, moves, urls map[string]string) string {
+	if target == "" || strings.HasPrefix(target, "#") || strings.Contains(target, ":") {
+		return target // fragment, or a URL with a scheme
+	}
+	p, suffix := target, ""
+	if i := strings.IndexAny(target, "#?"); i >= 0 {
+		p, suffix = target[:i], target[i:]
+	}
+
+	if strings.HasPrefix(p, "/") {
+		key := p
+		if !strings.HasSuffix(key, "/") && path.Ext(key) == "" {
+			key += "/"
+		}
+		if to, ok := urls[key]; ok {
+			if !strings.HasSuffix(p, "/") && strings.HasSuffix(to, "/") && to != "/" {
+				to = strings.TrimSuffix(to, "/")
+			}
+			return to + suffix
+		}
+		return target
+	}
+
+	// A path relative to the linking file: only rewritten when it names a
+	// file, so relative page URLs are left alone.
+	old := path.Join(path.Dir(oldFileRel), p)
+	next := old
+	if to, ok := moves[old]; ok {
+		next = to
+	}
+	if next == old && path.Dir(oldFileRel) == path.Dir(fileRel) {
+		return target
+	}
+	if info, err := os.Stat(filepath.Join(contentDir, filepath.FromSlash(next))); err != nil || info.IsDir() {
+		return target
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(fileRel)), filepath.FromSlash(next))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel) + suffix
+}
+
+// treeRel returns a project path relative to the content tree in dir.
+func treeRel(projectRel, dir string) (string, bool) {
+	rel, ok := strings.CutPrefix(path.Clean(projectRel), dir+"/")
+	return rel, ok && rel != ""
+}
+
+// contentURL returns the site URL of a file under content/: pages get
+// their directory-style URL, other files are served as they are.
+func contentURL(rel string) string {
+	if !strings.HasSuffix(rel, ".md") {
+		return "/" + rel
+	}
+	stem := strings.TrimSuffix(rel, ".md")
+	if stem == "index" {
+		return "/"
+	}
+	return "/" + strings.TrimSuffix(stem, "/index") + "/"
+}
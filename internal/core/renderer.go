@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,20 +33,166 @@ var monthAbbr = []string{
 	"Jul", "Aug", "Sep", "Oct", "Nov", "Dec",
 }
 
+var dayNames = []string{
+	"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday",
+}
+var dayAbbr = []string{
+	"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat",
+}
+
+// DateLocale holds the month and weekday names used by StrftimeIn.
+// Weekdays start on Sunday, as in time.Weekday.
+type DateLocale struct {
+	Months      []string
+	MonthsShort []string
+	Days        []string
+	DaysShort   []string
+}
+
+// EnglishDates is the locale used by Strftime.
+var EnglishDates = &DateLocale{
+	Months:      monthNames,
+	MonthsShort: monthAbbr,
+	Days:        dayNames,
+	DaysShort:   dayAbbr,
+}
+
 // Strftime formats a date using Python-style format codes.
 func Strftime(t *time.Time, format string) string {
+	return StrftimeIn(t, format, EnglishDates)
+}
+
+// StrftimeIn formats a date like Strftime, with month and day names taken
+// from loc (nil = English).
+//
+// It supports the C89/POSIX codes (%a %A %b %B %c %d %e %F %H %I %j %m %M
+// %p %S %T %u %U %w %W %x %X %y %Y %z %Z %%) plus %G %V %s %f, and the
+// glibc "-" flag that drops zero padding (%-d, %-H, %-j, ...). Unknown codes
+// are left as written.
+func StrftimeIn(t *time.Time, format string, loc *DateLocale) string {
 	if t == nil {
 		return ""
 	}
+	if loc == nil {
+		loc = EnglishDates
+	}
 	d := *t
-	s := format
-	s = strings.ReplaceAll(s, "%B", monthNames[d.Month()-1])
-	s = strings.ReplaceAll(s, "%b", monthAbbr[d.Month()-1])
-	s = strings.ReplaceAll(s, "%d", fmt.Sprintf("%02d", d.Day()))
-	s = strings.ReplaceAll(s, "%m", fmt.Sprintf("%02d", int(d.Month())))
-	s = strings.ReplaceAll(s, "%Y", fmt.Sprintf("%d", d.Year()))
-	s = strings.ReplaceAll(s, "%y", fmt.Sprintf("%02d", d.Year()%100))
-	return s
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			b.WriteByte(c)
+			continue
+		}
+
+		start := i
+		i++
+		noPad := false
+		if format[i] == '-' && i+1 < len(format) {
+			noPad = true
+			i++
+		}
+
+		num := func(n, width int) string {
+			if noPad {
+				return strconv.Itoa(n)
+			}
+			return fmt.Sprintf("%0*d", width, n)
+		}
+
+		switch format[i] {
+		case 'a':
+			b.WriteString(loc.DaysShort[d.Weekday()])
+		case 'A':
+			b.WriteString(loc.Days[d.Weekday()])
+		case 'b', 'h':
+			b.WriteString(loc.MonthsShort[d.Month()-1])
+		case 'B':
+			b.WriteString(loc.Months[d.Month()-1])
+		case 'c':
+			b.WriteString(StrftimeIn(t, "%a %b %e %H:%M:%S %Y", loc))
+		case 'd':
+			b.WriteString(num(d.Day(), 2))
+		case 'e':
+			if noPad {
+				b.WriteString(strconv.Itoa(d.Day()))
+			} else {
+				fmt.Fprintf(&b, "%2d", d.Day())
+			}
+		case 'f':
+			b.WriteString(num(d.Nanosecond()/1000, 6))
+		case 'F':
+			b.WriteString(d.Format("2006-01-02"))
+		case 'G':
+			year, _ := d.ISOWeek()
+			b.WriteString(strconv.Itoa(year))
+		case 'H':
+			b.WriteString(num(d.Hour(), 2))
+		case 'I':
+			hour := d.Hour() % 12
+			if hour == 0 {
+				hour = 12
+			}
+			b.WriteString(num(hour, 2))
+		case 'j':
+			b.WriteString(num(d.YearDay(), 3))
+		case 'm':
+			b.WriteString(num(int(d.Month()), 2))
+		case 'M':
+			b.WriteString(num(d.Minute(), 2))
+		case 'n':
+			b.WriteByte('\n')
+		case 'p':
+			if d.Hour() < 12 {
+				b.WriteString("AM")
+			} else {
+				b.WriteString("PM")
+			}
+		case 's':
+			b.WriteString(strconv.FormatInt(d.Unix(), 10))
+		case 'S':
+			b.WriteString(num(d.Second(), 2))
+		case 't':
+			b.WriteByte('\t')
+		case 'T':
+			b.WriteString(d.Format("15:04:05"))
+		case 'u':
+			wd := int(d.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			b.WriteString(strconv.Itoa(wd))
+		case 'U':
+			// Week of the year, weeks starting on Sunday.
+			b.WriteString(num((d.YearDay()+6-int(d.Weekday()))/7, 2))
+		case 'V':
+			_, week := d.ISOWeek()
+			b.WriteString(num(week, 2))
+		case 'w':
+			b.WriteString(strconv.Itoa(int(d.Weekday())))
+		case 'W':
+			// Week of the year, weeks starting on Monday.
+			b.WriteString(num((d.YearDay()+6-(int(d.Weekday())+6)%7)/7, 2))
+		case 'x':
+			b.WriteString(d.Format("01/02/06"))
+		case 'X':
+			b.WriteString(d.Format("15:04:05"))
+		case 'y':
+			b.WriteString(num(d.Year()%100, 2))
+		case 'Y':
+			b.WriteString(strconv.Itoa(d.Year()))
+		case 'z':
+			b.WriteString(d.Format("-0700"))
+		case 'Z':
+			b.WriteString(d.Format("MST"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(format[start : i+1])
+		}
+	}
+	return b.String()
 }
 
 // Isoformat returns the ISO 8601 date string.
@@ -150,7 +297,9 @@ func generateTOC(htmlStr string) string {
 
 // TemplateEnv wraps a pongo2 template set for rendering.
 type TemplateEnv struct {
-	set *pongo2.TemplateSet
+	set    *pongo2.TemplateSet
+	exists func(name string) bool
+	read   func(name string) ([]byte, error)
 }
 
 // LoadTheme creates a template environment from the given theme name.
@@ -162,7 +311,14 @@ func LoadTheme(themeName string, customThemeDir string, themesFS fs.FS) (*Templa
 			loader := pongo2.MustNewLocalFileSystemLoader(customThemeDir)
 			set := pongo2.NewSet("custom", loader)
 			registerFilters(set)
-			return &TemplateEnv{set: set}, nil
+			exists := func(name string) bool {
+				_, err := os.Stat(filepath.Join(customThemeDir, name))
+				return err == nil
+			}
+			read := func(name string) ([]byte, error) {
+				return os.ReadFile(filepath.Join(customThemeDir, name))
+			}
+			return &TemplateEnv{set: set, exists: exists, read: read}, nil
 		}
 	}
 
@@ -177,7 +333,28 @@ func LoadTheme(themeName string, customThemeDir string, themesFS fs.FS) (*Templa
 
 	set := pongo2.NewSet("embedded", loader)
 	registerFilters(set)
-	return &TemplateEnv{set: set}, nil
+	exists := func(name string) bool {
+		_, err := fs.Stat(themesFS, filepath.ToSlash(filepath.Join(themeDir, name)))
+		return err == nil
+	}
+	read := func(name string) ([]byte, error) {
+		return fs.ReadFile(themesFS, filepath.ToSlash(filepath.Join(themeDir, name)))
+	}
+	return &TemplateEnv{set: set, exists: exists, read: read}, nil
+}
+
+// HasTemplate reports whether the theme provides the named template.
+func (env *TemplateEnv) HasTemplate(name string) bool {
+	return env.exists != nil && env.exists(name)
+}
+
+// ReadFile returns a raw (non-template) file from the theme, such as an
+// i18n string table.
+func (env *TemplateEnv) ReadFile(name string) ([]byte, error) {
+	if env.read == nil {
+		return nil, fs.ErrNotExist
+	}
+	return env.read(name)
 }
 
 // RenderTemplate renders a named template with the given context.
@@ -240,11 +417,15 @@ func filterIsoformat(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pon
 }
 
 func filterSlugify(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-	s := strings.ToLower(in.String())
+	return pongo2.AsValue(slugify(in.String())), nil
+}
+
+// slugify lowercases s and turns it into a URL path segment.
+func slugify(s string) string {
+	s = strings.ToLower(s)
 	s = regexp.MustCompile(`[^\w\s-]`).ReplaceAllString(s, "")
 	s = regexp.MustCompile(`\s+`).ReplaceAllString(s, "-")
-	s = strings.Trim(s, "-")
-	return pongo2.AsValue(s), nil
+	return strings.Trim(s, "-")
 }
 
 func filterReplace(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
@@ -125,4 +125,7 @@ Happy writing!
 const gitignoreContent = `dist/
 node_modules/
 .DS_Store
+.opendoc/cache/
+.opendoc/deploy/
+.opendoc/history/
 `
@@ -0,0 +1,394 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Search limits: files larger than this are skipped, and a search stops
+// after this many matches unless told otherwise.
+const (
+	maxSearchFileSize  = 2 << 20
+	defaultMaxMatches  = 1000
+	searchSnippetWidth = 160
+)
+
+// SkipWorkspaceEntry reports whether a file or directory is left out of
+// the workbench's view of a project: hidden entries, build output and
+// dependencies.
+func SkipWorkspaceEntry(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "dist" || name == "dist-publish" ||
+		name == "node_modules" || name == "__pycache__"
+}
+
+// ErrProtectedPath is returned for writes to a path ProtectedPath refuses.
+var ErrProtectedPath = errors.New("protected path")
+
+// ProtectedPath reports whether abs, a path in workspace, is one the
+// workbench must never read or write for its users: anything in a .git
+// directory, whose config and hooks git runs, or in .opendoc, where
+// version history is kept. Symlinks are followed, and a path that leads
+// out of the workspace is protected too.
+func ProtectedPath(workspace, abs string) bool {
+	rel, err := filepath.Rel(resolvedPath(workspace), resolvedPath(abs))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return true
+	}
+	lexical, err := filepath.Rel(workspace, abs)
+	if err != nil {
+		return true
+	}
+	for _, p := range []string{rel, lexical} {
+		for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+			if strings.EqualFold(part, ".git") || strings.EqualFold(part, ".opendoc") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SearchOptions describes a search across a project's files.
+type SearchOptions struct {
+	Query         string `json:"query"`
+	Regex         bool   `json:"regex"`          // Query is a regular expression
+	CaseSensitive bool   `json:"case_sensitive"` // default: ignore case
+	WholeWord     bool   `json:"whole_word"`
+	// Include and Exclude are globs matched against project-relative
+	// paths, e.g. "content/**/*.md"; a glob without a slash matches file
+	// names anywhere. With no Include every text file is searched.
+	Include    []string `json:"include,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	MaxMatches int      `json:"max_matches,omitempty"` // default 1000
+}
+
+// SearchMatch is one match. Line is 1-based; Column is the 1-based
+// offset in the line in UTF-16 code units and Length the match length in
+// the same units, as editors count them. Text is the line, shortened
+// around the match when it is long.
+type SearchMatch struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Length int    `json:"length"`
+	Text   string `json:"text"`
+}
+
+// SearchFile is a file with matches.
+type SearchFile struct {
+	Path    string        `json:"path"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// SearchResult is the outcome of a search. Truncated is set when it
+// stopped at MaxMatches.
+type SearchResult struct {
+	Files     []SearchFile `json:"files"`
+	Matches   int          `json:"matches"`
+	Truncated bool         `json:"truncated"`
+}
+
+// ReplaceFile is a file a replacement changes, with a unified diff of
+// the change.
+type ReplaceFile struct {
+	Path         string `json:"path"`
+	Replacements int    `json:"replacements"`
+	Diff         string `json:"diff"`
+}
+
+// ReplaceResult lists the files a replacement changed, or would change
+// on a dry run.
+type ReplaceResult struct {
+	Files        []ReplaceFile `json:"files"`
+	Replacements int           `json:"replacements"`
+	DryRun       bool          `json:"dry_run"`
+}
+
+// ErrEmptyQuery is returned for a search without a query.
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// ── Search ──────────────────────────────────────────────────
+
+// Search finds opts.Query in the text files of a project, skipping what
+// the workbench's file tree hides.
+func Search(projectDir string, opts SearchOptions) (*SearchResult, error) {
+	re, err := opts.compile()
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.MaxMatches
+	if limit <= 0 {
+		limit = defaultMaxMatches
+	}
+
+	result := &SearchResult{Files: []SearchFile{}}
+	err = searchFiles(projectDir, opts, func(rel string, text string) bool {
+		locs := re.FindAllStringIndex(text, -1)
+		if len(locs) == 0 {
+			return true
+		}
+		if room := limit - result.Matches; len(locs) > room {
+			locs = locs[:room]
+			result.Truncated = true
+		}
+		file := SearchFile{Path: rel}
+		for _, loc := range locs {
+			file.Matches = append(file.Matches, searchMatch(text, loc[0], loc[1]))
+		}
+		result.Files = append(result.Files, file)
+		result.Matches += len(locs)
+		return result.Matches < limit
+	})
+	return result, err
+}
+
+// Replace replaces every match of opts.Query with replacement. With a
+// regular expression, $1 and ${name} in replacement expand to submatches.
+// A dry run reports the changes without writing them.
+func Replace(projectDir string, opts SearchOptions, replacement string, dryRun bool) (*ReplaceResult, error) {
+	re, err := opts.compile()
+	if err != nil {
+		return nil, err
+	}
+	result := &ReplaceResult{Files: []ReplaceFile{}, DryRun: dryRun}
+	var writeErr error
+	err = searchFiles(projectDir, opts, func(rel string, text string) bool {
+		n := len(re.FindAllStringIndex(text, -1))
+		if n == 0 {
+			return true
+		}
+		var next string
+		if opts.Regex {
+			next = re.ReplaceAllString(text, replacement)
+		} else {
+			next = re.ReplaceAllLiteralString(text, replacement)
+		}
+		if next == text {
+			return true
+		}
+		if !dryRun {
+			abs := filepath.Join(projectDir, filepath.FromSlash(rel))
+			if ProtectedPath(projectDir, abs) {
+				writeErr = fmt.Errorf("writing %s: %w", rel, ErrProtectedPath)
+				return false
+			}
+			if err := WriteFileAtomic(abs, []byte(next)); err != nil {
+				writeErr = fmt.Errorf("writing %s: %w", rel, err)
+				return false
+			}
+			// A file too large for the history is still replaced, unrecorded.
+			if err := ProjectHistory(projectDir).RecordSave(rel, []byte(text), []byte(next), "", "replace"); err != nil && !errors.Is(err, ErrTooLargeForHistory) {
+				writeErr = fmt.Errorf("recording %s in the history: %w", rel, err)
+				return false
+			}
+		}
+		result.Files = append(result.Files, ReplaceFile{
+			Path:         rel,
+			Replacements: n,
+			Diff:         unifiedDiff("a/"+rel, "b/"+rel, text, next, 2),
+		})
+		result.Replacements += n
+		return true
+	})
+	if writeErr != nil {
+		return result, writeErr
+	}
+	return result, err
+}
+
+// FileWriteMu serialises the workbench's writes to project files, from
+// the file API, co-editing, replace and the chat assistant, so one
+// writer's check of a file and its write aren't interleaved with another's.
+var FileWriteMu sync.Mutex
+
+// WriteFileAtomic replaces a file through a hidden temporary file, so a
+// file watcher never reads it half-written.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// compile turns the options into a regular expression.
+func (opts SearchOptions) compile() (*regexp.Regexp, error) {
+	if opts.Query == "" {
+		return nil, ErrEmptyQuery
+	}
+	expr := opts.Query
+	if opts.Regex {
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+	} else {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.WholeWord {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if !opts.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile("(?m)" + expr)
+}
+
+// searchFiles calls fn with the text of each file the options select, in
+// path order, until fn returns false. Binary and very large files are
+// skipped.
+func searchFiles(projectDir string, opts SearchOptions, fn func(rel, text string) bool) error {
+	var paths []string
+	err := filepath.WalkDir(projectDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == projectDir {
+			return nil
+		}
+		if SkipWorkspaceEntry(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(projectDir, p)
+		rel = filepath.ToSlash(rel)
+		if (len(opts.Include) == 0 || matchAnyGlob(opts.Include, rel)) && !matchAnyGlob(opts.Exclude, rel) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, rel := range paths {
+		abs := filepath.Join(projectDir, filepath.FromSlash(rel))
+		if info, err := os.Stat(abs); err != nil || info.Size() > maxSearchFileSize {
+			continue
+		}
+		data, err := os.ReadFile(abs)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+			continue
+		}
+		if !fn(rel, string(data)) {
+			break
+		}
+	}
+	return nil
+}
+
+// searchMatch describes the match text[start:end].
+func searchMatch(text string, start, end int) SearchMatch {
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+	lineEnd := strings.IndexByte(text[start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(text)
+	} else {
+		lineEnd += start
+	}
+	line := strings.TrimSuffix(text[lineStart:lineEnd], "\r")
+
+	// A match running onto later lines is shown up to the line's end.
+	matchEnd := min(end, lineStart+len(line))
+	snippet := line
+	if len(line) > searchSnippetWidth {
+		from := max(0, start-lineStart-searchSnippetWidth/3)
+		to := min(len(line), from+searchSnippetWidth)
+		for from > 0 && !utf8.RuneStart(line[from]) {
+			from--
+		}
+		for to < len(line) && !utf8.RuneStart(line[to]) {
+			to++
+		}
+		snippet = line[from:to]
+		if from > 0 {
+			snippet = "…" + snippet
+		}
+		if to < len(line) {
+			snippet += "…"
+		}
+	}
+	return SearchMatch{
+		Line:   strings.Count(text[:start], "\n") + 1,
+		Column: utf16Len(text[lineStart:start]) + 1,
+		Length: utf16Len(text[start:max(start, matchEnd)]),
+		Text:   snippet,
+	}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// ── Globs ───────────────────────────────────────────────────
+
+func matchAnyGlob(globs []string, rel string) bool {
+	for _, g := range globs {
+		if matchGlob(strings.TrimSpace(g), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a glob in which "**"
+// spans directories. A glob without a slash matches the file name, and a
+// plain directory name matches everything inside it.
+func matchGlob(glob, rel string) bool {
+	glob = strings.Trim(glob, "/")
+	if glob == "" {
+		return false
+	}
+	if !strings.Contains(glob, "/") {
+		if ok, _ := path.Match(glob, path.Base(rel)); ok {
+			return true
+		}
+	}
+	if rel == glob || strings.HasPrefix(rel, glob+"/") {
+		return true
+	}
+	return matchGlobParts(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchGlobParts(glob, parts []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlobParts(glob[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], parts[0]); !ok {
+			return false
+		}
+		glob, parts = glob[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -12,8 +12,9 @@ import (
 // Secrets holds API keys and other sensitive configuration.
 // Stored at ~/.config/opendoc/secrets.yml — never in the project directory.
 type Secrets struct {
-	AnthropicKey string `yaml:"anthropic_api_key"`
-	OpenAIKey    string `yaml:"openai_api_key"`
+	AnthropicKey      string `yaml:"anthropic_api_key"`
+	OpenAIKey         string `yaml:"openai_api_key"`
+	PrivatePassphrase string `yaml:"private_passphrase"` // for build.private_mode: encrypt
 }
 
 // SecretsPath returns the path to the secrets file.
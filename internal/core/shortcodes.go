@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+	"github.com/yuin/goldmark"
+
+	"github.com/cottrellashley/opendoc/internal/core/extensions"
+)
+
+// shortcodesDir is where shortcode templates live, both in the project root
+// and inside a theme.
+const shortcodesDir = "shortcodes"
+
+// preOpenRe matches an opening <pre> tag in lower-cased HTML.
+var preOpenRe = regexp.MustCompile(`<pre[\s>]`)
+
+// Shortcodes resolves {{< name >}} shortcodes to templates and renders them
+// through the theme's TemplateEnv.
+type Shortcodes struct {
+	projectDir string
+	env        *TemplateEnv
+	md         goldmark.Markdown
+	cache      map[string]*pongo2.Template
+}
+
+// NewShortcodes creates a shortcode renderer. Project templates in
+// <projectDir>/shortcodes/ take precedence over the theme's shortcodes/.
+func NewShortcodes(projectDir string, env *TemplateEnv, md goldmark.Markdown) *Shortcodes {
+	return &Shortcodes{
+		projectDir: projectDir,
+		env:        env,
+		md:         md,
+		cache:      make(map[string]*pongo2.Template),
+	}
+}
+
+// Expand replaces every shortcode in the markdown body of sourcePath.
+// bodyLine is the line in sourcePath where body starts, so that errors
+// point at the right place in the original file.
+func (s *Shortcodes) Expand(body, sourcePath string, bodyLine int, ctx pongo2.Context) (string, error) {
+	out, err := extensions.PreprocessShortcodes(body, func(sc extensions.Shortcode) (string, error) {
+		return s.render(sc, ctx)
+	})
+	if err != nil {
+		var scErr *extensions.ShortcodeError
+		if errors.As(err, &scErr) {
+			line := scErr.Line + bodyLine - 1
+			return "", fmt.Errorf("%s:%d: shortcode %q: %w", s.relPath(sourcePath), line, scErr.Name, scErr.Err)
+		}
+		return "", fmt.Errorf("%s: %w", s.relPath(sourcePath), err)
+	}
+	return out, nil
+}
+
+func (s *Shortcodes) render(sc extensions.Shortcode, ctx pongo2.Context) (string, error) {
+	tpl, err := s.template(sc.Name)
+	if err != nil {
+		return "", err
+	}
+
+	args := make(map[string]any, len(sc.Args))
+	for k, v := range sc.Args {
+		args[k] = v
+	}
+
+	innerHTML := ""
+	if sc.Paired {
+		var buf strings.Builder
+		if err := s.md.Convert([]byte(sc.Inner), &buf); err != nil {
+			return "", fmt.Errorf("render inner markdown: %w", err)
+		}
+		innerHTML = buf.String()
+	}
+
+	out, err := tpl.Execute(mergePongoCtx(ctx, pongo2.Context{
+		"args":       args,
+		"positional": sc.Positional,
+		"inner":      sc.Inner,
+		"inner_html": innerHTML,
+	}))
+	if err != nil {
+		return "", err
+	}
+	return dropBlankLines(out), nil
+}
+
+// dropBlankLines removes whitespace-only lines from template output. A blank
+// line would end goldmark's raw HTML block and turn the indented remainder
+// of the snippet into a code block. Inside <pre>, where the line matters,
+// its newline is written as &#10; on the line before instead.
+func dropBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	pre := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+			lower := strings.ToLower(line)
+			pre += len(preOpenRe.FindAllString(lower, -1)) - strings.Count(lower, "</pre>")
+			if pre < 0 {
+				pre = 0
+			}
+			continue
+		}
+		if pre > 0 && len(kept) > 0 {
+			kept[len(kept)-1] += "&#10;" + line
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// template finds and compiles the named shortcode, caching the result.
+func (s *Shortcodes) template(name string) (*pongo2.Template, error) {
+	if tpl, ok := s.cache[name]; ok {
+		return tpl, nil
+	}
+
+	file := name + ".html"
+	var tpl *pongo2.Template
+
+	projectPath := filepath.Join(s.projectDir, shortcodesDir, file)
+	if data, err := os.ReadFile(projectPath); err == nil {
+		tpl, err = s.env.set.FromBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(shortcodesDir, file), err)
+		}
+	} else if themePath := shortcodesDir + "/" + file; s.env.HasTemplate(themePath) {
+		tpl, err = s.env.set.FromFile(themePath)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", themePath, err)
+		}
+	} else {
+		return nil, fmt.Errorf("unknown shortcode (no %s in project or theme)", filepath.Join(shortcodesDir, file))
+	}
+
+	s.cache[name] = tpl
+	return tpl, nil
+}
+
+func (s *Shortcodes) relPath(path string) string {
+	if rel, err := filepath.Rel(s.projectDir, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,373 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// ── Terms ───────────────────────────────────────────────────
+
+// Terms returns the entry's values for a taxonomy frontmatter key.
+func (e Entry) Terms(taxonomy string) []string {
+	if taxonomy == "tags" {
+		return e.Tags
+	}
+	return stringList(e.Meta[taxonomy])
+}
+
+// collectTerms groups entries by their terms for one taxonomy.
+func collectTerms(entries []Entry, taxonomy string) map[string][]Entry {
+	terms := make(map[string][]Entry)
+	for _, entry := range entries {
+		for _, term := range entry.Terms(taxonomy) {
+			terms[term] = append(terms[term], entry)
+		}
+	}
+	return terms
+}
+
+// termsFor returns the term index of a taxonomy, either site-wide
+// (collName == "") or for a single collection. Results are cached.
+func (b *siteBuild) termsFor(taxName, collName string) map[string][]Entry {
+	key := taxName + "\x00" + collName
+	if terms, ok := b.terms[key]; ok {
+		return terms
+	}
+
+	var entries []Entry
+	if collName == "" {
+		for _, name := range sortedKeys(b.collections) {
+			entries = append(entries, b.collections[name]...)
+		}
+	} else {
+		entries = b.collections[collName]
+	}
+
+	terms := collectTerms(entries, taxName)
+	b.terms[key] = terms
+	return terms
+}
+
+// termSlugsFor returns the URL slug of every term of a taxonomy. Terms
+// whose slug would be empty, or the same as an earlier term's ("C" and
+// "C++"), get one made unique with a hash of the name, and a collision
+// is reported as a warning.
+func (b *siteBuild) termSlugsFor(taxName, collName string) map[string]string {
+	key := taxName + "\x00" + collName
+	if slugs, ok := b.termSlugs[key]; ok {
+		return slugs
+	}
+
+	terms := b.termsFor(taxName, collName)
+	names := make([]string, 0, len(terms))
+	for name := range terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	slugs := make(map[string]string, len(names))
+	owner := make(map[string]string) // slug → term that has it
+	for _, name := range names {
+		slug := termSlug(name)
+		if slug == "" {
+			slug = termHashSlug(name)
+		} else if other, taken := owner[slug]; taken {
+			unique := termHashSlug(name)
+			b.warn(fmt.Sprintf("%s: terms '%s' and '%s' both have the slug '%s'; '%s' is at %s/",
+				taxonomyPath(taxName, collName), other, name, slug, name, unique))
+			slug = unique
+		}
+		owner[slug] = name
+		slugs[name] = slug
+	}
+	b.termSlugs[key] = slugs
+	return slugs
+}
+
+// termSlug turns a term into a URL path segment. ASCII terms keep their
+// slugify slug; others keep their letters and digits in any script.
+func termSlug(name string) string {
+	ascii := true
+	for _, r := range name {
+		if r >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return slugify(name)
+	}
+
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_':
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			dash = false
+			sb.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-':
+			dash = true
+		}
+	}
+	return sb.String()
+}
+
+// termHashSlug is a slug made from a hash of the term, for terms whose
+// own slug is empty or taken.
+func termHashSlug(name string) string {
+	base := slugify(name)
+	hash := ContentHash([]byte(name))[:8]
+	if base == "" {
+		return "term-" + hash
+	}
+	return base + "-" + hash
+}
+
+// taxonomyPath is the output path of a taxonomy, relative to the site root.
+func taxonomyPath(taxName, collName string) string {
+	if collName == "" {
+		return taxName
+	}
+	return collName + "/" + taxName
+}
+
+// ── Rendering ───────────────────────────────────────────────
+
+// renderTaxonomy writes the term index and one page per term. collName is
+// empty for site-wide taxonomies.
+func (b *siteBuild) renderTaxonomy(taxName string, tax TaxonomyConfig, collName string) error {
+	terms := b.termsFor(taxName, collName)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	relPath := taxonomyPath(taxName, collName)
+	taxMap := map[string]any{
+		"name":  taxName,
+		"label": tax.Label,
+		"url":   b.prefix + "/" + relPath + "/",
+	}
+
+	extra := pongo2.Context{"taxonomy": taxMap}
+	if collName != "" {
+		extra["collection"] = map[string]any{
+			"name":       collName,
+			"url_prefix": b.prefix + "/" + collName + "/",
+		}
+	}
+
+	names := make([]string, 0, len(terms))
+	for name := range terms {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	var termList []map[string]any
+	for _, name := range names {
+		termList = append(termList, b.termToMap(taxName, collName, name, terms[name]))
+	}
+
+	// Term index page
+	ctx := mergePongoCtx(b.siteCtx, mergePongoCtx(extra, pongo2.Context{
+		"terms": termList,
+	}))
+	rendered, err := b.env.RenderTemplate("taxonomy.html", ctx)
+	if err != nil {
+		return err
+	}
+	taxDir := filepath.Join(b.outputDir, filepath.FromSlash(relPath))
+	os.MkdirAll(taxDir, 0o755)
+	os.WriteFile(filepath.Join(taxDir, "index.html"), []byte(rendered), 0o644)
+
+	// Individual term pages
+	for _, term := range termList {
+		entries := terms[term["name"].(string)]
+		if tax.Ordered {
+			entries = seriesOrder(entries)
+		}
+		ctx := mergePongoCtx(b.siteCtx, mergePongoCtx(extra, pongo2.Context{
+			"term":    term,
+			"entries": entriesToListFormatted(entries, "%b %d, %Y", b.locale),
+		}))
+		rendered, err := b.env.RenderTemplate("term.html", ctx)
+		if err != nil {
+			return fmt.Errorf("term '%s': %w", term["name"], err)
+		}
+		termDir := filepath.Join(taxDir, term["slug"].(string))
+		os.MkdirAll(termDir, 0o755)
+		os.WriteFile(filepath.Join(termDir, "index.html"), []byte(rendered), 0o644)
+	}
+
+	return nil
+}
+
+func (b *siteBuild) termToMap(taxName, collName, name string, entries []Entry) map[string]any {
+	slug, ok := b.termSlugsFor(taxName, collName)[name]
+	if !ok { // an entry that isn't listed, like a draft in a preview
+		if slug = termSlug(name); slug == "" {
+			slug = termHashSlug(name)
+		}
+	}
+	return map[string]any{
+		"name":  name,
+		"slug":  slug,
+		"url":   b.prefix + "/" + taxonomyPath(taxName, collName) + "/" + slug + "/",
+		"count": len(entries),
+	}
+}
+
+// ── Entry context ───────────────────────────────────────────
+
+// entryTaxonomies returns, for one entry, its terms grouped by taxonomy
+// (with links to the term pages) and a navigation block for every ordered
+// taxonomy term (series) it belongs to.
+func (b *siteBuild) entryTaxonomies(entry Entry) (map[string][]map[string]any, []map[string]any) {
+	terms := make(map[string][]map[string]any)
+	var series []map[string]any
+
+	for _, taxName := range sortedKeys(b.config.Taxonomies) {
+		tax := b.config.Taxonomies[taxName]
+		names := entry.Terms(taxName)
+		if len(names) == 0 {
+			continue
+		}
+
+		collName := ""
+		if tax.Scope == "collection" {
+			collName = entry.Collection
+		}
+		index := b.termsFor(taxName, collName)
+
+		for _, name := range names {
+			term := b.termToMap(taxName, collName, name, index[name])
+			terms[taxName] = append(terms[taxName], term)
+
+			if tax.Ordered {
+				series = append(series, seriesNav(tax, term, seriesOrder(index[name]), entry))
+			}
+		}
+	}
+
+	return terms, series
+}
+
+// seriesOrder sorts a term's entries for reading in sequence: oldest first,
+// undated entries last, ties broken by title.
+func seriesOrder(entries []Entry) []Entry {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, dj := sorted[i].Date, sorted[j].Date
+		switch {
+		case di != nil && dj != nil && !di.Equal(*dj):
+			return di.Before(*dj)
+		case di != nil && dj == nil:
+			return true
+		case di == nil && dj != nil:
+			return false
+		}
+		return strings.ToLower(sorted[i].Title) < strings.ToLower(sorted[j].Title)
+	})
+	return sorted
+}
+
+func seriesNav(tax TaxonomyConfig, term map[string]any, entries []Entry, current Entry) map[string]any {
+	nav := map[string]any{
+		"taxonomy": tax.Label,
+		"name":     term["name"],
+		"url":      term["url"],
+		"total":    len(entries),
+	}
+
+	var list []map[string]any
+	for i, e := range entries {
+		m := entryToMap(e)
+		isCurrent := e.SourcePath == current.SourcePath
+		m["current"] = isCurrent
+		list = append(list, m)
+		if isCurrent {
+			nav["index"] = i + 1
+			if i > 0 {
+				nav["prev"] = entryToMap(entries[i-1])
+			}
+			if i+1 < len(entries) {
+				nav["next"] = entryToMap(entries[i+1])
+			}
+		}
+	}
+	nav["entries"] = list
+	return nav
+}
+
+// ── Related entries ─────────────────────────────────────────
+
+// relatedTaxonomies lists the frontmatter keys used to rank related
+// entries: tags plus every configured taxonomy.
+func (b *siteBuild) relatedTaxonomies() []string {
+	return append([]string{"tags"}, sortedKeys(b.config.Taxonomies)...)
+}
+
+// relatedEntries ranks the other entries of a collection by how many terms
+// they share with entries[i] across taxonomies. Entries sharing nothing are
+// left out; ties keep collection order. At most limit entries are returned.
+func relatedEntries(entries []Entry, i int, taxonomies []string, limit int) []Entry {
+	if limit <= 0 {
+		return nil
+	}
+
+	own := make(map[string]bool)
+	for _, tax := range taxonomies {
+		for _, term := range entries[i].Terms(tax) {
+			own[tax+"\x00"+strings.ToLower(term)] = true
+		}
+	}
+	if len(own) == 0 {
+		return nil
+	}
+
+	type scored struct {
+		entry Entry
+		score int
+	}
+	var candidates []scored
+	for j, e := range entries {
+		if j == i {
+			continue
+		}
+		score := 0
+		for _, tax := range taxonomies {
+			for _, term := range e.Terms(tax) {
+				if own[tax+"\x00"+strings.ToLower(term)] {
+					score++
+				}
+			}
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{e, score})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].score > candidates[b].score
+	})
+
+	var related []Entry
+	for _, c := range candidates {
+		if len(related) == limit {
+			break
+		}
+		related = append(related, c.entry)
+	}
+	return related
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is one line of a line diff: kept (' '), deleted ('-') or
+// inserted ('+').
+type diffOp struct {
+	Kind byte
+	Text string
+}
+
+// diffBudget bounds the work of one diff, in diagonals searched. Past it,
+// what remains is treated as replaced outright: a longer diff (or, when
+// merging, a conflict) rather than gigabytes and minutes for one large
+// rewrite.
+const diffBudget = 1 << 24
+
+// diffLines returns the shortest edit script turning a into b, using
+// Myers' O((N+M)D) algorithm in its linear-space form.
+func diffLines(a, b []string) []diffOp {
+	// Compare lines as numbers.
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{
+		a: intern(a), b: intern(b),
+		deleted: make([]bool, len(a)), inserted: make([]bool, len(b)),
+		vf: make([]int, size), vb: make([]int, size),
+		budget: diffBudget,
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	ops := make([]diffOp, 0, max(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		case j < len(b) && d.inserted[j]:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		}
+	}
+	return ops
+}
+
+// differ marks the lines of a deleted and of b inserted by a shortest edit
+// script. vf and vb hold the furthest reaching forward and backward paths
+// per diagonal, shared by every step of the recursion.
+type differ struct {
+	a, b              []int
+	deleted, inserted []bool
+	vf, vb            []int
+	budget            int
+}
+
+// compare diffs a[a0:a1] against b[b0:b1] by splitting both at the middle
+// snake of an optimal path and recursing into each half.
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		a0++
+		b0++
+	}
+	for a0 < a1 && b0 < b1 && d.a[a1-1] == d.b[b1-1] {
+		a1--
+		b1--
+	}
+	if a0 == a1 || b0 == b1 {
+		d.replace(a0, a1, b0, b1)
+		return
+	}
+	// With common ends stripped and both sides non-empty, at least two
+	// edits are needed, so each half needs fewer and the recursion ends.
+	x, y, u, v, ok := d.middleSnake(a0, a1, b0, b1)
+	if !ok {
+		d.replace(a0, a1, b0, b1)
+		return
+	}
+	d.compare(a0, x, b0, y)
+	d.compare(u, a1, v, b1)
+}
+
+// replace marks a[a0:a1] deleted and b[b0:b1] inserted.
+func (d *differ) replace(a0, a1, b0, b1 int) {
+	for i := a0; i < a1; i++ {
+		d.deleted[i] = true
+	}
+	for j := b0; j < b1; j++ {
+		d.inserted[j] = true
+	}
+}
+
+// middleSnake runs the search forwards from the start and backwards from
+// the end at once until the paths overlap, and returns the snake where they
+// meet: from (x, y) to (u, v). ok is false when the budget runs out.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int, ok bool) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	vf, vb := d.vf, d.vb
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for D := 0; D <= limit; D++ {
+		if d.budget -= 2 * (D + 1); d.budget < 0 {
+			return 0, 0, 0, 0, false
+		}
+
+		// Forward, on diagonals k = x - y.
+		for k := -D; k <= D; k += 2 {
+			var xs int
+			if k == -D || (k != D && vf[offset+k-1] < vf[offset+k+1]) {
+				xs = vf[offset+k+1] // down: insert from b
+			} else {
+				xs = vf[offset+k-1] + 1 // right: delete from a
+			}
+			ys := xs - k
+			xe, ye := xs, ys
+			for xe < n && ye < m && d.a[a0+xe] == d.b[b0+ye] {
+				xe++
+				ye++
+			}
+			vf[offset+k] = xe
+			if kr := delta - k; odd && kr >= -(D-1) && kr <= D-1 && xe+vb[offset+kr] >= n {
+				return a0 + xs, b0 + ys, a0 + xe, b0 + ye, true
+			}
+		}
+
+		// Backward, counting from the ends, on diagonals k = delta - (x - y).
+		for k := -D; k <= D; k += 2 {
+			var xs int
+			if k == -D || (k != D && vb[offset+k-1] < vb[offset+k+1]) {
+				xs = vb[offset+k+1]
+			} else {
+				xs = vb[offset+k-1] + 1
+			}
+			ys := xs - k
+			xe, ye := xs, ys
+			for xe < n && ye < m && d.a[a1-1-xe] == d.b[b1-1-ye] {
+				xe++
+				ye++
+			}
+			vb[offset+k] = xe
+			if kf := delta - k; !odd && kf >= -D && kf <= D && xe+vf[offset+kf] >= n {
+				return a1 - xe, b1 - ye, a1 - xs, b1 - ys, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false // not reached: the paths always meet
+}
+
+// unifiedDiff renders the difference between two texts in unified diff
+// format with the given lines of context. It returns "" when they are
+// equal.
+func unifiedDiff(oldName, newName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Group changes into hunks, merging those whose context overlaps.
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = run
+		}
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.Kind != '+' {
+				oldStart++
+			}
+			if op.Kind != '-' {
+				newStart++
+			}
+		}
+		oldLen, newLen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.Kind != '+' {
+				oldLen++
+			}
+			if op.Kind != '-' {
+				newLen++
+			}
+		}
+		if oldLen == 0 {
+			oldStart--
+		}
+		if newLen == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.Kind)
+			sb.WriteString(op.Text)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// splitLines splits text into lines without their line endings.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
@@ -0,0 +1,450 @@
+package core
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ── Roles ───────────────────────────────────────────────────
+
+// Role is what a workbench user may do. Each role includes the ones
+// before it: viewers read, editors change files and build, publishers
+// deploy, admins manage keys, integrations and the console.
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleEditor    Role = "editor"
+	RolePublisher Role = "publisher"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists every role, least privileged first.
+var Roles = []Role{RoleViewer, RoleEditor, RolePublisher, RoleAdmin}
+
+// ParseRole reads a role name.
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if string(r) == strings.ToLower(strings.TrimSpace(s)) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("invalid role '%s': must be one of viewer, editor, publisher, admin", s)
+}
+
+// Allows reports whether the role includes min.
+func (r Role) Allows(min Role) bool {
+	return r.rank() >= min.rank()
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// ── Users ───────────────────────────────────────────────────
+
+// User is a workbench account. Passwords and API tokens are only stored
+// hashed.
+type User struct {
+	Name     string     `yaml:"name"`
+	Role     Role       `yaml:"role"`
+	Password string     `yaml:"password"` // see hashPassword
+	Tokens   []APIToken `yaml:"tokens,omitempty"`
+	Created  time.Time  `yaml:"created"`
+}
+
+// APIToken grants a user's role to scripts calling the workbench API
+// with an "Authorization: Bearer" header.
+type APIToken struct {
+	Name    string    `yaml:"name"`
+	Hash    string    `yaml:"hash"` // SHA-256 of the token, hex
+	Created time.Time `yaml:"created"`
+}
+
+// passwordIterations is the PBKDF2-HMAC-SHA256 cost of password hashes.
+const passwordIterations = 600000
+
+// minPasswordLength is the shortest password accepted for an account.
+const minPasswordLength = 8
+
+// tokenPrefix marks workbench API tokens, so they are recognisable in
+// scripts and secret scanners.
+const tokenPrefix = "odt_"
+
+var reUserName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// UsersPath returns the path to the workbench user store. Like secrets,
+// it lives outside the project directory.
+func UsersPath() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "opendoc", "users.yml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".", ".opendoc", "users.yml")
+	}
+	return filepath.Join(home, ".config", "opendoc", "users.yml")
+}
+
+// UserStore is the file of workbench accounts. It is reloaded when the
+// file changes, so accounts edited with `opendoc user` apply to a running
+// workbench.
+type UserStore struct {
+	path    string
+	mu      sync.Mutex
+	users   []User
+	modTime time.Time
+}
+
+// OpenUserStore reads the user store at path. A missing file is an empty
+// store.
+func OpenUserStore(path string) (*UserStore, error) {
+	s := &UserStore{path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *UserStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.users, s.modTime = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Users []User `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	s.users, s.modTime = file.Users, info.ModTime()
+	return nil
+}
+
+// refresh reloads the store if the file changed since it was read. A file
+// that can't be read keeps the accounts already loaded.
+func (s *UserStore) refresh() {
+	info, err := os.Stat(s.path)
+	if err == nil && info.ModTime().Equal(s.modTime) {
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	s.load()
+}
+
+// save writes the store with owner-only permissions.
+func (s *UserStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create users dir: %w", err)
+	}
+	data, err := yaml.Marshal(map[string]any{"users": s.users})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("write users: %w", err)
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func (s *UserStore) find(name string) int {
+	for i, u := range s.users {
+		if u.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *UserStore) admins() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// Empty reports whether no account exists yet.
+func (s *UserStore) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	return len(s.users) == 0
+}
+
+// List returns every account.
+func (s *UserStore) List() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	return append([]User(nil), s.users...)
+}
+
+// Get returns the named account.
+func (s *UserStore) Get(name string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	if i := s.find(name); i >= 0 {
+		return s.users[i], true
+	}
+	return User{}, false
+}
+
+// ErrUsersExist is returned by AddFirstAdmin once any account exists.
+var ErrUsersExist = errors.New("an account already exists")
+
+// Add creates an account.
+func (s *UserStore) Add(name, password string, role Role) error {
+	return s.add(name, password, role, false)
+}
+
+// AddFirstAdmin creates an admin account if there are no accounts yet,
+// checking and adding in one step so only one first admin is made.
+func (s *UserStore) AddFirstAdmin(name, password string) error {
+	return s.add(name, password, RoleAdmin, true)
+}
+
+func (s *UserStore) add(name, password string, role Role, first bool) error {
+	if !reUserName.MatchString(name) {
+		return fmt.Errorf("invalid user name '%s': use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if role.rank() < 0 {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	if first && len(s.users) > 0 {
+		return ErrUsersExist
+	}
+	if s.find(name) >= 0 {
+		return fmt.Errorf("user '%s' already exists", name)
+	}
+	s.users = append(s.users, User{Name: name, Role: role, Password: hash, Created: time.Now().UTC()})
+	return s.save()
+}
+
+// Remove deletes an account. The last admin can't be removed.
+func (s *UserStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("no user '%s'", name)
+	}
+	if s.users[i].Role == RoleAdmin && s.admins() == 1 && len(s.users) > 1 {
+		return fmt.Errorf("'%s' is the last admin", name)
+	}
+	s.users = append(s.users[:i], s.users[i+1:]...)
+	return s.save()
+}
+
+// SetPassword replaces an account's password.
+func (s *UserStore) SetPassword(name, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("no user '%s'", name)
+	}
+	s.users[i].Password = hash
+	return s.save()
+}
+
+// SetRole changes an account's role. The last admin can't be demoted.
+func (s *UserStore) SetRole(name string, role Role) error {
+	if role.rank() < 0 {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("no user '%s'", name)
+	}
+	if s.users[i].Role == RoleAdmin && role != RoleAdmin && s.admins() == 1 {
+		return fmt.Errorf("'%s' is the last admin", name)
+	}
+	s.users[i].Role = role
+	return s.save()
+}
+
+// Authenticate checks a name and password. Unknown names take as long as
+// wrong passwords, so they can't be told apart.
+func (s *UserStore) Authenticate(name, password string) (User, bool) {
+	u, ok := s.Get(name)
+	if !ok {
+		checkPassword(dummyPasswordHash(), password)
+		return User{}, false
+	}
+	if !checkPassword(u.Password, password) {
+		return User{}, false
+	}
+	return u, true
+}
+
+// CreateToken adds a named API token to an account and returns it. Only
+// its hash is stored, so it can't be shown again.
+func (s *UserStore) CreateToken(user, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("token name is required")
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	i := s.find(user)
+	if i < 0 {
+		return "", fmt.Errorf("no user '%s'", user)
+	}
+	for _, t := range s.users[i].Tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("user '%s' already has a token named '%s'", user, name)
+		}
+	}
+	s.users[i].Tokens = append(s.users[i].Tokens, APIToken{Name: name, Hash: hashToken(token), Created: time.Now().UTC()})
+	return token, s.save()
+}
+
+// RevokeToken removes a named API token from an account.
+func (s *UserStore) RevokeToken(user, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	i := s.find(user)
+	if i < 0 {
+		return fmt.Errorf("no user '%s'", user)
+	}
+	for j, t := range s.users[i].Tokens {
+		if t.Name == name {
+			s.users[i].Tokens = append(s.users[i].Tokens[:j], s.users[i].Tokens[j+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("user '%s' has no token named '%s'", user, name)
+}
+
+// UserForToken returns the account an API token belongs to.
+func (s *UserStore) UserForToken(token string) (User, bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return User{}, false
+	}
+	hash := hashToken(token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	for _, u := range s.users {
+		for _, t := range u.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+				return u, true
+			}
+		}
+	}
+	return User{}, false
+}
+
+// ── Hashing ─────────────────────────────────────────────────
+
+// dummyPasswordHash is checked against when a user doesn't exist.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("opendoc-no-such-user")
+	return hash
+})
+
+// hashPassword returns "pbkdf2-sha256$<iterations>$<salt>$<key>" with
+// base64 salt and key.
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
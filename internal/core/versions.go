@@ -0,0 +1,237 @@
+package core
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// latestVersion is the output directory that mirrors the latest version.
+const latestVersion = "latest"
+
+// VersionLink is a built version as shown in the version switcher and
+// versions.json.
+type VersionLink struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Ref    string `json:"ref"`
+	URL    string `json:"url"`
+	Latest bool   `json:"latest"`
+}
+
+// ── Versioned build ─────────────────────────────────────────
+
+// BuildVersions builds every version in config.Versions from its git ref
+// into <output>/<name>/, and the latest version once more into
+// <output>/latest/. Each ref is built with its own opendoc.yml. The output
+// root gets versions.json and an index.html redirecting to /latest/.
+func BuildVersions(ctx context.Context, config *OpenDocConfig, projectDir string, themesFS fs.FS, options BuildOptions) error {
+	if len(config.Versions) == 0 {
+		return fmt.Errorf("no versions configured in opendoc.yml")
+	}
+
+	outputDirName := config.Build.OutputDir
+	if options.OutputDirOverride != "" {
+		outputDirName = options.OutputDirOverride
+	}
+	outputDir := filepath.Join(projectDir, outputDirName)
+
+	basePath := ""
+	if options.NoBasePath {
+		// Explicitly disabled
+	} else if options.BasePath != "" {
+		basePath = options.BasePath
+	} else if options.PublishMode {
+		basePath = publishBasePath(config)
+	}
+
+	// The project's path inside the repository, so refs are read from
+	// the same subdirectory.
+	cmd := exec.Command("git", "rev-parse", "--show-prefix")
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("versioned builds need a git repository: %w", err)
+	}
+	subdir := strings.TrimSuffix(strings.TrimSpace(string(out)), "/")
+
+	var links []VersionLink
+	for _, v := range config.Versions {
+		links = append(links, VersionLink{
+			Name:   v.Name,
+			Label:  v.Label,
+			Ref:    v.Ref,
+			URL:    basePath + "/" + v.Name + "/",
+			Latest: v.Latest,
+		})
+	}
+
+	if _, err := os.Stat(outputDir); err == nil {
+		os.RemoveAll(outputDir)
+	}
+	os.MkdirAll(outputDir, 0o755)
+
+	for _, v := range config.Versions {
+		if err := buildVersion(ctx, v, subdir, projectDir, outputDir, basePath, links, themesFS, options); err != nil {
+			return fmt.Errorf("version '%s': %w", v.Name, err)
+		}
+	}
+
+	// versions.json lets client-side code and other tools list versions.
+	data, _ := json.MarshalIndent(links, "", "  ")
+	os.WriteFile(filepath.Join(outputDir, "versions.json"), data, 0o644)
+
+	latestURL := basePath + "/" + latestVersion + "/"
+	redirect := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<meta http-equiv="refresh" content="0; url=%s">
+<link rel="canonical" href="%s">
+<title>Redirecting&hellip;</title>
+</head>
+<body><a href="%s">%s</a></body>
+</html>
+`, latestURL, latestURL, latestURL, latestURL)
+	os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(redirect), 0o644)
+
+	return nil
+}
+
+// buildVersion extracts the version's ref to a temporary directory and
+// builds it under <outputDir>/<name>/ (and /latest/ for the latest one).
+func buildVersion(
+	ctx context.Context,
+	v VersionConfig,
+	subdir, projectDir, outputDir, basePath string,
+	links []VersionLink,
+	themesFS fs.FS,
+	options BuildOptions,
+) error {
+	tmpDir, err := os.MkdirTemp("", "opendoc-version-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractRef(projectDir, v.Ref, subdir, tmpDir); err != nil {
+		return err
+	}
+	config, err := LoadConfig(tmpDir)
+	if err != nil {
+		return fmt.Errorf("ref '%s': %w", v.Ref, err)
+	}
+
+	dirs := []string{v.Name}
+	if v.Latest {
+		dirs = append(dirs, latestVersion)
+	}
+	for _, dir := range dirs {
+		opts := options
+		opts.BasePath = basePath + "/" + dir
+		opts.NoBasePath = false
+		opts.OutputDirOverride = ""
+		opts.Version = v.Name
+		opts.Versions = links
+		if options.Warn != nil {
+			opts.Warn = func(msg string) { options.Warn(v.Name + ": " + msg) }
+		}
+		if dir == latestVersion {
+			opts.Warn = nil // already reported for the named build
+		}
+
+		if err := BuildSite(ctx, config, tmpDir, themesFS, opts); err != nil {
+			return err
+		}
+		copyDir(filepath.Join(tmpDir, config.Build.OutputDir), filepath.Join(outputDir, dir))
+	}
+	return nil
+}
+
+// extractRef writes the files of subdir at a git ref into destDir, using
+// `git archive` so the working tree is left alone.
+func extractRef(projectDir, ref, subdir, destDir string) error {
+	treeish := ref
+	if subdir != "" {
+		treeish = ref + ":" + subdir
+	}
+	cmd := exec.Command("git", "archive", "--format=tar", treeish)
+	cmd.Dir = projectDir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	extractErr := untar(stdout, destDir)
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive %s: %s", treeish, strings.TrimSpace(stderr.String()))
+	}
+	return extractErr
+}
+
+// untar writes the directories and regular files of a tar stream into
+// destDir. Other entry types (symlinks, git submodules) are skipped.
+func untar(r io.Reader, destDir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("unsafe path in archive: %s", hdr.Name)
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(hdr.Name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			os.MkdirAll(filepath.Dir(target), 0o755)
+			f, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// versionsToList converts version links to template maps, marking the
+// version being built.
+func versionsToList(links []VersionLink, current string) []map[string]any {
+	var list []map[string]any
+	for _, v := range links {
+		list = append(list, map[string]any{
+			"name":    v.Name,
+			"label":   v.Label,
+			"url":     v.URL,
+			"latest":  v.Latest,
+			"current": v.Name == current,
+		})
+	}
+	return list
+}
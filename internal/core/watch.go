@@ -0,0 +1,138 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WatchConfig changes which files rebuild the workbench preview when
+// they change (watch: in opendoc.yml). Globs are relative to the project,
+// as in workspace search.
+type WatchConfig struct {
+	Include []string `yaml:"include"` // watched as well, e.g. "data/**"
+	Exclude []string `yaml:"exclude"` // ignored, e.g. "content/drafts/**"
+}
+
+// WatchSet is the files a project's build reads: opendoc.yml, the
+// author profiles, the content directories, shortcodes and i18n tables,
+// plus watch.include, less watch.exclude. Paths are slash-separated and relative to the
+// project.
+type WatchSet struct {
+	Roots   []string // files and directories whose whole tree is watched
+	Include []string
+	Exclude []string
+	output  []string // build output, never watched
+}
+
+// WatchSet returns the files whose changes should rebuild the site.
+func (c *OpenDocConfig) WatchSet() *WatchSet {
+	ws := &WatchSet{
+		Roots:   []string{"opendoc.yml", authorsDataFile, watchPath(c.Content.Dir), shortcodesDir, i18nDir},
+		Include: c.Watch.Include,
+		Exclude: c.Watch.Exclude,
+		output:  []string{watchPath(c.Build.OutputDir), "dist-publish"},
+	}
+	for _, code := range sortedKeys(c.Languages) {
+		if dir := c.Languages[code].ContentDir; dir != "" {
+			ws.Roots = append(ws.Roots, watchPath(dir))
+		}
+	}
+	return ws
+}
+
+func watchPath(dir string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(dir)), "./")
+}
+
+// Watches reports whether a change to rel matters to the build. Hidden
+// files, node_modules and the build output never do.
+func (ws *WatchSet) Watches(rel string) bool {
+	rel = watchPath(rel)
+	if rel == "." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") || part == "node_modules" {
+			return false
+		}
+	}
+	if slices.ContainsFunc(ws.output, func(out string) bool { return pathWithin(rel, out) }) ||
+		matchAnyGlob(ws.Exclude, rel) {
+		return false
+	}
+	return slices.ContainsFunc(ws.Roots, func(root string) bool { return pathWithin(rel, root) }) ||
+		matchAnyGlob(ws.Include, rel)
+}
+
+// Dirs returns the directories to watch for changes: the roots (or the
+// directory holding a root file), and the fixed part of each include
+// glob ("data" for "data/**/*.yml"). Some may not exist yet.
+func (ws *WatchSet) Dirs() []string {
+	var dirs []string
+	for _, d := range ws.Roots {
+		if d == authorsDataFile {
+			d = path.Dir(d)
+		}
+		if d != "opendoc.yml" && !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, g := range ws.Include {
+		var fixed []string
+		for _, part := range strings.Split(strings.Trim(g, "/"), "/") {
+			if strings.ContainsAny(part, "*?[") {
+				break
+			}
+			fixed = append(fixed, part)
+		}
+		if d := path.Join(fixed...); d != "" && !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// pathWithin reports whether rel is dir or inside it.
+func pathWithin(rel, dir string) bool {
+	return rel == dir || strings.HasPrefix(rel, dir+"/")
+}
+
+// ── Static fast path ────────────────────────────────────────
+
+// updateStatic copies changed user static files into an existing build
+// when nothing else changed, and reports whether it did. Deleted files
+// need a full build, which restores any theme file they shadowed.
+func updateStatic(config *OpenDocConfig, projectDir, outputDir string, options BuildOptions) bool {
+	if options.PublishMode {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, ".opendoc-build-id")); err != nil {
+		return false // no earlier preview build to update
+	}
+	static := path.Join(watchPath(config.Content.Dir), "static")
+	for _, rel := range options.ChangedFiles {
+		rel = watchPath(rel)
+		if !strings.HasPrefix(rel, static+"/") {
+			return false
+		}
+		if _, err := os.Stat(filepath.Join(projectDir, rel)); err != nil {
+			return false
+		}
+	}
+
+	progress := &buildProgress{report: options.Progress, projectDir: projectDir}
+	progress.send(BuildProgress{Phase: PhaseAssets})
+	for _, rel := range options.ChangedFiles {
+		rel = watchPath(rel)
+		dest := filepath.Join(outputDir, "static", filepath.FromSlash(strings.TrimPrefix(rel, static+"/")))
+		copyDir(filepath.Join(projectDir, filepath.FromSlash(rel)), dest) // copies a single file too
+	}
+	os.WriteFile(filepath.Join(outputDir, ".opendoc-build-id"), []byte(fmt.Sprintf("%d", time.Now().UnixMilli())), 0o644)
+	progress.send(BuildProgress{Phase: PhaseDone})
+	return true
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cottrellashley/opendoc/internal/core"
+)
+
+const (
+	sessionCookie   = "opendoc_session"
+	sessionLifetime = 7 * 24 * time.Hour
+	csrfHeader      = "X-CSRF-Token"
+
+	// Failed logins from one address before it has to wait.
+	maxLoginFailures = 10
+	loginLockout     = time.Minute
+)
+
+// ── Sessions ────────────────────────────────────────────────
+
+// Auth authenticates workbench requests: browser sessions (a cookie plus
+// a CSRF token sent back in a header) and API tokens. Sessions are kept
+// in memory, so a restart signs everyone out.
+type Auth struct {
+	users *core.UserStore
+	// SetupCode must accompany the creation of the first admin account
+	// while the user store is empty. It is printed when the server starts.
+	SetupCode string
+	// TrustProxy trusts X-Forwarded-Proto from a reverse proxy in front
+	// of the workbench when deciding whether the session cookie is Secure.
+	// Without it, only a direct TLS connection counts.
+	TrustProxy bool
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	failures map[string]*loginFailures
+}
+
+type session struct {
+	user    string
+	csrf    string
+	expires time.Time
+}
+
+type loginFailures struct {
+	count int
+	until time.Time
+}
+
+type userKey struct{}
+
+// NewAuth creates the authenticator for a user store.
+func NewAuth(users *core.UserStore) *Auth {
+	return &Auth{
+		users:     users,
+		SetupCode: randomToken(12),
+		sessions:  make(map[string]*session),
+		failures:  make(map[string]*loginFailures),
+	}
+}
+
+// Authenticate identifies the user of a request from an API token or a
+// session cookie, and stores it in the request context. Requests without
+// valid credentials pass through anonymously; requireRole rejects them.
+// Session requests that change state must carry the session's CSRF token.
+func (a *Auth) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			user, ok := a.users.UserForToken(strings.TrimSpace(token))
+			if !ok {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid API token"})
+				return
+			}
+			next.ServeHTTP(w, withUser(r, user))
+			return
+		}
+
+		sess := a.session(r)
+		if sess == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := a.users.Get(sess.user)
+		if !ok {
+			// The account was removed since signing in.
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !safeMethod(r.Method) && !a.isPublicAuthRoute(r) {
+			sent := r.Header.Get(csrfHeader)
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(sess.csrf)) != 1 {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "Missing or invalid CSRF token"})
+				return
+			}
+		}
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
+
+// session returns the live session of a request's cookie, if any.
+func (a *Auth) session(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sess, ok := a.sessions[cookie.Value]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(a.sessions, cookie.Value)
+		return nil
+	}
+	return sess
+}
+
+// startSession signs a user in and sets the session cookie.
+func (a *Auth) startSession(w http.ResponseWriter, r *http.Request, user core.User) *session {
+	id := randomToken(32)
+	sess := &session{user: user.Name, csrf: randomToken(32), expires: time.Now().Add(sessionLifetime)}
+
+	a.mu.Lock()
+	for key, s := range a.sessions {
+		if time.Now().After(s.expires) {
+			delete(a.sessions, key)
+		}
+	}
+	a.sessions[id] = sess
+	a.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || (a.TrustProxy && r.Header.Get("X-Forwarded-Proto") == "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return sess
+}
+
+// endSession signs the request's session out and clears the cookie.
+func (a *Auth) endSession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// isPublicAuthRoute reports whether a request signs in, which a stale
+// session cookie must not block.
+func (a *Auth) isPublicAuthRoute(r *http.Request) bool {
+	return r.URL.Path == "/api/auth/login" || r.URL.Path == "/api/auth/setup"
+}
+
+// ── Login throttling ────────────────────────────────────────
+
+// loginAllowed reports whether the address may try to sign in.
+func (a *Auth) loginAllowed(addr string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[addr]
+	return !ok || time.Now().After(f.until)
+}
+
+// loginFailed counts a failed login; too many lock the address out for a
+// while.
+func (a *Auth) loginFailed(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.failures[addr]
+	if !ok {
+		f = &loginFailures{}
+		a.failures[addr] = f
+	}
+	f.count++
+	if f.count >= maxLoginFailures {
+		f.count = 0
+		f.until = time.Now().Add(loginLockout)
+	}
+}
+
+func (a *Auth) loginSucceeded(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, addr)
+}
+
+// ── Authorization ───────────────────────────────────────────
+
+// requireRole returns middleware that admits signed-in users whose role
+// includes read for safe requests (GET, HEAD) and write for the others.
+func requireRole(read, write core.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := currentUser(r)
+			if !ok {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Sign in required"})
+				return
+			}
+			need := write
+			if safeMethod(r.Method) {
+				need = read
+			}
+			if !user.Role.Allows(need) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "This needs the " + string(need) + " role"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireCSRF guards GET endpoints with side effects, such as event
+// streams that start a process. EventSource can't send headers, so the
+// token may also come as the csrf query parameter.
+func (a *Auth) requireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess := a.session(r)
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			sent = r.URL.Query().Get("csrf")
+		}
+		if sess == nil || subtle.ConstantTimeCompare([]byte(sent), []byte(sess.csrf)) != 1 {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Missing or invalid CSRF token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentUser returns the user Authenticate found for the request.
+func currentUser(r *http.Request) (core.User, bool) {
+	user, ok := r.Context().Value(userKey{}).(core.User)
+	return user, ok
+}
+
+func withUser(r *http.Request, user core.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// ── Routes ──────────────────────────────────────────────────
+
+// AuthUser is the signed-in user as reported to the workbench UI.
+type AuthUser struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+// RegisterAuthRoutes adds the sign-in routes. They are open to everyone.
+func RegisterAuthRoutes(r chi.Router, a *Auth) {
+	// GET /api/auth/me — the signed-in user, or 401 with whether the
+	// first account still has to be created
+	r.Get("/api/auth/me", func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"error": "Sign in required",
+				"setup": a.users.Empty(),
+			})
+			return
+		}
+		me := AuthUser{Name: user.Name, Role: string(user.Role)}
+		if sess := a.session(r); sess != nil {
+			me.CSRFToken = sess.csrf
+		}
+		writeJSON(w, http.StatusOK, me)
+	})
+
+	// POST /api/auth/login — sign in with a name and password
+	r.Post("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}
+		if !decodeAuthRequest(w, r, &req) {
+			return
+		}
+		addr := clientAddr(r)
+		if !a.loginAllowed(addr) {
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Too many failed sign-ins. Try again in a minute."})
+			return
+		}
+		user, ok := a.users.Authenticate(strings.ToLower(strings.TrimSpace(req.Name)), req.Password)
+		if !ok {
+			a.loginFailed(addr)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Wrong user name or password"})
+			return
+		}
+		a.loginSucceeded(addr)
+		sess := a.startSession(w, r, user)
+		writeJSON(w, http.StatusOK, AuthUser{Name: user.Name, Role: string(user.Role), CSRFToken: sess.csrf})
+	})
+
+	// POST /api/auth/setup — create the first admin account
+	r.Post("/api/auth/setup", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Code     string `json:"code"`
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}
+		if !decodeAuthRequest(w, r, &req) {
+			return
+		}
+		if !a.users.Empty() {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "An account already exists. Sign in instead."})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(req.Code)), []byte(a.SetupCode)) != 1 {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Wrong setup code. It is printed in the workbench log."})
+			return
+		}
+		name := strings.ToLower(strings.TrimSpace(req.Name))
+		if err := a.users.AddFirstAdmin(name, req.Password); err != nil {
+			if errors.Is(err, core.ErrUsersExist) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "An account already exists. Sign in instead."})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		user, _ := a.users.Get(name)
+		sess := a.startSession(w, r, user)
+		writeJSON(w, http.StatusOK, AuthUser{Name: user.Name, Role: string(user.Role), CSRFToken: sess.csrf})
+	})
+
+	// POST /api/auth/logout — end the session
+	r.Post("/api/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		a.endSession(w, r)
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	})
+}
+
+// decodeAuthRequest reads a JSON sign-in request. Requiring a JSON content
+// type keeps other sites from submitting the form: browsers only send
+// that cross-origin after a CORS preflight, which the workbench refuses.
+func decodeAuthRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "Expected a JSON request"})
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return false
+	}
+	return true
+}
+
+// ── Helpers ─────────────────────────────────────────────────
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// clientAddr returns the address a request came from, without the port.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -15,103 +18,254 @@ import (
 	"github.com/cottrellashley/opendoc/internal/core"
 )
 
-// BuildManager handles build operations.
+// buildHistorySize is how many finished builds /api/opendoc/builds keeps.
+const buildHistorySize = 50
+
+// progressInterval limits build-progress events within one phase.
+const progressInterval = 100 * time.Millisecond
+
+// BuildManager runs the workbench's preview and publish builds. Each kind
+// runs one build at a time: requests made while a build is running wait
+// for a single follow-up build, shared by all of them, so changes saved
+// mid-build are always built.
 type BuildManager struct {
-	mu               sync.Mutex
-	building         bool
-	publishBuilding  bool
-	workspace        string
-	themesFS         fs.FS
-	sse              *SSEBroker
+	mu        sync.Mutex
+	preview   *buildQueue
+	publish   *buildQueue
+	history   []BuildRecord // ring of the last buildHistorySize builds
+	lastID    int64
+	workspace string
+	themesFS  fs.FS
+	sse       *SSEBroker
+}
+
+// BuildRecord describes a finished build.
+type BuildRecord struct {
+	ID       int64     `json:"id"`
+	Kind     string    `json:"kind"`     // "preview" or "publish"
+	Triggers []string  `json:"triggers"` // what asked for it ("api", "watcher", "chat"...), several when coalesced
+	Start    time.Time `json:"start"`
+	Duration int64     `json:"duration_ms"`
+	Outcome  string    `json:"outcome"` // success, failed or cancelled
+	Error    string    `json:"error,omitempty"`
+	Warnings int       `json:"warnings"`
+	Changed  []string  `json:"changed,omitempty"` // the files that changed, when known
+}
+
+// buildQueue is the running and the waiting build of one kind.
+type buildQueue struct {
+	kind    string
+	event   string // SSE event prefix
+	options core.BuildOptions
+	running *buildJob
+	pending *buildJob
+	cancel  context.CancelFunc // cancels the running build
+
+	// outputMu is held while anything writes the queue's output
+	// directory: its own builds, and deploys (see WithPublishOutput).
+	outputMu sync.Mutex
+}
+
+// buildJob is one build, and everyone waiting for it.
+type buildJob struct {
+	triggers []string
+	changed  []string // files changed since the last build
+	full     bool     // someone asked for a full build, not just of changed
+	done     chan struct{}
+	result   map[string]any
 }
 
 // NewBuildManager creates a new build manager.
 func NewBuildManager(workspace string, themesFS fs.FS, sse *SSEBroker) *BuildManager {
 	return &BuildManager{
+		// The workbench preview shows everything; drafts and scheduled
+		// entries are marked with badges by the theme.
+		preview: &buildQueue{kind: "preview", event: "build", options: core.BuildOptions{
+			IncludeDrafts:  true,
+			IncludeFuture:  true,
+			IncludeExpired: true,
+		}},
+		publish: &buildQueue{kind: "publish", event: "publish-build", options: core.BuildOptions{
+			PublishMode:       true,
+			OutputDirOverride: "dist-publish",
+			NoBasePath:        true, // Workbench preview uses its own path rewriting
+		}},
 		workspace: workspace,
 		themesFS:  themesFS,
 		sse:       sse,
 	}
 }
 
-// TriggerBuild runs a full site build.
-func (bm *BuildManager) TriggerBuild() map[string]any {
-	bm.mu.Lock()
-	if bm.building {
-		bm.mu.Unlock()
-		return map[string]any{"success": false, "error": "Build in progress", "time": time.Now().UnixMilli()}
-	}
-	bm.building = true
-	bm.mu.Unlock()
+// TriggerBuild runs a full site build, or waits for the one queued after
+// the build in progress. trigger says what asked for it, for the build
+// history.
+func (bm *BuildManager) TriggerBuild(trigger string) map[string]any {
+	return bm.enqueue(bm.preview, trigger, nil)
+}
 
-	bm.sse.Broadcast("build-start", map[string]any{"time": time.Now().UnixMilli()})
+// TriggerChangedBuild is TriggerBuild for a list of changed files, given
+// relative to the workspace. Changes to static assets alone are copied
+// into the preview instead of rebuilding it.
+func (bm *BuildManager) TriggerChangedBuild(trigger string, changed []string) map[string]any {
+	return bm.enqueue(bm.preview, trigger, changed)
+}
 
-	config, err := core.LoadConfig(bm.workspace)
-	if err != nil {
-		bm.mu.Lock()
-		bm.building = false
-		bm.mu.Unlock()
-		result := map[string]any{"success": false, "error": err.Error(), "time": time.Now().UnixMilli()}
-		bm.sse.Broadcast("build-complete", result)
-		return result
-	}
+// TriggerPublishBuild runs a publish-mode build, queued like TriggerBuild.
+func (bm *BuildManager) TriggerPublishBuild(trigger string) map[string]any {
+	return bm.enqueue(bm.publish, trigger, nil)
+}
 
-	err = core.BuildSite(config, bm.workspace, bm.themesFS, core.BuildOptions{})
+// WithPublishOutput runs fn, which builds into the publish output
+// directory itself, as publishing to a deploy target does, while no
+// publish build is running. Publish builds asked for meanwhile wait.
+func (bm *BuildManager) WithPublishOutput(fn func()) {
+	bm.publish.outputMu.Lock()
+	defer bm.publish.outputMu.Unlock()
+	fn()
+}
+
+// CancelBuild stops the running preview build. A build queued after it
+// still runs. It reports whether there was a build to stop.
+func (bm *BuildManager) CancelBuild() bool {
 	bm.mu.Lock()
-	bm.building = false
-	bm.mu.Unlock()
+	defer bm.mu.Unlock()
+	if bm.preview.cancel == nil {
+		return false
+	}
+	bm.preview.cancel()
+	return true
+}
 
-	if err != nil {
-		result := map[string]any{"success": false, "error": err.Error(), "time": time.Now().UnixMilli()}
-		bm.sse.Broadcast("build-complete", result)
-		return result
+// Builds returns the finished builds, newest first.
+func (bm *BuildManager) Builds() []BuildRecord {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	builds := make([]BuildRecord, len(bm.history))
+	for i, rec := range bm.history {
+		builds[len(builds)-1-i] = rec
 	}
+	return builds
+}
 
-	result := map[string]any{"success": true, "time": time.Now().UnixMilli()}
-	bm.sse.Broadcast("build-complete", result)
-	return result
+// Building reports whether a preview build is running, and whether
+// another is queued after it.
+func (bm *BuildManager) Building() (running, queued bool) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.preview.running != nil, bm.preview.pending != nil
 }
 
-// TriggerPublishBuild runs a publish-mode build.
-func (bm *BuildManager) TriggerPublishBuild() map[string]any {
+// enqueue waits for a build of q. changed is nil for a full build.
+func (bm *BuildManager) enqueue(q *buildQueue, trigger string, changed []string) map[string]any {
 	bm.mu.Lock()
-	if bm.publishBuilding {
-		bm.mu.Unlock()
-		return map[string]any{"success": false, "error": "Build in progress", "time": time.Now().UnixMilli()}
+	job := q.pending
+	switch {
+	case q.running == nil:
+		job = &buildJob{done: make(chan struct{})}
+		q.running = job
+		go bm.work(q)
+	case job == nil:
+		job = &buildJob{done: make(chan struct{})}
+		q.pending = job
+	}
+	if !slices.Contains(job.triggers, trigger) {
+		job.triggers = append(job.triggers, trigger)
+	}
+	if changed == nil {
+		job.full = true
+	}
+	for _, f := range changed {
+		if !slices.Contains(job.changed, f) {
+			job.changed = append(job.changed, f)
+		}
 	}
-	bm.publishBuilding = true
 	bm.mu.Unlock()
 
-	bm.sse.Broadcast("publish-build-start", map[string]any{"time": time.Now().UnixMilli()})
+	<-job.done
+	return job.result
+}
 
-	config, err := core.LoadConfig(bm.workspace)
-	if err != nil {
+// work runs the queue's builds until none is waiting.
+func (bm *BuildManager) work(q *buildQueue) {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
 		bm.mu.Lock()
-		bm.publishBuilding = false
+		job := q.running
+		q.cancel = cancel
 		bm.mu.Unlock()
-		result := map[string]any{"success": false, "error": err.Error(), "time": time.Now().UnixMilli()}
-		bm.sse.Broadcast("publish-build-complete", result)
-		return result
+
+		q.outputMu.Lock()
+		result := bm.build(ctx, q, job)
+		q.outputMu.Unlock()
+		cancel()
+
+		bm.mu.Lock()
+		q.cancel = nil
+		job.result = result
+		close(job.done)
+		q.running, q.pending = q.pending, nil
+		next := q.running
+		bm.mu.Unlock()
+		if next == nil {
+			return
+		}
+	}
+}
+
+// build runs one build and records it.
+func (bm *BuildManager) build(ctx context.Context, q *buildQueue, job *buildJob) map[string]any {
+	triggers := job.triggers
+	start := time.Now()
+	bm.sse.Broadcast(q.event+"-start", map[string]any{"time": start.UnixMilli(), "triggers": triggers})
+
+	warnings := []string{}
+	config, err := core.LoadConfig(bm.workspace)
+	if err == nil {
+		opts := q.options
+		opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+		opts.Progress = bm.progressRelay(q.event + "-progress")
+		if !job.full {
+			opts.ChangedFiles = job.changed
+		}
+		err = core.BuildSite(ctx, config, bm.workspace, bm.themesFS, opts)
 	}
 
-	err = core.BuildSite(config, bm.workspace, bm.themesFS, core.BuildOptions{
-		PublishMode:       true,
-		OutputDirOverride: "dist-publish",
-		NoBasePath:        true, // Workbench preview uses its own path rewriting
-	})
+	rec := BuildRecord{
+		Kind:     q.kind,
+		Triggers: triggers,
+		Start:    start,
+		Duration: time.Since(start).Milliseconds(),
+		Outcome:  "success",
+		Warnings: len(warnings),
+		Changed:  job.changed,
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		rec.Outcome, rec.Error = "cancelled", "Build cancelled"
+	case err != nil:
+		rec.Outcome, rec.Error = "failed", err.Error()
+	}
 
 	bm.mu.Lock()
-	bm.publishBuilding = false
+	bm.lastID++
+	rec.ID = bm.lastID
+	if len(bm.history) == buildHistorySize {
+		bm.history = append(bm.history[:0], bm.history[1:]...)
+	}
+	bm.history = append(bm.history, rec)
 	bm.mu.Unlock()
 
+	result := map[string]any{
+		"success":  err == nil,
+		"time":     time.Now().UnixMilli(),
+		"warnings": warnings,
+		"build":    rec,
+	}
 	if err != nil {
-		result := map[string]any{"success": false, "error": err.Error(), "time": time.Now().UnixMilli()}
-		bm.sse.Broadcast("publish-build-complete", result)
-		return result
+		result["error"] = rec.Error
+		result["cancelled"] = rec.Outcome == "cancelled"
 	}
-
-	result := map[string]any{"success": true, "time": time.Now().UnixMilli()}
-	bm.sse.Broadcast("publish-build-complete", result)
+	bm.sse.Broadcast(q.event+"-complete", result)
 	return result
 }
 
@@ -123,24 +277,26 @@ func RegisterBuildRoutes(r chi.Router, bm *BuildManager, workspace string) {
 
 	// Build API
 	r.Post("/api/opendoc/build", func(w http.ResponseWriter, r *http.Request) {
-		result := bm.TriggerBuild()
-		if result["success"] == true {
-			writeJSON(w, http.StatusOK, result)
-		} else {
-			writeJSON(w, http.StatusInternalServerError, result)
-		}
+		writeBuildResult(w, bm.TriggerBuild("api"))
+	})
+
+	r.Post("/api/opendoc/build/cancel", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]bool{"cancelled": bm.CancelBuild()})
+	})
+
+	r.Get("/api/opendoc/builds", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, bm.Builds())
 	})
 
 	r.Get("/api/opendoc/status", func(w http.ResponseWriter, r *http.Request) {
-		bm.mu.Lock()
-		building := bm.building
-		bm.mu.Unlock()
+		building, queued := bm.Building()
 
 		_, configExists := os.Stat(configFile)
 		_, distExists := os.Stat(distDir)
 
 		writeJSON(w, http.StatusOK, map[string]any{
 			"building":  building,
+			"queued":    queued,
 			"workspace": workspace,
 			"hasConfig": configExists == nil,
 			"hasDist":   distExists == nil,
@@ -149,12 +305,7 @@ func RegisterBuildRoutes(r chi.Router, bm *BuildManager, workspace string) {
 
 	// Publish build API
 	r.Post("/api/opendoc/publish-build", func(w http.ResponseWriter, r *http.Request) {
-		result := bm.TriggerPublishBuild()
-		if result["success"] == true {
-			writeJSON(w, http.StatusOK, result)
-		} else {
-			writeJSON(w, http.StatusInternalServerError, result)
-		}
+		writeBuildResult(w, bm.TriggerPublishBuild("api"))
 	})
 
 	// Preview serving
@@ -184,6 +335,34 @@ func RegisterBuildRoutes(r chi.Router, bm *BuildManager, workspace string) {
 	})
 }
 
+// progressRelay broadcasts a build's progress as the given event: each
+// new phase or collection, and within one at most every progressInterval.
+func (bm *BuildManager) progressRelay(event string) func(core.BuildProgress) {
+	var phase string
+	var sent time.Time
+	return func(p core.BuildProgress) {
+		key := p.Lang + "/" + p.Phase + "/" + p.Collection
+		if key == phase && time.Since(sent) < progressInterval {
+			return
+		}
+		phase, sent = key, time.Now()
+		bm.sse.Broadcast(event, p)
+	}
+}
+
+// writeBuildResult answers 200 for a build that succeeded, 409 for one
+// that was cancelled and 500 for one that failed.
+func writeBuildResult(w http.ResponseWriter, result map[string]any) {
+	switch {
+	case result["success"] == true:
+		writeJSON(w, http.StatusOK, result)
+	case result["cancelled"] == true:
+		writeJSON(w, http.StatusConflict, result)
+	default:
+		writeJSON(w, http.StatusInternalServerError, result)
+	}
+}
+
 // ── Preview HTML rewriting ──────────────────────────────────
 
 func servePreviewHTML(htmlPath, prefix string, w http.ResponseWriter) {
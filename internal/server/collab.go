@@ -0,0 +1,657 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+
+	"github.com/cottrellashley/opendoc/internal/core"
+	"github.com/cottrellashley/opendoc/internal/web"
+)
+
+// Co-edited files are written to disk once edits pause, and at least
+// this often while they don't, so the watcher rebuilds the site every few
+// seconds rather than on every keystroke.
+const (
+	collabIdleFlush = 2 * time.Second
+	collabMaxDelay  = 10 * time.Second
+)
+
+// collabSendBuffer is how many messages may queue for a client before it
+// is considered too slow and disconnected.
+const collabSendBuffer = 256
+
+// collabRecordEvery spaces out the version history of a co-edited file.
+const collabRecordEvery = 5 * time.Minute
+
+var errDocRemoved = errors.New("the file was deleted")
+
+// CollabHub runs the collaborative editing sessions of the workbench.
+// Each open file is a document held in memory: clients send their edits
+// as operations against a revision, the hub transforms them past edits
+// they hadn't seen yet, applies them and relays them to everyone else.
+type CollabHub struct {
+	workspace string
+	sse       *SSEBroker
+	upgrader  websocket.Upgrader
+
+	mu     sync.Mutex
+	docs   map[string]*collabDoc // by workspace-relative path
+	nextID int
+}
+
+// collabDoc is a file being co-edited.
+type collabDoc struct {
+	path string // relative to the workspace, slash-separated
+	abs  string
+
+	mu      sync.Mutex
+	text    []uint16 // UTF-16, matching the offsets browsers send
+	history []textOp // every operation since the document was opened
+	clients map[*collabClient]struct{}
+
+	// What is on disk: the text last read or written, and the hash of the
+	// file's bytes. The watcher compares with the hash to tell the
+	// document's own writes from changes made by something else.
+	savedText string
+	savedHash string
+
+	dirty      bool
+	dirtySince time.Time
+	flushTimer *time.Timer
+	removed    bool // the file was deleted; nothing more is written
+
+	// The version history, and the text last recorded in it.
+	versions     *core.History
+	recordedText string
+	recordedAt   time.Time
+}
+
+// collabClient is one browser tab editing a document.
+type collabClient struct {
+	id      int
+	name    string
+	canEdit bool
+	conn    *websocket.Conn
+	send    chan []byte
+	cursor  *collabCursor
+}
+
+// collabCursor is a selection; anchor == head for a plain cursor.
+type collabCursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// collabMsg is a message from a client.
+type collabMsg struct {
+	Type   string        `json:"type"` // "op", "cursor" or "save"
+	Rev    int           `json:"rev"`
+	Op     textOp        `json:"op,omitempty"`
+	Cursor *collabCursor `json:"cursor,omitempty"`
+}
+
+// CollabPresence lists who has a file open.
+type CollabPresence struct {
+	Path  string   `json:"path"`
+	Users []string `json:"users"`
+}
+
+// NewCollabHub creates the hub for a workspace. Presence changes are
+// broadcast to sse as "collab-presence" events.
+func NewCollabHub(workspace string, sse *SSEBroker) *CollabHub {
+	return &CollabHub{
+		workspace: workspace,
+		sse:       sse,
+		upgrader: websocket.Upgrader{
+			CheckOrigin:     web.SameOrigin,
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+		},
+		docs: make(map[string]*collabDoc),
+	}
+}
+
+// RegisterCollabRoutes adds the co-editing socket and the presence list.
+//
+//	GET /api/collab/ws?path=content/index.md   WebSocket session
+//	GET /api/collab/presence                  who is editing what
+//
+// Viewers may follow along; only editors' operations are accepted.
+func RegisterCollabRoutes(r chi.Router, hub *CollabHub) {
+	r.Get("/api/collab/presence", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hub.Presence())
+	})
+
+	r.Get("/api/collab/ws", func(w http.ResponseWriter, r *http.Request) {
+		relPath := filepath.ToSlash(filepath.Clean(r.URL.Query().Get("path")))
+		absPath := filepath.Join(hub.workspace, relPath)
+		if relPath == "." || !strings.HasPrefix(absPath, hub.workspace+string(filepath.Separator)) || core.ProtectedPath(hub.workspace, absPath) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+			return
+		}
+		if info, err := os.Stat(absPath); err != nil || !info.Mode().IsRegular() {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+			return
+		}
+		// Only files the watcher follows hear of changes made on disk
+		// while they are open; the rest are edited and saved as usual.
+		if !hub.watched(relPath) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not shared"})
+			return
+		}
+		user, _ := currentUser(r)
+
+		conn, err := hub.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("[collab] websocket upgrade error: %v", err)
+			return
+		}
+		hub.serve(conn, relPath, user)
+	})
+}
+
+// Presence lists the files being edited and by whom, sorted by path.
+func (h *CollabHub) Presence() []CollabPresence {
+	h.mu.Lock()
+	docs := make([]*collabDoc, 0, len(h.docs))
+	for _, d := range h.docs {
+		docs = append(docs, d)
+	}
+	h.mu.Unlock()
+
+	list := []CollabPresence{}
+	for _, d := range docs {
+		d.mu.Lock()
+		p := CollabPresence{Path: d.path, Users: []string{}}
+		seen := make(map[string]bool)
+		for c := range d.clients {
+			if !seen[c.name] {
+				seen[c.name] = true
+				p.Users = append(p.Users, c.name)
+			}
+		}
+		d.mu.Unlock()
+		sort.Strings(p.Users)
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// Editing returns who is co-editing relPath, or any file under it when it
+// is a directory.
+func (h *CollabHub) Editing(relPath string) []string {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	var users []string
+	for _, p := range h.Presence() {
+		if p.Path == relPath || strings.HasPrefix(p.Path, relPath+"/") {
+			users = append(users, p.Users...)
+		}
+	}
+	return users
+}
+
+// watched reports whether the watcher follows a file, as the project's
+// watch set says.
+func (h *CollabHub) watched(relPath string) bool {
+	config, err := core.LoadConfig(h.workspace)
+	if err != nil {
+		config = &core.OpenDocConfig{Content: core.DefaultContent, Build: core.DefaultBuild}
+	}
+	return config.WatchSet().Watches(relPath)
+}
+
+// FileChanged is called by the watcher when a file changed on disk. The
+// document's own writes are recognised and ignored; other changes are
+// merged into the open document and sent to its editors.
+func (h *CollabHub) FileChanged(relPath string, data []byte) {
+	h.mu.Lock()
+	d := h.docs[filepath.ToSlash(relPath)]
+	h.mu.Unlock()
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.removed && d.mergeDisk(data) {
+		d.markDirty()
+	}
+}
+
+// FileRemoved is called by the watcher when a file or directory was
+// removed. Documents for it are closed without writing them again.
+func (h *CollabHub) FileRemoved(relPath string) {
+	relPath = filepath.ToSlash(relPath)
+	h.mu.Lock()
+	var docs []*collabDoc
+	for p, d := range h.docs {
+		if p == relPath || strings.HasPrefix(p, relPath+"/") {
+			docs = append(docs, d)
+			delete(h.docs, p)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, d := range docs {
+		d.mu.Lock()
+		d.remove()
+		d.mu.Unlock()
+	}
+}
+
+// ── Sessions ────────────────────────────────────────────────
+
+// serve runs one client's session until its connection closes.
+func (h *CollabHub) serve(conn *websocket.Conn, relPath string, user core.User) {
+	defer conn.Close()
+
+	c := &collabClient{
+		name:    user.Name,
+		canEdit: user.Role.Allows(core.RoleEditor),
+		conn:    conn,
+		send:    make(chan []byte, collabSendBuffer),
+	}
+	d, err := h.join(relPath, c)
+	if err != nil {
+		conn.WriteJSON(map[string]string{"type": "error", "error": err.Error()})
+		return
+	}
+	go c.writeLoop()
+	h.broadcastPresence()
+
+	defer func() {
+		h.leave(d, c)
+		h.broadcastPresence()
+	}()
+
+	for {
+		var msg collabMsg
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "op":
+			if !c.canEdit {
+				c.sendJSON(map[string]string{"type": "error", "error": "This needs the editor role"})
+				continue
+			}
+			if err := d.receive(c, msg.Rev, msg.Op, msg.Cursor); err != nil {
+				// The client is out of step; it reconnects and starts over.
+				c.sendJSON(map[string]string{"type": "error", "error": err.Error()})
+				return
+			}
+		case "cursor":
+			if msg.Cursor != nil {
+				d.moveCursor(c, msg.Rev, *msg.Cursor)
+			}
+		case "save":
+			hash, err := d.flushNow()
+			if err != nil {
+				c.sendJSON(map[string]string{"type": "error", "error": err.Error()})
+				continue
+			}
+			c.sendJSON(map[string]any{"type": "saved", "hash": hash})
+		}
+	}
+}
+
+// join adds a client to the document for a file, reading the file if
+// nobody has it open yet.
+func (h *CollabHub) join(relPath string, c *collabClient) (*collabDoc, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	c.id = h.nextID
+	if d, ok := h.docs[relPath]; ok && !d.isRemoved() {
+		d.join(c)
+		return d, nil
+	}
+
+	abs := filepath.Join(h.workspace, filepath.FromSlash(relPath))
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	text := normalizeNewlines(string(data))
+	d := &collabDoc{
+		path:      relPath,
+		abs:       abs,
+		text:      utf16.Encode([]rune(text)),
+		clients:   make(map[*collabClient]struct{}),
+		savedText: text,
+		savedHash: core.ContentHash(data),
+
+		versions:     core.ProjectHistory(h.workspace),
+		recordedText: text,
+	}
+	h.docs[relPath] = d
+	d.join(c)
+	return d, nil
+}
+
+// leave removes a client. The last one out writes the document and
+// closes it.
+func (h *CollabHub) leave(d *collabDoc, c *collabClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.clients, c)
+	close(c.send)
+	d.broadcast(c, map[string]any{"type": "leave", "client": c.id})
+	if len(d.clients) > 0 {
+		return
+	}
+	if err := d.flush(true); err != nil {
+		log.Printf("[collab] Failed to save %s: %v", d.path, err)
+	}
+	if h.docs[d.path] == d {
+		delete(h.docs, d.path)
+	}
+}
+
+func (h *CollabHub) broadcastPresence() {
+	if h.sse != nil {
+		h.sse.Broadcast("collab-presence", h.Presence())
+	}
+}
+
+// ── Documents ───────────────────────────────────────────────
+
+// join adds a client and sends it the document and everyone on it.
+func (d *collabDoc) join(c *collabClient) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	peers := []map[string]any{}
+	for p := range d.clients {
+		peers = append(peers, map[string]any{"client": p.id, "name": p.name, "cursor": p.cursor})
+	}
+	d.clients[c] = struct{}{}
+	c.sendJSON(map[string]any{
+		"type":     "init",
+		"client":   c.id,
+		"rev":      len(d.history),
+		"content":  string(utf16.Decode(d.text)),
+		"readOnly": !c.canEdit,
+		"peers":    peers,
+	})
+	d.broadcast(c, map[string]any{"type": "join", "client": c.id, "name": c.name})
+}
+
+// receive applies a client's operation, made against revision rev. The
+// cursor, if any, is where the client's selection ended up after it.
+func (d *collabDoc) receive(c *collabClient, rev int, op textOp, cursor *collabCursor) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.removed {
+		return errDocRemoved
+	}
+
+	if rev < 0 || rev > len(d.history) {
+		return errOpLength
+	}
+	for _, concurrent := range d.history[rev:] {
+		var err error
+		var moved textOp
+		op, moved, err = transform(op, concurrent)
+		if err != nil {
+			return err
+		}
+		if cursor != nil {
+			cursor = &collabCursor{Anchor: moved.transformIndex(cursor.Anchor), Head: moved.transformIndex(cursor.Head)}
+		}
+	}
+	text, err := op.apply(d.text)
+	if err != nil {
+		return err
+	}
+
+	d.text = text
+	d.history = append(d.history, op)
+	d.moveCursors(op, c)
+	if cursor != nil {
+		c.cursor = cursor
+	}
+	d.markDirty()
+
+	c.sendJSON(map[string]any{"type": "ack", "rev": len(d.history)})
+	d.broadcast(c, map[string]any{"type": "op", "client": c.id, "rev": len(d.history), "op": op, "cursor": cursor})
+	return nil
+}
+
+// applyServerOp applies an edit made by the server itself, such as a
+// change merged in from disk, and sends it to every client.
+func (d *collabDoc) applyServerOp(op textOp) {
+	text, err := op.apply(d.text)
+	if err != nil {
+		return
+	}
+	d.text = text
+	d.history = append(d.history, op)
+	d.moveCursors(op, nil)
+	d.broadcast(nil, map[string]any{"type": "op", "client": 0, "rev": len(d.history), "op": op})
+}
+
+// mergeDisk merges the file's bytes on disk, when they changed since the
+// document last read or wrote them, with the unsaved edits since then.
+// It reports whether the result differs from the file.
+func (d *collabDoc) mergeDisk(data []byte) bool {
+	if core.ContentHash(data) == d.savedHash {
+		return false
+	}
+	disk := normalizeNewlines(string(data))
+	current := string(utf16.Decode(d.text))
+	m := core.Merge3(d.savedText, current, disk)
+	d.savedText, d.savedHash = disk, core.ContentHash(data)
+	if m.Conflicts > 0 {
+		log.Printf("[collab] %s changed on disk; %d conflicting edits are marked in the document", d.path, m.Conflicts)
+	}
+	if m.Text != current {
+		d.applyServerOp(replaceOp(d.text, utf16.Encode([]rune(m.Text))))
+	}
+	return m.Text != disk
+}
+
+// remove closes the document after its file was deleted. Its editors
+// keep their copy and go back to saving on their own.
+func (d *collabDoc) remove() {
+	if d.removed {
+		return
+	}
+	if d.flushTimer != nil {
+		d.flushTimer.Stop()
+		d.flushTimer = nil
+	}
+	d.removed, d.dirty = true, false
+	d.broadcast(nil, map[string]string{"type": "deleted"})
+}
+
+func (d *collabDoc) isRemoved() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.removed
+}
+
+// moveCursor records a client's selection, made at revision rev.
+func (d *collabDoc) moveCursor(c *collabClient, rev int, cursor collabCursor) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rev < 0 || rev > len(d.history) {
+		return
+	}
+	for _, op := range d.history[rev:] {
+		cursor = collabCursor{Anchor: op.transformIndex(cursor.Anchor), Head: op.transformIndex(cursor.Head)}
+	}
+	c.cursor = &cursor
+	d.broadcast(c, map[string]any{"type": "cursor", "client": c.id, "cursor": cursor})
+}
+
+// moveCursors shifts the recorded cursors of everyone but the author
+// through an applied operation.
+func (d *collabDoc) moveCursors(op textOp, author *collabClient) {
+	for c := range d.clients {
+		if c != author && c.cursor != nil {
+			c.cursor = &collabCursor{Anchor: op.transformIndex(c.cursor.Anchor), Head: op.transformIndex(c.cursor.Head)}
+		}
+	}
+}
+
+// broadcast sends a message to every client except one.
+func (d *collabDoc) broadcast(except *collabClient, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	for c := range d.clients {
+		if c != except {
+			c.queue(data)
+		}
+	}
+}
+
+// ── Persistence ─────────────────────────────────────────────
+
+// markDirty schedules a write once edits pause for collabIdleFlush, but
+// no later than collabMaxDelay after the first unsaved edit.
+func (d *collabDoc) markDirty() {
+	now := time.Now()
+	if !d.dirty {
+		d.dirty, d.dirtySince = true, now
+	}
+	delay := min(collabIdleFlush, d.dirtySince.Add(collabMaxDelay).Sub(now))
+	if d.flushTimer != nil {
+		d.flushTimer.Stop()
+	}
+	d.flushTimer = time.AfterFunc(max(delay, 0), func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if err := d.flush(false); err != nil {
+			log.Printf("[collab] Failed to save %s: %v", d.path, err)
+		}
+	})
+}
+
+// flushNow writes the document at once and returns the file's hash.
+func (d *collabDoc) flushNow() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.flush(true)
+	return d.savedHash, err
+}
+
+// flush writes unsaved edits to disk. The hash is recorded first, so the
+// watcher knows the write for the document's own.
+//
+// Autosaves go into the version history at most every collabRecordEvery;
+// a final flush, when the file is saved or closed, always records it.
+func (d *collabDoc) flush(final bool) error {
+	if d.removed {
+		return nil
+	}
+	if d.flushTimer != nil {
+		d.flushTimer.Stop()
+		d.flushTimer = nil
+	}
+	if d.dirty {
+		if err := d.write(); err != nil || d.removed {
+			return err
+		}
+	}
+	if d.savedText != d.recordedText && (final || time.Since(d.recordedAt) >= collabRecordEvery) {
+		if err := d.versions.RecordSave(d.path, []byte(d.recordedText), []byte(d.savedText), d.editors(), "co-edit"); err != nil {
+			log.Printf("[collab] Failed to record %s in the history: %v", d.path, err)
+		}
+		d.recordedText, d.recordedAt = d.savedText, time.Now()
+	}
+	return nil
+}
+
+// write saves the document. Changes made to the file since the document
+// last read or wrote it are merged in first, so a save from elsewhere is
+// never undone, and a file deleted meanwhile stays deleted.
+func (d *collabDoc) write() error {
+	core.FileWriteMu.Lock()
+	defer core.FileWriteMu.Unlock()
+
+	disk, err := os.ReadFile(d.abs)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		d.remove()
+		return nil
+	case err != nil:
+		return err
+	}
+	d.mergeDisk(disk)
+
+	text := string(utf16.Decode(d.text))
+	data := []byte(text)
+	d.savedText, d.savedHash = text, core.ContentHash(data)
+	if err := core.WriteFileAtomic(d.abs, data); err != nil {
+		return err
+	}
+	d.dirty = false
+	return nil
+}
+
+// editors names the people editing the document, for the history.
+func (d *collabDoc) editors() string {
+	var names []string
+	for c := range d.clients {
+		if c.canEdit && !slices.Contains(names, c.name) {
+			names = append(names, c.name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ── Clients ─────────────────────────────────────────────────
+
+func (c *collabClient) writeLoop() {
+	for data := range c.send {
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			c.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+func (c *collabClient) sendJSON(msg any) {
+	if data, err := json.Marshal(msg); err == nil {
+		c.queue(data)
+	}
+}
+
+// queue sends a message without blocking. A client that has fallen too
+// far behind is disconnected; it reconnects and starts from the current
+// document.
+func (c *collabClient) queue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		c.conn.Close()
+	}
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cottrellashley/opendoc/internal/core"
+)
+
+// Upload limits: the whole request, and each file in it.
+const (
+	maxUploadRequest = 100 << 20
+	maxUploadFile    = 25 << 20
+)
+
+// defaultUploadDir is where uploads go without a ?dir=.
+const defaultUploadDir = "content/static"
+
+// RegisterFileOpRoutes adds the file operations that go beyond reading and
+// writing one text file.
+//
+//	POST /api/fileops/move     {"from", "to", "rewrite_links"}
+//	POST /api/fileops/copy     {"from", "to"}
+//	POST /api/fileops/upload   multipart files, ?dir=content/static&overwrite=1
+//	GET  /api/fileops/export   zip of ?path= (default: the whole workspace), or ?build=1 for the build output
+//	GET  /api/fileops/download raw contents of the file at ?path=
+//
+// Files being co-edited can't be moved; collab may be nil.
+func RegisterFileOpRoutes(r chi.Router, workspace string, collab *CollabHub) {
+	// Move or rename a file or directory.
+	r.Post("/api/fileops/move", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			From         string `json:"from"`
+			To           string `json:"to"`
+			RewriteLinks bool   `json:"rewrite_links"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		from, to, ok := fileOpPaths(w, workspace, req.From, req.To)
+		if !ok {
+			return
+		}
+		if collab != nil {
+			if users := collab.Editing(req.From); len(users) > 0 {
+				writeJSON(w, http.StatusConflict, map[string]string{
+					"error": fmt.Sprintf("%s is being edited by %s", req.From, strings.Join(users, ", ")),
+				})
+				return
+			}
+		}
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+
+		moves, err := movedFiles(workspace, from, to)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		os.MkdirAll(filepath.Dir(to), 0o755)
+		if err := os.Rename(from, to); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		rewritten := []string{}
+		if req.RewriteLinks {
+			changed, err := core.RelinkMoved(workspace, moves)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Moved, but updating links failed: " + err.Error()})
+				return
+			}
+			rewritten = append(rewritten, changed...)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"from":      workspaceRel(workspace, from),
+			"to":        workspaceRel(workspace, to),
+			"moved":     len(moves),
+			"rewritten": rewritten,
+		})
+	})
+
+	// Copy a file or directory.
+	r.Post("/api/fileops/copy", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		from, to, ok := fileOpPaths(w, workspace, req.From, req.To)
+		if !ok {
+			return
+		}
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+
+		copied := 0
+		err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(from, path)
+			dst := filepath.Join(to, rel)
+			if d.IsDir() {
+				return os.MkdirAll(dst, 0o755)
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if err := copyFile(path, dst); err != nil {
+				return err
+			}
+			copied++
+			return nil
+		})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"from":   workspaceRel(workspace, from),
+			"to":     workspaceRel(workspace, to),
+			"copied": copied,
+		})
+	})
+
+	// Upload files, e.g. images into content/static.
+	r.Post("/api/fileops/upload", func(w http.ResponseWriter, r *http.Request) {
+		dirRel := r.URL.Query().Get("dir")
+		if dirRel == "" {
+			dirRel = defaultUploadDir
+		}
+		dir, ok := editablePath(workspace, dirRel)
+		if !ok {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+			return
+		}
+		overwrite := r.URL.Query().Get("overwrite") == "1"
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequest)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Expected a multipart upload"})
+			return
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		uploaded := []string{}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeUploadError(w, err, uploaded)
+				return
+			}
+			name := filepath.Base(part.FileName())
+			if part.FileName() == "" {
+				continue // an ordinary form field
+			}
+			if name == "." || strings.HasPrefix(name, ".") {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "Invalid file name: " + part.FileName(), "uploaded": uploaded})
+				return
+			}
+			dst := filepath.Join(dir, name)
+			if core.ProtectedPath(workspace, dst) {
+				writeJSON(w, http.StatusForbidden, map[string]any{"error": "Access denied: " + part.FileName(), "uploaded": uploaded})
+				return
+			}
+			if _, err := os.Stat(dst); err == nil && !overwrite {
+				writeJSON(w, http.StatusConflict, map[string]any{"error": workspaceRel(workspace, dst) + " already exists", "uploaded": uploaded})
+				return
+			}
+			tmp, err := receiveUpload(part, dir)
+			if err != nil {
+				writeUploadError(w, err, uploaded)
+				return
+			}
+			if err := placeUpload(workspace, r, tmp, dst, overwrite); err != nil {
+				os.Remove(tmp)
+				if errors.Is(err, fs.ErrExist) {
+					writeJSON(w, http.StatusConflict, map[string]any{"error": workspaceRel(workspace, dst) + " already exists", "uploaded": uploaded})
+					return
+				}
+				writeUploadError(w, err, uploaded)
+				return
+			}
+			uploaded = append(uploaded, workspaceRel(workspace, dst))
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"uploaded": uploaded})
+	})
+
+	// Download one file as it is on disk.
+	r.Get("/api/fileops/download", func(w http.ResponseWriter, r *http.Request) {
+		abs, ok := exportablePath(workspace, r.URL.Query().Get("path"))
+		if !ok {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+			return
+		}
+		f, err := os.Open(abs)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+			return
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+
+	// Download a directory, or the whole workspace, as a zip.
+	r.Get("/api/fileops/export", func(w http.ResponseWriter, r *http.Request) {
+		rel := r.URL.Query().Get("path")
+		if queryFlag(r.URL.Query().Get("build")) {
+			rel = core.DefaultBuild.OutputDir
+			if config, err := core.LoadConfig(workspace); err == nil {
+				rel = config.Build.OutputDir
+			}
+		}
+		root := workspace
+		if rel != "" {
+			var ok bool
+			if root, ok = exportablePath(workspace, rel); !ok {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+				return
+			}
+		}
+		info, err := os.Stat(root)
+		if err != nil || !info.IsDir() {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+			return
+		}
+
+		name := filepath.Base(workspace)
+		if rel != "" {
+			name += "-" + strings.ReplaceAll(filepath.ToSlash(filepath.Clean(rel)), "/", "-")
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+
+		// The zip streams as it is written; once it has started, errors
+		// can only cut it short.
+		zw := zip.NewWriter(w)
+		defer zw.Close()
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != root && skipExport(d.Name(), root == workspace) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			entry, _ := filepath.Rel(root, path)
+			return addZipFile(zw, path, filepath.ToSlash(entry))
+		})
+	})
+}
+
+// ── Helpers ─────────────────────────────────────────────────
+
+// workspacePath resolves a workspace-relative path, refusing paths that
+// leave the workspace or name it.
+func workspacePath(workspace, rel string) (string, bool) {
+	abs := filepath.Join(workspace, rel)
+	return abs, strings.HasPrefix(abs, workspace+string(filepath.Separator))
+}
+
+// editablePath is workspacePath for files people may read and change:
+// never the .git and .opendoc directories, or a symlink out of the
+// workspace (see core.ProtectedPath).
+func editablePath(workspace, rel string) (string, bool) {
+	abs, ok := workspacePath(workspace, rel)
+	return abs, ok && !core.ProtectedPath(workspace, abs)
+}
+
+func workspaceRel(workspace, abs string) string {
+	rel, _ := filepath.Rel(workspace, abs)
+	return filepath.ToSlash(rel)
+}
+
+// fileOpPaths checks the source and destination of a move or copy,
+// answering the request itself when they are unusable.
+func fileOpPaths(w http.ResponseWriter, workspace, fromRel, toRel string) (string, string, bool) {
+	from, okFrom := editablePath(workspace, fromRel)
+	to, okTo := editablePath(workspace, toRel)
+	if !okFrom || !okTo {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+		return "", "", false
+	}
+	if _, err := os.Stat(from); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+		return "", "", false
+	}
+	if _, err := os.Stat(to); err == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": workspaceRel(workspace, to) + " already exists"})
+		return "", "", false
+	}
+	if to == from || strings.HasPrefix(to, from+string(filepath.Separator)) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Can't move or copy a directory into itself"})
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// movedFiles lists the files a move will relocate, old path to new,
+// relative to the workspace.
+func movedFiles(workspace, from, to string) (map[string]string, error) {
+	moves := make(map[string]string)
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(from, path)
+		moves[workspaceRel(workspace, path)] = workspaceRel(workspace, filepath.Join(to, rel))
+		return nil
+	})
+	return moves, err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// errUploadTooLarge reports a file over maxUploadFile.
+var errUploadTooLarge = fmt.Errorf("file is larger than %d MB", maxUploadFile>>20)
+
+// receiveUpload writes one uploaded file to a new temporary file in dir,
+// so a failed upload leaves nothing behind, and returns its path.
+func receiveUpload(src io.Reader, dir string) (string, error) {
+	out, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(out, io.LimitReader(src, maxUploadFile+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxUploadFile {
+		err = errUploadTooLarge
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// placeUpload moves a received upload into place under the file write
+// lock, recording it in the history. It fails with fs.ErrExist if dst
+// was created meanwhile and overwrite isn't set.
+func placeUpload(workspace string, r *http.Request, tmp, dst string, overwrite bool) error {
+	core.FileWriteMu.Lock()
+	defer core.FileWriteMu.Unlock()
+
+	before, err := os.ReadFile(dst)
+	if err == nil && !overwrite {
+		return fs.ErrExist
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	if after, err := os.ReadFile(dst); err == nil {
+		recordSave(workspace, r, workspaceRel(workspace, dst), before, after)
+	}
+	return nil
+}
+
+func writeUploadError(w http.ResponseWriter, err error, uploaded []string) {
+	status := http.StatusInternalServerError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		err = fmt.Errorf("upload is larger than %d MB", maxUploadRequest>>20)
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, status, map[string]any{"error": err.Error(), "uploaded": uploaded})
+}
+
+// exportablePath resolves the directory to export, refusing any under a
+// hidden entry, like .git or .opendoc, just as those are left out of every
+// export. Build output can be exported when it is asked for.
+func exportablePath(workspace, rel string) (string, bool) {
+	abs, ok := workspacePath(workspace, rel)
+	if !ok || core.ProtectedPath(workspace, abs) {
+		return "", false
+	}
+	sub, _ := filepath.Rel(workspace, abs)
+	for _, name := range strings.Split(sub, string(filepath.Separator)) {
+		if skipExport(name, false) {
+			return "", false
+		}
+	}
+	return abs, true
+}
+
+// skipExport leaves hidden files (.git, .env, .opendoc) out of exports,
+// and build output and dependencies out of a workspace export.
+func skipExport(name string, workspaceRoot bool) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	return workspaceRoot && (name == "dist" || name == "dist-publish" || name == "node_modules")
+}
+
+func addZipFile(zw *zip.Writer, path, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	header.Modified = info.ModTime().Truncate(time.Second)
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
@@ -2,13 +2,16 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/cottrellashley/opendoc/internal/core"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -18,23 +21,36 @@ type FileTreeEntry struct {
 	Path     string           `json:"path"`
 	Type     string           `json:"type"` // "file" or "directory"
 	Ext      string           `json:"ext,omitempty"`
+	Git      string           `json:"git,omitempty"` // git status, when the workspace is a repository
 	Children []*FileTreeEntry `json:"children,omitempty"`
 }
 
 // RegisterFileRoutes adds file CRUD routes to the router.
+//
+// Reads return the file's content hash as an ETag. Writes and deletes
+// sent with If-Match fail with 409 Conflict when the file changed since;
+// a write that also carries the text it started from ("base") is merged
+// with the change on disk instead, and only conflicts if both touched the
+// same lines.
 func RegisterFileRoutes(r chi.Router, workspace string) {
 	// List files as a tree
 	r.Get("/api/files", func(w http.ResponseWriter, r *http.Request) {
 		tree := buildFileTree(workspace, workspace)
+		if status, err := gitStatus(workspace); err == nil && len(status.Files) > 0 {
+			files := make(map[string]string, len(status.Files))
+			for _, f := range status.Files {
+				files[f.Path] = f.Status
+			}
+			annotateGitStatus(tree, files)
+		}
 		writeJSON(w, http.StatusOK, tree)
 	})
 
 	// Read a file
 	r.Get("/api/files/*", func(w http.ResponseWriter, r *http.Request) {
 		relPath := chi.URLParam(r, "*")
-		absPath := filepath.Join(workspace, relPath)
-
-		if !strings.HasPrefix(absPath, workspace) {
+		absPath, ok := editablePath(workspace, relPath)
+		if !ok {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
 			return
 		}
@@ -51,9 +67,12 @@ func RegisterFileRoutes(r chi.Router, workspace string) {
 			return
 		}
 
+		hash := core.ContentHash(content)
+		w.Header().Set("ETag", etag(hash))
 		writeJSON(w, http.StatusOK, map[string]any{
 			"path":     relPath,
 			"content":  string(content),
+			"hash":     hash,
 			"size":     info.Size(),
 			"modified": info.ModTime(),
 		})
@@ -62,81 +81,132 @@ func RegisterFileRoutes(r chi.Router, workspace string) {
 	// Write/update a file
 	r.Put("/api/files/*", func(w http.ResponseWriter, r *http.Request) {
 		relPath := chi.URLParam(r, "*")
-		absPath := filepath.Join(workspace, relPath)
-
-		if !strings.HasPrefix(absPath, workspace) {
+		absPath, ok := editablePath(workspace, relPath)
+		if !ok {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
 			return
 		}
 
-		content, err := extractContent(r)
+		req, err := extractContent(r)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		content := req.Content
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+
+		current, readErr := os.ReadFile(absPath)
+		exists := readErr == nil
+		merged := false
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, current, exists) {
+			if req.Base == nil || !exists {
+				writeConflict(w, relPath, current, exists, content, nil)
+				return
+			}
+			m := core.Merge3(*req.Base, content, string(current))
+			if m.Conflicts > 0 {
+				writeConflict(w, relPath, current, exists, content, &m)
+				return
+			}
+			content, merged = m.Text, true
+		}
 
 		dir := filepath.Dir(absPath)
 		os.MkdirAll(dir, 0o755)
 
-		if err := os.WriteFile(absPath, []byte(content), 0o644); err != nil {
+		if err := core.WriteFileAtomic(absPath, []byte(content)); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
+		recordSave(workspace, r, relPath, current, []byte(content))
 
-		writeJSON(w, http.StatusOK, map[string]any{
+		hash := core.ContentHash([]byte(content))
+		w.Header().Set("ETag", etag(hash))
+		resp := map[string]any{
 			"path": relPath,
+			"hash": hash,
 			"size": len(content),
-		})
+		}
+		if merged {
+			resp["merged"] = true
+			resp["content"] = content
+		}
+		writeJSON(w, http.StatusOK, resp)
 	})
 
 	// Create a new file
 	r.Post("/api/files/*", func(w http.ResponseWriter, r *http.Request) {
 		relPath := chi.URLParam(r, "*")
-		absPath := filepath.Join(workspace, relPath)
-
-		if !strings.HasPrefix(absPath, workspace) {
+		absPath, ok := editablePath(workspace, relPath)
+		if !ok {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
 			return
 		}
 
-		if _, err := os.Stat(absPath); err == nil {
-			writeJSON(w, http.StatusConflict, map[string]string{"error": "File already exists"})
+		req, err := extractContent(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 
-		content, err := extractContent(r)
-		if err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+
+		if _, err := os.Stat(absPath); err == nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "File already exists"})
 			return
 		}
 
 		dir := filepath.Dir(absPath)
 		os.MkdirAll(dir, 0o755)
 
-		if err := os.WriteFile(absPath, []byte(content), 0o644); err != nil {
+		if err := core.WriteFileAtomic(absPath, []byte(req.Content)); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
+		recordSave(workspace, r, relPath, nil, []byte(req.Content))
 
-		writeJSON(w, http.StatusCreated, map[string]string{"path": relPath})
+		hash := core.ContentHash([]byte(req.Content))
+		w.Header().Set("ETag", etag(hash))
+		writeJSON(w, http.StatusCreated, map[string]string{"path": relPath, "hash": hash})
 	})
 
 	// Delete a file
 	r.Delete("/api/files/*", func(w http.ResponseWriter, r *http.Request) {
 		relPath := chi.URLParam(r, "*")
-		absPath := filepath.Join(workspace, relPath)
-
-		if !strings.HasPrefix(absPath, workspace) {
+		absPath, ok := editablePath(workspace, relPath)
+		if !ok {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
 			return
 		}
 
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+
 		info, err := os.Stat(absPath)
 		if err != nil {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
 			return
 		}
 
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !info.IsDir() {
+			if current, err := os.ReadFile(absPath); err == nil && !etagMatches(ifMatch, current, true) {
+				writeConflict(w, relPath, current, true, "", nil)
+				return
+			}
+		}
+
+		// Deleted files stay in the history, so they can be recovered.
+		if err := core.ProjectHistory(workspace).RecordDelete(relPath, userName(r), "editor"); err != nil {
+			if errors.Is(err, core.ErrTooLargeForHistory) || errors.Is(err, core.ErrProtectedPath) {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Not deleted: " + err.Error() + ". Delete it outside the workbench."})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Couldn't keep a copy in the history: " + err.Error()})
+			return
+		}
 		if info.IsDir() {
 			os.RemoveAll(absPath)
 		} else {
@@ -147,6 +217,19 @@ func RegisterFileRoutes(r chi.Router, workspace string) {
 	})
 }
 
+// recordSave adds a write made through the workbench to the version
+// history. A failure there doesn't fail the write.
+func recordSave(workspace string, r *http.Request, relPath string, before, after []byte) {
+	if err := core.ProjectHistory(workspace).RecordSave(relPath, before, after, userName(r), "editor"); err != nil {
+		log.Printf("[history] Failed to record %s: %v", relPath, err)
+	}
+}
+
+func userName(r *http.Request) string {
+	user, _ := currentUser(r)
+	return user.Name
+}
+
 // ── File tree builder ───────────────────────────────────────
 
 func buildFileTree(dir, root string) []*FileTreeEntry {
@@ -169,8 +252,7 @@ func buildFileTree(dir, root string) []*FileTreeEntry {
 	var result []*FileTreeEntry
 	for _, entry := range entries {
 		name := entry.Name()
-		if strings.HasPrefix(name, ".") || name == "dist" || name == "dist-publish" ||
-			name == "node_modules" || name == "__pycache__" {
+		if core.SkipWorkspaceEntry(name) {
 			continue
 		}
 
@@ -205,25 +287,77 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func extractContent(r *http.Request) (string, error) {
+// fileWrite is the body of a file write: the new content and, optionally,
+// the content it was edited from, which lets a stale write be merged.
+type fileWrite struct {
+	Content string  `json:"content"`
+	Base    *string `json:"base"`
+}
+
+func extractContent(r *http.Request) (fileWrite, error) {
 	ct := r.Header.Get("Content-Type")
 	if strings.HasPrefix(ct, "text/") {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			return "", err
+			return fileWrite{}, err
 		}
-		return string(body), nil
+		return fileWrite{Content: string(body)}, nil
 	}
 
-	var payload struct {
-		Content string `json:"content"`
-	}
+	var payload fileWrite
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		return "", err
+		return fileWrite{}, err
 	}
 	if err := json.Unmarshal(body, &payload); err != nil {
-		return string(body), nil
+		return fileWrite{Content: string(body)}, nil
+	}
+	return payload, nil
+}
+
+// ── Versions ────────────────────────────────────────────────
+
+func etag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// etagMatches reports whether an If-Match header matches the file's
+// current content. "*" matches any existing file.
+func etagMatches(header string, current []byte, exists bool) bool {
+	if !exists {
+		return false
+	}
+	hash := core.ContentHash(current)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || strings.Trim(tag, `"`) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConflict answers a stale write or delete with both versions: the
+// file as it is now ("content", "hash"; empty when it was deleted) and
+// the rejected one ("yours"). A failed merge adds the merged text with
+// conflict markers.
+func writeConflict(w http.ResponseWriter, relPath string, current []byte, exists bool, yours string, m *core.MergeResult) {
+	resp := map[string]any{
+		"error":   "The file was changed by someone else",
+		"path":    relPath,
+		"exists":  exists,
+		"content": string(current),
+		"hash":    "",
+		"yours":   yours,
+	}
+	if exists {
+		hash := core.ContentHash(current)
+		resp["hash"] = hash
+		w.Header().Set("ETag", etag(hash))
+	}
+	if m != nil {
+		resp["merged"] = m.Text
+		resp["conflicts"] = m.Conflicts
 	}
-	return payload.Content, nil
+	writeJSON(w, http.StatusConflict, resp)
 }
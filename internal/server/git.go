@@ -0,0 +1,583 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Local git commands finish quickly; pull and push talk to a remote.
+const (
+	gitTimeout       = 30 * time.Second
+	gitRemoteTimeout = 2 * time.Minute
+)
+
+// gitMu serialises the git commands that change the repository.
+var gitMu sync.Mutex
+
+// GitStatus is the state of the repository the workspace is in.
+type GitStatus struct {
+	Repo     bool            `json:"repo"` // false when the workspace isn't in a git repository
+	Branch   string          `json:"branch,omitempty"`
+	Detached bool            `json:"detached,omitempty"`
+	Upstream string          `json:"upstream,omitempty"`
+	Ahead    int             `json:"ahead"`
+	Behind   int             `json:"behind"`
+	Files    []GitFileStatus `json:"files"`
+}
+
+// GitFileStatus is a changed file, relative to the workspace. Index and
+// Worktree are git's two status letters ("M", "A", "D", "R", "U", "?" or
+// " "); Status sums them up for display.
+type GitFileStatus struct {
+	Path     string `json:"path"`
+	From     string `json:"from,omitempty"` // the old path of a rename
+	Index    string `json:"index"`
+	Worktree string `json:"worktree"`
+	Status   string `json:"status"` // modified, added, deleted, renamed, untracked or conflicted
+	Staged   bool   `json:"staged"` // has changes in the index
+}
+
+// GitBranch is a local or remote-tracking branch.
+type GitBranch struct {
+	Name     string `json:"name"`
+	Current  bool   `json:"current,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Remote   bool   `json:"remote,omitempty"`
+}
+
+// gitError carries git's own explanation of a failed command.
+type gitError struct {
+	args   []string
+	output string
+	err    error
+}
+
+func (e *gitError) Error() string {
+	if e.output != "" {
+		return e.output
+	}
+	return fmt.Sprintf("git %s: %v", e.args[0], e.err)
+}
+
+func (e *gitError) Unwrap() error { return e.err }
+
+// RegisterGitRoutes adds the workbench's git integration.
+//
+//	GET  /api/git/status               branch, ahead/behind and changed files
+//	GET  /api/git/diff?path=&staged=1  diff of one file
+//	GET  /api/git/branches             local and remote branches
+//	POST /api/git/stage   {"paths"}    add to the index ("all": true for everything)
+//	POST /api/git/unstage {"paths"}
+//	POST /api/git/commit  {"message", "all"}
+//	POST /api/git/checkout {"branch", "create"}
+//	POST /api/git/pull    {"remote", "branch"}
+//	POST /api/git/push    {"remote", "branch", "set_upstream"}
+//
+// Commits are authored by the workbench's user name setting, or else the
+// signed-in account. After each change the new status is broadcast as a
+// "git-status" event.
+func RegisterGitRoutes(r chi.Router, workspace string, sse *SSEBroker) {
+	broadcast := func() {
+		if status, err := gitStatus(workspace); err == nil {
+			sse.Broadcast("git-status", status)
+		}
+	}
+
+	r.Get("/api/git/status", func(w http.ResponseWriter, r *http.Request) {
+		status, err := gitStatus(workspace)
+		if err != nil {
+			writeGitError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+
+	r.Get("/api/git/diff", func(w http.ResponseWriter, r *http.Request) {
+		rel := r.URL.Query().Get("path")
+		if _, ok := workspacePath(workspace, rel); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "A file path is required"})
+			return
+		}
+		diff, err := gitDiff(workspace, rel, queryFlag(r.URL.Query().Get("staged")))
+		if err != nil {
+			writeGitError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"path": rel, "diff": diff})
+	})
+
+	r.Get("/api/git/branches", func(w http.ResponseWriter, r *http.Request) {
+		branches, err := gitBranches(workspace)
+		if err != nil {
+			writeGitError(w, err)
+			return
+		}
+		remotes, _ := runGit(r.Context(), workspace, "remote")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"branches": branches,
+			"remotes":  strings.Fields(remotes),
+		})
+	})
+
+	r.Post("/api/git/stage", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Paths []string `json:"paths"`
+			All   bool     `json:"all"`
+		}
+		if !decodeGitRequest(w, r, &req) {
+			return
+		}
+		args := []string{"add", "--all", "--"}
+		if !req.All {
+			if !checkGitPaths(w, workspace, req.Paths) {
+				return
+			}
+			args = append(args, req.Paths...)
+		} else {
+			args = append(args, ".")
+		}
+		runGitChange(w, r, workspace, broadcast, args...)
+	})
+
+	r.Post("/api/git/unstage", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Paths []string `json:"paths"`
+		}
+		if !decodeGitRequest(w, r, &req) || !checkGitPaths(w, workspace, req.Paths) {
+			return
+		}
+		// reset works before the first commit too, unlike restore --staged.
+		runGitChange(w, r, workspace, broadcast, append([]string{"reset", "-q", "--"}, req.Paths...)...)
+	})
+
+	r.Post("/api/git/commit", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Message string `json:"message"`
+			All     bool   `json:"all"` // stage every change first
+		}
+		if !decodeGitRequest(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "A commit message is required"})
+			return
+		}
+
+		gitMu.Lock()
+		defer gitMu.Unlock()
+		ctx, cancel := context.WithTimeout(r.Context(), gitTimeout)
+		defer cancel()
+		if req.All {
+			if _, err := runGit(ctx, workspace, "add", "--all", "--", "."); err != nil {
+				writeGitError(w, err)
+				return
+			}
+		}
+		env := gitAuthorEnv(ctx, workspace, commitAuthor(workspace, r))
+		if _, err := runGitEnv(ctx, workspace, env, "commit", "-q", "-m", req.Message); err != nil {
+			writeGitError(w, err)
+			return
+		}
+		commit, _ := runGit(ctx, workspace, "log", "-1", "--format=%H%x00%an%x00%s")
+		parts := strings.SplitN(commit, "\x00", 3)
+		go broadcast()
+		if len(parts) < 3 {
+			writeJSON(w, http.StatusOK, map[string]any{"committed": true})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"committed": true,
+			"commit":    parts[0],
+			"author":    parts[1],
+			"subject":   parts[2],
+		})
+	})
+
+	r.Post("/api/git/checkout", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Branch string `json:"branch"`
+			Create bool   `json:"create"`
+		}
+		if !decodeGitRequest(w, r, &req) {
+			return
+		}
+		if !validRefName(req.Branch) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid branch name"})
+			return
+		}
+		args := []string{"switch", req.Branch}
+		if req.Create {
+			args = []string{"switch", "-c", req.Branch}
+		}
+		runGitChange(w, r, workspace, broadcast, args...)
+	})
+
+	r.Post("/api/git/pull", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Remote string `json:"remote"`
+			Branch string `json:"branch"`
+		}
+		if !decodeGitRequest(w, r, &req) || !checkRemote(w, req.Remote, req.Branch) {
+			return
+		}
+		args := []string{"pull", "--no-rebase", "--no-edit"}
+		if req.Remote != "" {
+			args = append(args, req.Remote)
+			if req.Branch != "" {
+				args = append(args, req.Branch)
+			}
+		}
+		runGitRemote(w, r, workspace, broadcast, args...)
+	})
+
+	r.Post("/api/git/push", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Remote      string `json:"remote"`
+			Branch      string `json:"branch"`
+			SetUpstream bool   `json:"set_upstream"`
+		}
+		if !decodeGitRequest(w, r, &req) || !checkRemote(w, req.Remote, req.Branch) {
+			return
+		}
+		args := []string{"push"}
+		if req.SetUpstream {
+			args = append(args, "--set-upstream")
+		}
+		if req.Remote != "" {
+			args = append(args, req.Remote)
+			if req.Branch != "" {
+				args = append(args, req.Branch)
+			}
+		}
+		runGitRemote(w, r, workspace, broadcast, args...)
+	})
+}
+
+// ── Request helpers ─────────────────────────────────────────
+
+func decodeGitRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return false
+	}
+	return true
+}
+
+func checkGitPaths(w http.ResponseWriter, workspace string, paths []string) bool {
+	if len(paths) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "No paths given"})
+		return false
+	}
+	for _, p := range paths {
+		// A leading ":" would be read as pathspec magic, which can reach
+		// outside the workspace.
+		if _, ok := workspacePath(workspace, p); !ok || strings.HasPrefix(p, ":") {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied: " + p})
+			return false
+		}
+	}
+	return true
+}
+
+// reRemote accepts a remote name or a URL, but nothing git would read as
+// an option.
+var reRemote = regexp.MustCompile(`^[\w.@:/~+-]+$`)
+
+func checkRemote(w http.ResponseWriter, remote, branch string) bool {
+	if remote != "" && (strings.HasPrefix(remote, "-") || !reRemote.MatchString(remote)) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid remote"})
+		return false
+	}
+	if branch != "" && !validRefName(branch) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid branch name"})
+		return false
+	}
+	return true
+}
+
+// validRefName rejects names git wouldn't accept as a branch, any that
+// would be read as an option, and any that would mean more than a branch
+// where a refspec is expected: "+main" forces a push, and "@" and
+// "@{-1}" name HEAD and the branch checked out before.
+func validRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "+") || strings.Contains(name, "@{") {
+		return false
+	}
+	return exec.Command("git", "check-ref-format", "--branch", name).Run() == nil
+}
+
+// runGitChange runs a local command that changes the repository and
+// answers with the new status.
+func runGitChange(w http.ResponseWriter, r *http.Request, workspace string, broadcast func(), args ...string) {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), gitTimeout)
+	defer cancel()
+	if _, err := runGit(ctx, workspace, args...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	status, err := gitStatus(workspace)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	go broadcast()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// runGitRemote runs a pull or push, which never prompts for credentials:
+// it fails instead, with git's message. A merge made by a pull is
+// authored like a commit.
+func runGitRemote(w http.ResponseWriter, r *http.Request, workspace string, broadcast func(), args ...string) {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), gitRemoteTimeout)
+	defer cancel()
+	env := append(gitAuthorEnv(ctx, workspace, commitAuthor(workspace, r)), "GIT_TERMINAL_PROMPT=0")
+	out, err := runGitEnv(ctx, workspace, env, args...)
+	go broadcast()
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"output": out})
+}
+
+func writeGitError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var gerr *gitError
+	if errors.As(err, &gerr) {
+		// git ran and refused: a conflict, nothing to commit, an unknown
+		// branch and so on.
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// commitAuthor is the name commits are made under.
+func commitAuthor(workspace string, r *http.Request) string {
+	if name := loadSettings(workspace).UserName; name != "" {
+		return name
+	}
+	return userName(r)
+}
+
+// gitAuthorEnv sets the author and committer name, keeping the email
+// from git's config when it has one.
+func gitAuthorEnv(ctx context.Context, workspace, name string) []string {
+	if name == "" {
+		return nil
+	}
+	env := []string{"GIT_AUTHOR_NAME=" + name, "GIT_COMMITTER_NAME=" + name}
+	if email, _ := runGit(ctx, workspace, "config", "user.email"); email == "" {
+		env = append(env, "GIT_AUTHOR_EMAIL=", "GIT_COMMITTER_EMAIL=")
+	}
+	return env
+}
+
+// ── Git ─────────────────────────────────────────────────────
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return runGitEnv(ctx, dir, nil, args...)
+}
+
+// gitSafeConfig keeps the workbench's git from running anything the
+// repository's config or hooks name: status, commit and pull would
+// otherwise run them on the server.
+var gitSafeConfig = []string{"-c", "core.hooksPath=" + os.DevNull, "-c", "core.fsmonitor=false"}
+
+func runGitEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append(append([]string(nil), gitSafeConfig...), args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", &gitError{args: args, output: strings.TrimSpace(out.String()), err: err}
+		}
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// gitStatus reads the repository's status. Paths are made relative to
+// the workspace, which may be a subdirectory of the repository; changes
+// outside it are left out.
+func gitStatus(workspace string) (*GitStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	prefix, err := runGit(ctx, workspace, "rev-parse", "--show-prefix")
+	if err != nil {
+		return &GitStatus{Files: []GitFileStatus{}}, nil
+	}
+	// Status is read on every tree refresh; it mustn't take the index lock
+	// a commit or pull in progress needs.
+	out, err := runGit(ctx, workspace, "--no-optional-locks", "status", "--porcelain=v1", "-z", "--branch", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	status := parseGitStatus(out, prefix)
+	return status, nil
+}
+
+var reAheadBehind = regexp.MustCompile(`\[(?:ahead (\d+))?(?:, )?(?:behind (\d+))?\]`)
+
+// parseGitStatus reads `git status --porcelain=v1 -z --branch`.
+func parseGitStatus(out, prefix string) *GitStatus {
+	status := &GitStatus{Repo: true, Files: []GitFileStatus{}}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 3 {
+			continue
+		}
+		if strings.HasPrefix(e, "## ") {
+			parseGitBranchLine(status, e[3:])
+			continue
+		}
+		f := GitFileStatus{Index: e[:1], Worktree: e[1:2], Path: e[3:]}
+		if f.Index == "R" || f.Index == "C" {
+			i++ // the old path follows a rename or copy
+			if i < len(entries) {
+				f.From = entries[i]
+			}
+		}
+		rel, ok := strings.CutPrefix(f.Path, prefix)
+		if !ok {
+			continue
+		}
+		f.Path = rel
+		f.From = strings.TrimPrefix(f.From, prefix)
+		f.Status = gitStatusName(f.Index, f.Worktree)
+		f.Staged = f.Index != " " && f.Index != "?" && f.Status != "conflicted"
+		status.Files = append(status.Files, f)
+	}
+	sort.Slice(status.Files, func(i, j int) bool { return status.Files[i].Path < status.Files[j].Path })
+	return status
+}
+
+// parseGitBranchLine reads the "## main...origin/main [ahead 1]" line.
+func parseGitBranchLine(status *GitStatus, line string) {
+	if m := reAheadBehind.FindStringSubmatch(line); m != nil {
+		status.Ahead, _ = strconv.Atoi(m[1])
+		status.Behind, _ = strconv.Atoi(m[2])
+		line = strings.TrimSpace(line[:strings.Index(line, "[")])
+	}
+	switch {
+	case strings.HasPrefix(line, "HEAD (no branch)"):
+		status.Detached = true
+	case strings.HasPrefix(line, "No commits yet on "):
+		status.Branch = strings.TrimPrefix(line, "No commits yet on ")
+	default:
+		status.Branch, status.Upstream, _ = strings.Cut(line, "...")
+	}
+}
+
+func gitStatusName(index, worktree string) string {
+	switch {
+	case index == "?":
+		return "untracked"
+	case index == "U" || worktree == "U" || (index == "A" && worktree == "A") || (index == "D" && worktree == "D"):
+		return "conflicted"
+	case index == "R":
+		return "renamed"
+	case index == "A":
+		return "added"
+	case index == "D" || worktree == "D":
+		return "deleted"
+	default:
+		return "modified"
+	}
+}
+
+// gitDiff returns the diff of one file: staged changes, or the working
+// tree's. An untracked file is shown as wholly added.
+func gitDiff(workspace, rel string, staged bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--relative"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	diff, err := runGit(ctx, workspace, append(args, "--", rel)...)
+	if err != nil || diff != "" || staged {
+		return diff, err
+	}
+	if out, _ := runGit(ctx, workspace, "ls-files", "--others", "--exclude-standard", "--", rel); out == "" {
+		return "", nil
+	}
+	// --no-index exits 1 when the files differ, which they always do here.
+	diff, err = runGit(ctx, workspace, "diff", "--no-color", "--no-ext-diff", "--no-index", "--", os.DevNull, rel)
+	var gerr *gitError
+	if errors.As(err, &gerr) && strings.HasPrefix(gerr.output, "diff --git") {
+		return gerr.output, nil
+	}
+	return diff, err
+}
+
+func gitBranches(workspace string) ([]GitBranch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	out, err := runGit(ctx, workspace, "for-each-ref", "--format=%(HEAD)%00%(refname)%00%(upstream:short)", "refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+	branches := []GitBranch{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.Split(line, "\x00")
+		if len(parts) != 3 {
+			continue
+		}
+		b := GitBranch{Current: parts[0] == "*", Upstream: parts[2]}
+		if name, ok := strings.CutPrefix(parts[1], "refs/heads/"); ok {
+			b.Name = name
+		} else {
+			b.Name, b.Remote = strings.TrimPrefix(parts[1], "refs/remotes/"), true
+			if path.Base(b.Name) == "HEAD" {
+				continue
+			}
+		}
+		branches = append(branches, b)
+	}
+	return branches, nil
+}
+
+// ── File tree ───────────────────────────────────────────────
+
+// annotateGitStatus marks tree entries with their git status. A directory
+// containing changes is marked "modified".
+func annotateGitStatus(entries []*FileTreeEntry, files map[string]string) bool {
+	changed := false
+	for _, e := range entries {
+		if e.Type == "directory" {
+			if annotateGitStatus(e.Children, files) {
+				e.Git = "modified"
+				changed = true
+			}
+			continue
+		}
+		if s, ok := files[filepath.ToSlash(e.Path)]; ok {
+			e.Git = s
+			changed = true
+		}
+	}
+	return changed
+}
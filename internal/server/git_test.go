@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestValidRefName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"main":         true,
+		"feature/x":    true,
+		"feat+x":       true,
+		"":             false,
+		"-f":           false,
+		"--force":      false,
+		"+main":        false,
+		"main:other":   false,
+		"+main:main":   false,
+		"@":            false,
+		"@{-1}":        false,
+		"main@{u}":     false,
+		"HEAD~1":       false,
+		"a b":          false,
+		"refs/../main": false,
+	} {
+		if got := validRefName(name); got != want {
+			t.Errorf("validRefName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// TestGitRemote pushes to, pulls from and reads the status against a
+// bare repository on disk.
+func TestGitRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote.git")
+	workspace := filepath.Join(tmp, "workspace")
+	other := filepath.Join(tmp, "other")
+	runTestGit(t, tmp, "init", "-q", "--bare", "-b", "main", remote)
+	runTestGit(t, tmp, "init", "-q", "-b", "main", workspace)
+	runTestGit(t, workspace, "remote", "add", "origin", remote)
+
+	r := chi.NewRouter()
+	RegisterGitRoutes(r, workspace, NewSSEBroker())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	writeTestFile(t, filepath.Join(workspace, "index.md"), "one\n")
+	postGit(t, srv, "/api/git/commit", `{"message": "First", "all": true}`, http.StatusOK)
+	postGit(t, srv, "/api/git/push", `{"remote": "origin", "branch": "main", "set_upstream": true}`, http.StatusOK)
+	if got := runTestGit(t, remote, "log", "-1", "--format=%s", "main"); got != "First" {
+		t.Fatalf("remote main is at %q after the push, want First", got)
+	}
+
+	// A commit made elsewhere comes in with a pull.
+	runTestGit(t, tmp, "clone", "-q", remote, other)
+	writeTestFile(t, filepath.Join(other, "index.md"), "two\n")
+	runTestGit(t, other, "commit", "-q", "-am", "Second")
+	runTestGit(t, other, "push", "-q", "origin", "main")
+
+	status := getGitStatus(t, srv)
+	if status.Branch != "main" || status.Upstream != "origin/main" {
+		t.Fatalf("status is on %q tracking %q, want main tracking origin/main", status.Branch, status.Upstream)
+	}
+	postGit(t, srv, "/api/git/pull", `{"remote": "origin", "branch": "main"}`, http.StatusOK)
+	if data, _ := os.ReadFile(filepath.Join(workspace, "index.md")); string(data) != "two\n" {
+		t.Fatalf("index.md is %q after the pull, want %q", data, "two\n")
+	}
+	status = getGitStatus(t, srv)
+	if status.Ahead != 0 || status.Behind != 0 || len(status.Files) != 0 {
+		t.Fatalf("status after the pull = %+v, want clean and even with origin/main", status)
+	}
+
+	// Names that would force a push, or push to another ref, are refused
+	// before git runs.
+	runTestGit(t, workspace, "reset", "-q", "--hard", "HEAD~1")
+	for _, branch := range []string{"+main", "main:main", "+main:main", "-f", "@{-1}"} {
+		body, _ := json.Marshal(map[string]string{"remote": "origin", "branch": branch})
+		postGit(t, srv, "/api/git/push", string(body), http.StatusBadRequest)
+	}
+	if got := runTestGit(t, remote, "log", "-1", "--format=%s", "main"); got != "Second" {
+		t.Fatalf("remote main is at %q, want Second", got)
+	}
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func postGit(t *testing.T, srv *httptest.Server, path, body string, want int) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+path, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		var msg map[string]any
+		json.NewDecoder(resp.Body).Decode(&msg)
+		t.Fatalf("POST %s %s: status %d, want %d: %v", path, body, resp.StatusCode, want, msg["error"])
+	}
+}
+
+func getGitStatus(t *testing.T, srv *httptest.Server) GitStatus {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/api/git/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status GitStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/cottrellashley/opendoc/internal/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterHistoryRoutes adds the version history of workspace files:
+// every save and delete made through the workbench is kept for a while
+// (history.keep_days in opendoc.yml).
+//
+//	GET  /api/history?path=          revisions of a file, newest first
+//	GET  /api/history/deleted        deleted files that can be recovered
+//	GET  /api/history/{id}           one revision with its content
+//	GET  /api/history/diff?from=&to= diff of two revisions; without to, against the file now
+//	POST /api/history/restore        {"id"} write a revision back
+//	POST /api/history/recover        {"path"} bring back a deleted file or directory
+func RegisterHistoryRoutes(r chi.Router, workspace string) {
+	history := core.ProjectHistory(workspace)
+
+	r.Get("/api/history", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if _, ok := workspacePath(workspace, path); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "A file path is required"})
+			return
+		}
+		revs, err := history.Revisions(path)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"path": path, "revisions": revs})
+	})
+
+	r.Get("/api/history/deleted", func(w http.ResponseWriter, r *http.Request) {
+		revs, err := history.Deleted()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, revs)
+	})
+
+	r.Get("/api/history/diff", func(w http.ResponseWriter, r *http.Request) {
+		from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid revision"})
+			return
+		}
+		var to int64
+		if v := r.URL.Query().Get("to"); v != "" && v != "current" {
+			if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid revision"})
+				return
+			}
+		}
+		diff, err := history.Diff(from, to)
+		if err != nil {
+			writeHistoryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"diff": diff})
+	})
+
+	r.Get("/api/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid revision"})
+			return
+		}
+		rev, data, err := history.Revision(id)
+		if err != nil {
+			writeHistoryError(w, err)
+			return
+		}
+		resp := map[string]any{"revision": rev}
+		if utf8.Valid(data) {
+			resp["content"] = string(data)
+		} else {
+			resp["binary"] = true
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	r.Post("/api/history/restore", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+		rev, data, err := history.Restore(req.ID, userName(r), "editor")
+		if err != nil {
+			writeHistoryError(w, err)
+			return
+		}
+		hash := core.ContentHash(data)
+		w.Header().Set("ETag", etag(hash))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"path":    rev.Path,
+			"content": string(data),
+			"hash":    hash,
+		})
+	})
+
+	r.Post("/api/history/recover", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		if _, ok := editablePath(workspace, req.Path); !ok {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+			return
+		}
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+		recovered, err := history.Recover(req.Path, userName(r), "editor")
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "recovered": recovered})
+			return
+		}
+		if len(recovered) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Nothing deleted at " + req.Path})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"recovered": recovered})
+	})
+}
+
+func writeHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, core.ErrNoRevision) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "No such revision"})
+		return
+	}
+	if errors.Is(err, core.ErrProtectedPath) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -9,7 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -120,22 +120,50 @@ func checkClaudeStatus() ToolStatus {
 
 // PublishRequest holds the parameters for a publish deployment.
 type PublishRequest struct {
-	Repo string `json:"repo"`
+	Repo   string `json:"repo"`
+	Target string `json:"target"`  // deploy target name; empty = deploy.default
+	DryRun bool   `json:"dry_run"` // list the changes without deploying
+	Expect string `json:"expect"`  // fingerprint from a preview; refuse to deploy anything else
+}
+
+// PublishPreviewResult is what a deploy would change, for confirmation.
+type PublishPreviewResult struct {
+	Success     bool             `json:"success"`
+	Target      string           `json:"target,omitempty"`
+	Destination string           `json:"destination,omitempty"`
+	Fingerprint string           `json:"fingerprint,omitempty"`
+	Diff        *core.DeployDiff `json:"diff,omitempty"`
+	Error       string           `json:"error,omitempty"`
 }
 
 // PublishDeployResult holds the outcome of a publish deployment.
 type PublishDeployResult struct {
-	Success bool   `json:"success"`
-	Repo    string `json:"repo,omitempty"`
-	URL     string `json:"url,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Log     string `json:"log,omitempty"`
+	Success     bool              `json:"success"`
+	Repo        string            `json:"repo,omitempty"`
+	Target      string            `json:"target,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Changes     []core.FileChange `json:"changes,omitempty"`
+	Commit      string            `json:"commit,omitempty"`
+	DryRun      bool              `json:"dry_run,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Log         string            `json:"log,omitempty"`
+}
+
+// DeployTargetInfo describes a configured deploy target.
+type DeployTargetInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default bool   `json:"default"`
 }
 
 // ── Register routes ─────────────────────────────────────────
 
 // RegisterIntegrationRoutes adds integration-related API routes.
-func RegisterIntegrationRoutes(r chi.Router, workspace string, bm *BuildManager, themesFS fs.FS) {
+func RegisterIntegrationRoutes(r chi.Router, workspace string, bm *BuildManager, themesFS fs.FS, auth *Auth) {
+	admin := r.With(requireRole(core.RoleAdmin, core.RoleAdmin))
+
 	// GET /api/integrations/status — check all tools
 	r.Get("/api/integrations/status", func(w http.ResponseWriter, r *http.Request) {
 		status := IntegrationsStatus{
@@ -146,7 +174,7 @@ func RegisterIntegrationRoutes(r chi.Router, workspace string, bm *BuildManager,
 	})
 
 	// GET /api/integrations/api-keys — get masked key status
-	r.Get("/api/integrations/api-keys", func(w http.ResponseWriter, r *http.Request) {
+	admin.Get("/api/integrations/api-keys", func(w http.ResponseWriter, r *http.Request) {
 		anthropicKey := core.ResolveAPIKey("anthropic")
 		openaiKey := core.ResolveAPIKey("openai")
 		writeJSON(w, http.StatusOK, map[string]any{
@@ -164,7 +192,7 @@ func RegisterIntegrationRoutes(r chi.Router, workspace string, bm *BuildManager,
 	})
 
 	// PUT /api/integrations/api-keys — save API keys
-	r.Put("/api/integrations/api-keys", func(w http.ResponseWriter, r *http.Request) {
+	admin.Put("/api/integrations/api-keys", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			AnthropicKey string `json:"anthropic_key"`
 			OpenAIKey    string `json:"openai_key"`
@@ -214,11 +242,35 @@ func RegisterIntegrationRoutes(r chi.Router, workspace string, bm *BuildManager,
 	})
 
 	// GET /api/integrations/gh-login — start gh auth login (SSE stream)
-	r.Get("/api/integrations/gh-login", func(w http.ResponseWriter, r *http.Request) {
+	admin.With(auth.requireCSRF).Get("/api/integrations/gh-login", func(w http.ResponseWriter, r *http.Request) {
 		startGHLogin(w, r)
 	})
 
-	// POST /api/integrations/publish-deploy — build + deploy to GitHub Pages
+	// GET /api/integrations/deploy-targets — list configured deploy targets
+	r.Get("/api/integrations/deploy-targets", func(w http.ResponseWriter, r *http.Request) {
+		config, err := core.LoadConfig(workspace)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		targets := []DeployTargetInfo{}
+		for name, t := range config.Deploy.Targets {
+			targets = append(targets, DeployTargetInfo{
+				Name:    name,
+				Type:    t.Type,
+				Default: name == config.Deploy.Default,
+			})
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+		writeJSON(w, http.StatusOK, targets)
+	})
+
+	// POST /api/integrations/publish-preview — build and diff against the deployed site
+	r.Post("/api/integrations/publish-preview", func(w http.ResponseWriter, r *http.Request) {
+		handlePublishPreview(w, r, workspace, bm, themesFS)
+	})
+
+	// POST /api/integrations/publish-deploy — build + deploy to a deploy target
 	r.Post("/api/integrations/publish-deploy", func(w http.ResponseWriter, r *http.Request) {
 		handlePublishDeploy(w, r, workspace, bm, themesFS)
 	})
@@ -305,158 +357,94 @@ func sendSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, dat
 
 // ── Publish deploy handler ──────────────────────────────────
 
-// deployToGHPagesBranch pushes outputDir contents to the gh-pages branch.
-func deployToGHPagesBranch(outputDir, repo string) error {
-	remoteURL := fmt.Sprintf("https://github.com/%s.git", repo)
-
-	tmpDir, err := os.MkdirTemp("", "opendoc-deploy-*")
-	if err != nil {
-		return fmt.Errorf("create temp dir: %w", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	git := func(args ...string) (string, error) {
-		cmd := exec.Command("git", args...)
-		cmd.Dir = tmpDir
-		out, err := cmd.CombinedOutput()
-		return strings.TrimSpace(string(out)), err
-	}
-
-	if _, err := git("init"); err != nil {
-		return fmt.Errorf("git init: %w", err)
-	}
-	git("config", "user.email", "opendoc@deploy")
-	git("config", "user.name", "OpenDoc Deploy")
-
-	// Copy files from outputDir to tmpDir
-	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-		relPath, _ := filepath.Rel(outputDir, path)
-		destPath := filepath.Join(tmpDir, relPath)
-		os.MkdirAll(filepath.Dir(destPath), 0o755)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		return os.WriteFile(destPath, data, 0o644)
-	})
-	if err != nil {
-		return fmt.Errorf("copy files: %w", err)
-	}
-
-	// Add .nojekyll
-	os.WriteFile(filepath.Join(tmpDir, ".nojekyll"), []byte(""), 0o644)
-
-	if _, err := git("add", "-A"); err != nil {
-		return fmt.Errorf("git add: %w", err)
-	}
-	if _, err := git("commit", "-m", "Deploy via OpenDoc"); err != nil {
-		return fmt.Errorf("git commit: %w", err)
-	}
-
-	pushOut, err := git("push", "--force", remoteURL, "HEAD:gh-pages")
-	if err != nil {
-		return fmt.Errorf("push failed: %s\n\nMake sure the repo %s exists and you have push access.\nEnable GitHub Pages at: https://github.com/%s/settings/pages", pushOut, repo, repo)
-	}
-	return nil
-}
-
-func handlePublishDeploy(w http.ResponseWriter, r *http.Request, workspace string, bm *BuildManager, themesFS fs.FS) {
+// handlePublishPreview builds the site for a deploy target and reports
+// what deploying it would change. It and handlePublishDeploy build into
+// dist-publish, as the workbench's publish builds do, so they take turns
+// with those through bm.
+func handlePublishPreview(w http.ResponseWriter, r *http.Request, workspace string, bm *BuildManager, themesFS fs.FS) {
 	var req PublishRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Try to get repo from settings
-		req.Repo = ""
+		req = PublishRequest{}
 	}
 
-	// Resolve repo
-	repo := req.Repo
-	if repo == "" {
-		settings := loadSettings(workspace)
-		if settings.GithubRepo != "" {
-			repo = settings.GithubRepo
-		}
-	}
-	if repo == "" {
-		appCfg := core.LoadAppConfig()
-		if appCfg.GitHub.DefaultAccount != "" {
-			repo = appCfg.GitHub.DefaultAccount + "/" + filepath.Base(workspace)
-		}
-	}
-	if repo == "" {
-		writeJSON(w, http.StatusBadRequest, PublishDeployResult{
-			Success: false,
-			Error:   "No GitHub repository configured. Set it in Settings or provide --repo.",
+	var plan *core.PublishPlan
+	var err error
+	bm.WithPublishOutput(func() {
+		plan, err = core.PreparePublish(core.PublishOptions{
+			ProjectDir: workspace,
+			Repo:       req.Repo,
+			Target:     req.Target,
+			ThemesFS:   themesFS,
 		})
-		return
-	}
-
-	// Check gh
-	if _, err := exec.LookPath("gh"); err != nil {
-		writeJSON(w, http.StatusBadRequest, PublishDeployResult{
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, PublishPreviewResult{
 			Success: false,
-			Error:   "gh CLI not installed.",
+			Target:  req.Target,
+			Error:   fmt.Sprintf("Preview failed: %v", err),
 		})
 		return
 	}
+	writeJSON(w, http.StatusOK, PublishPreviewResult{
+		Success:     true,
+		Target:      plan.Target,
+		Destination: plan.Destination,
+		Fingerprint: plan.Fingerprint,
+		Diff:        plan.Diff,
+	})
+}
 
-	// Check auth
-	if err := exec.Command("gh", "auth", "status").Run(); err != nil {
-		writeJSON(w, http.StatusBadRequest, PublishDeployResult{
-			Success: false,
-			Error:   "gh is not authenticated. Connect GitHub in Settings first.",
-		})
-		return
+func handlePublishDeploy(w http.ResponseWriter, r *http.Request, workspace string, bm *BuildManager, themesFS fs.FS) {
+	var req PublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		req = PublishRequest{}
 	}
 
-	// Build in publish mode
-	config, err := core.LoadConfig(workspace)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, PublishDeployResult{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to load config: %v", err),
+	var result *core.PublishResult
+	var err error
+	bm.WithPublishOutput(func() {
+		result, err = core.Publish(core.PublishOptions{
+			ProjectDir: workspace,
+			Repo:       req.Repo,
+			Target:     req.Target,
+			DryRun:     req.DryRun,
+			Expect:     req.Expect,
+			ThemesFS:   themesFS,
 		})
-		return
-	}
-
-	outputDir := filepath.Join(workspace, "dist-publish")
-	err = core.BuildSite(config, workspace, themesFS, core.BuildOptions{
-		PublishMode:       true,
-		OutputDirOverride: "dist-publish",
 	})
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, PublishDeployResult{
 			Success: false,
-			Error:   fmt.Sprintf("Build failed: %v", err),
+			Repo:    req.Repo,
+			Target:  req.Target,
+			Error:   fmt.Sprintf("Deploy failed: %v", err),
+			Log:     err.Error(),
 		})
 		return
 	}
 
-	// Deploy by pushing to gh-pages branch
-	deployErr := deployToGHPagesBranch(outputDir, repo)
-	if deployErr != nil {
-		writeJSON(w, http.StatusInternalServerError, PublishDeployResult{
-			Success: false,
-			Repo:    repo,
-			Error:   fmt.Sprintf("Deploy failed: %v", deployErr),
-			Log:     deployErr.Error(),
-		})
-		return
+	log := fmt.Sprintf("Deployed %d changed file(s) to %s", len(result.Changes), result.Destination)
+	if result.DryRun {
+		log = fmt.Sprintf("Dry run: %d file(s) would change on %s", len(result.Changes), result.Destination)
+	} else if len(result.Changes) == 0 {
+		log = result.Destination + " is already up to date"
+	} else if result.Commit != "" {
+		log += " (commit " + result.Commit + ")"
 	}
-
-	// Build the URL
-	parts := strings.SplitN(repo, "/", 2)
-	url := ""
-	if len(parts) == 2 {
-		url = fmt.Sprintf("https://%s.github.io/%s/", parts[0], parts[1])
+	for _, warning := range result.Warnings {
+		log += "\nWarning: " + warning
 	}
-
 	writeJSON(w, http.StatusOK, PublishDeployResult{
-		Success: true,
-		Repo:    repo,
-		URL:     url,
-		Log:     "Deployed to gh-pages branch",
+		Success:     true,
+		Repo:        result.Repo,
+		Target:      result.Target,
+		Destination: result.Destination,
+		URL:         result.URL,
+		Changes:     result.Changes,
+		Commit:      result.Commit,
+		DryRun:      result.DryRun,
+		Warnings:    result.Warnings,
+		Log:         log,
 	})
 }
 
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// textOp is an operational-transformation edit of a text document, in
+// the JSON form used by ot.js: [5, "abc", -2] retains 5 characters,
+// inserts "abc" and deletes 2. Lengths count UTF-16 code units, as
+// JavaScript strings and Monaco offsets do.
+type textOp []opPart
+
+// opPart is one component of a textOp: a retain (n > 0), a delete
+// (n < 0) or an insert (n == 0).
+type opPart struct {
+	n int
+	s string
+}
+
+var errOpLength = errors.New("operation doesn't fit the document")
+
+func (p opPart) isInsert() bool { return p.n == 0 }
+func (p opPart) isRetain() bool { return p.n > 0 }
+func (p opPart) isDelete() bool { return p.n < 0 }
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// ── Building ────────────────────────────────────────────────
+
+func (op textOp) retain(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if k := len(op) - 1; k >= 0 && op[k].isRetain() {
+		op[k].n += n
+		return op
+	}
+	return append(op, opPart{n: n})
+}
+
+func (op textOp) insert(s string) textOp {
+	if s == "" {
+		return op
+	}
+	k := len(op) - 1
+	switch {
+	case k >= 0 && op[k].isInsert():
+		op[k].s += s
+		return op
+	case k >= 0 && op[k].isDelete():
+		// Keep inserts before deletes, so equal edits have one form.
+		if k > 0 && op[k-1].isInsert() {
+			op[k-1].s += s
+			return op
+		}
+		op = append(op, op[k])
+		op[k] = opPart{s: s}
+		return op
+	}
+	return append(op, opPart{s: s})
+}
+
+func (op textOp) delete(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if k := len(op) - 1; k >= 0 && op[k].isDelete() {
+		op[k].n -= n
+		return op
+	}
+	return append(op, opPart{n: -n})
+}
+
+// replaceOp turns text a into text b with a single replacement of the
+// part between their common prefix and suffix.
+func replaceOp(a, b []uint16) textOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var op textOp
+	op = op.retain(prefix)
+	op = op.insert(string(utf16.Decode(b[prefix : len(b)-suffix])))
+	op = op.delete(len(a) - prefix - suffix)
+	return op.retain(suffix)
+}
+
+// ── Applying ────────────────────────────────────────────────
+
+// baseLen is the length of the documents op applies to.
+func (op textOp) baseLen() int {
+	n := 0
+	for _, p := range op {
+		if p.isRetain() {
+			n += p.n
+		} else if p.isDelete() {
+			n -= p.n
+		}
+	}
+	return n
+}
+
+// apply returns doc with op applied.
+func (op textOp) apply(doc []uint16) ([]uint16, error) {
+	if op.baseLen() != len(doc) {
+		return nil, errOpLength
+	}
+	out := make([]uint16, 0, len(doc))
+	i := 0
+	for _, p := range op {
+		switch {
+		case p.isRetain():
+			out = append(out, doc[i:i+p.n]...)
+			i += p.n
+		case p.isDelete():
+			i -= p.n
+		default:
+			out = append(out, utf16.Encode([]rune(p.s))...)
+		}
+	}
+	return out, nil
+}
+
+// transformIndex moves a position in a document through op. Inserts at
+// the position push it along.
+func (op textOp) transformIndex(pos int) int {
+	newPos, i := pos, 0
+	for _, p := range op {
+		if i > pos {
+			break
+		}
+		switch {
+		case p.isRetain():
+			i += p.n
+		case p.isInsert():
+			newPos += utf16Len(p.s)
+		default:
+			newPos -= min(pos-i, -p.n)
+			i -= p.n
+		}
+	}
+	return newPos
+}
+
+// ── Transforming ────────────────────────────────────────────
+
+// transform takes two operations made concurrently on the same document
+// and returns a' and b' such that applying a then b' gives the same text
+// as applying b then a'. Where both insert at the same place, a's insert
+// comes first.
+func transform(a, b textOp) (textOp, textOp, error) {
+	if a.baseLen() != b.baseLen() {
+		return nil, nil, errOpLength
+	}
+	var a2, b2 textOp
+	i, j := 0, 0
+	var x, y *opPart
+	next := func(op textOp, k *int) *opPart {
+		if *k >= len(op) {
+			return nil
+		}
+		p := op[*k]
+		*k++
+		return &p
+	}
+	x, y = next(a, &i), next(b, &j)
+
+	for x != nil || y != nil {
+		if x != nil && x.isInsert() {
+			a2 = a2.insert(x.s)
+			b2 = b2.retain(utf16Len(x.s))
+			x = next(a, &i)
+			continue
+		}
+		if y != nil && y.isInsert() {
+			a2 = a2.retain(utf16Len(y.s))
+			b2 = b2.insert(y.s)
+			y = next(b, &j)
+			continue
+		}
+		if x == nil || y == nil {
+			return nil, nil, errOpLength
+		}
+
+		xn, yn := abs(x.n), abs(y.n)
+		n := min(xn, yn)
+		switch {
+		case x.isRetain() && y.isRetain():
+			a2 = a2.retain(n)
+			b2 = b2.retain(n)
+		case x.isDelete() && y.isRetain():
+			a2 = a2.delete(n)
+		case x.isRetain() && y.isDelete():
+			b2 = b2.delete(n)
+		}
+		// Both deleting the same text leaves nothing to do.
+
+		if xn == n {
+			x = next(a, &i)
+		} else {
+			x.n -= sign(x.n) * n
+		}
+		if yn == n {
+			y = next(b, &j)
+		} else {
+			y.n -= sign(y.n) * n
+		}
+	}
+	return a2, b2, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// ── JSON ────────────────────────────────────────────────────
+
+func (op textOp) MarshalJSON() ([]byte, error) {
+	parts := make([]any, len(op))
+	for i, p := range op {
+		if p.isInsert() {
+			parts[i] = p.s
+		} else {
+			parts[i] = p.n
+		}
+	}
+	return json.Marshal(parts)
+}
+
+func (op *textOp) UnmarshalJSON(data []byte) error {
+	var parts []any
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	var out textOp
+	for _, p := range parts {
+		switch v := p.(type) {
+		case string:
+			out = out.insert(v)
+		case float64:
+			n := int(v)
+			if float64(n) != v {
+				return fmt.Errorf("invalid operation component %v", v)
+			}
+			if n > 0 {
+				out = out.retain(n)
+			} else {
+				out = out.delete(-n)
+			}
+		default:
+			return fmt.Errorf("invalid operation component %v", v)
+		}
+	}
+	*op = out
+	return nil
+}
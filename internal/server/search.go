@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"github.com/cottrellashley/opendoc/internal/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterSearchRoutes adds workspace search and replace.
+//
+//	GET  /api/search?q=&regex=1&case=1&word=1&include=content/**/*.md&exclude=&max=
+//	POST /api/replace  {"query", "replace", "regex", "case_sensitive", "whole_word",
+//	                    "include", "exclude", "dry_run"}
+//
+// include and exclude take comma-separated globs. A replace with
+// "dry_run" returns the diffs it would apply without writing anything.
+func RegisterSearchRoutes(r chi.Router, workspace string) {
+	r.Get("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		opts := core.SearchOptions{
+			Query:         q.Get("q"),
+			Regex:         queryFlag(q.Get("regex")),
+			CaseSensitive: queryFlag(q.Get("case")),
+			WholeWord:     queryFlag(q.Get("word")),
+			Include:       splitGlobs(q.Get("include")),
+			Exclude:       splitGlobs(q.Get("exclude")),
+		}
+		opts.MaxMatches, _ = strconv.Atoi(q.Get("max"))
+
+		result, err := core.Search(workspace, opts)
+		if err != nil {
+			writeSearchError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	r.Post("/api/replace", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			core.SearchOptions
+			Replace string `json:"replace"`
+			DryRun  bool   `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+
+		core.FileWriteMu.Lock()
+		defer core.FileWriteMu.Unlock()
+		result, err := core.Replace(workspace, req.SearchOptions, req.Replace, req.DryRun)
+		if err != nil {
+			writeSearchError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+func queryFlag(v string) bool {
+	return v == "1" || v == "true"
+}
+
+func splitGlobs(v string) []string {
+	var globs []string
+	for _, g := range strings.Split(v, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
+
+// writeSearchError answers 400 for a bad query and 500 otherwise.
+func writeSearchError(w http.ResponseWriter, err error) {
+	var syntaxErr *syntax.Error
+	if errors.Is(err, core.ErrEmptyQuery) || errors.As(err, &syntaxErr) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
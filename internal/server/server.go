@@ -15,6 +15,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/cottrellashley/opendoc/internal/chat"
+	"github.com/cottrellashley/opendoc/internal/core"
 	"github.com/cottrellashley/opendoc/internal/web"
 )
 
@@ -24,6 +25,8 @@ type WorkbenchConfig struct {
 	Workspace string
 	ThemesFS  fs.FS
 	PublicFS  fs.FS
+	// TrustProxy trusts X-Forwarded-Proto from a reverse proxy.
+	TrustProxy bool
 }
 
 // StartWorkbench starts the full workbench server.
@@ -31,40 +34,76 @@ func StartWorkbench(cfg WorkbenchConfig) error {
 	workspace := cfg.Workspace
 	configFile := filepath.Join(workspace, "opendoc.yml")
 
+	users, err := core.OpenUserStore(core.UsersPath())
+	if err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+	auth := NewAuth(users)
+	auth.TrustProxy = cfg.TrustProxy
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(auth.Authenticate)
 
-	// ── SSE ─────────────────────────────────────────────
-	sse := NewSSEBroker()
-	r.Get("/api/events", sse.ServeHTTP)
+	// ── Sign-in API (open) ──────────────────────────────
+	RegisterAuthRoutes(r, auth)
 
-	// ── Build manager ───────────────────────────────────
+	sse := NewSSEBroker()
 	bm := NewBuildManager(workspace, cfg.ThemesFS, sse)
+	collab := NewCollabHub(workspace, sse)
 
-	// ── File API ────────────────────────────────────────
-	RegisterFileRoutes(r, workspace)
+	// Every other route needs a signed-in user. Each group names the role
+	// needed to read and the role needed to change anything; routes that
+	// need more say so where they are registered.
 
-	// ── Build API + Preview ─────────────────────────────
-	RegisterBuildRoutes(r, bm, workspace)
+	// ── Viewers read, editors write ─────────────────────
+	r.Group(func(r chi.Router) {
+		r.Use(requireRole(core.RoleViewer, core.RoleEditor))
 
-	// ── Settings API ────────────────────────────────────
-	RegisterSettingsRoutes(r, workspace, bm, sse)
+		// SSE
+		r.Get("/api/events", sse.ServeHTTP)
 
-	// ── Integrations API (gh, claude, publish) ──────────
-	RegisterIntegrationRoutes(r, workspace, bm, cfg.ThemesFS)
+		// File API
+		RegisterFileRoutes(r, workspace)
+		RegisterFileOpRoutes(r, workspace, collab)
+		RegisterSearchRoutes(r, workspace)
+		RegisterHistoryRoutes(r, workspace)
+
+		// Git
+		RegisterGitRoutes(r, workspace, sse)
 
-	// ── Chat API ────────────────────────────────────────
-	chat.RegisterChatRoutes(r, workspace, func() map[string]any {
-		return bm.TriggerBuild()
+		// Collaborative editing
+		RegisterCollabRoutes(r, collab)
+
+		// Build API + Preview
+		RegisterBuildRoutes(r, bm, workspace)
+
+		// Settings API
+		RegisterSettingsRoutes(r, workspace, bm, sse)
+
+		// Chat API
+		chat.RegisterChatRoutes(r, workspace, func() map[string]any {
+			return bm.TriggerBuild("chat")
+		})
 	})
 
-	// ── Console WebSocket (in-process) ─────────────────
+	// ── Integrations API (gh, claude, publish) ──────────
+	// Viewers see the status, publishers deploy, admins manage keys.
+	r.Group(func(r chi.Router) {
+		r.Use(requireRole(core.RoleViewer, core.RolePublisher))
+		RegisterIntegrationRoutes(r, workspace, bm, cfg.ThemesFS, auth)
+	})
+
+	// ── Console WebSocket (in-process, admins only) ─────
 	consoleServer := web.NewServer(web.Config{
 		MaxSessions: 10,
 		IdleTimeout: 5 * time.Minute,
 	})
-	r.HandleFunc("/console/ws", consoleServer.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(requireRole(core.RoleAdmin, core.RoleAdmin))
+		r.HandleFunc("/console/ws", consoleServer.HandleWebSocket)
+	})
 
 	// ── Serve workbench UI from embedded PublicFS ────────
 	publicSub, err := fs.Sub(cfg.PublicFS, "public")
@@ -73,7 +112,9 @@ func StartWorkbench(cfg WorkbenchConfig) error {
 	}
 	staticServer := http.FileServer(http.FS(publicSub))
 
-	// SPA catch-all: serve index.html for non-API, non-preview routes
+	// SPA catch-all: serve index.html for non-API, non-preview routes.
+	// Stylesheets, scripts and the sign-in page are open; the workbench
+	// itself sends visitors who aren't signed in to /login.
 	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
@@ -86,6 +127,15 @@ func StartWorkbench(cfg WorkbenchConfig) error {
 			return
 		}
 
+		if path == "/login" {
+			serveEmbedded(w, publicSub, "login.html")
+			return
+		}
+		if _, ok := currentUser(r); !ok && !strings.HasPrefix(path, "/css/") && !strings.HasPrefix(path, "/js/") {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
 		// Try to serve static file
 		cleanPath := strings.TrimPrefix(path, "/")
 		if cleanPath == "" {
@@ -98,19 +148,13 @@ func StartWorkbench(cfg WorkbenchConfig) error {
 		}
 
 		// SPA fallback — serve index.html
-		indexData, err := fs.ReadFile(publicSub, "index.html")
-		if err != nil {
-			http.NotFound(w, r)
-			return
-		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write(indexData)
+		serveEmbedded(w, publicSub, "index.html")
 	})
 
 	// ── Initial build ───────────────────────────────────
 	if _, err := os.Stat(configFile); err == nil {
 		log.Println("[workbench] Running initial build...")
-		result := bm.TriggerBuild()
+		result := bm.TriggerBuild("startup")
 		if result["success"] == true {
 			log.Println("[workbench] Initial build complete.")
 		} else {
@@ -119,17 +163,29 @@ func StartWorkbench(cfg WorkbenchConfig) error {
 	}
 
 	// ── File watcher ────────────────────────────────────
-	contentDir := filepath.Join(workspace, "content")
-	if _, err := os.Stat(contentDir); err == nil {
-		StartWatcher(workspace, bm, sse)
-	} else {
-		log.Println("[workbench] No content/ dir yet — watcher will start after scaffold")
-	}
+	// Directories the config names but that don't exist yet are picked
+	// up when they are created.
+	StartWatcher(workspace, bm, sse, collab)
 
 	// ── Start server ────────────────────────────────────
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	log.Printf("[workbench] OpenDoc Workbench running on port %d", cfg.Port)
 	log.Printf("[workbench] Workspace: %s", workspace)
+	if users.Empty() {
+		log.Printf("[workbench] No accounts yet. Create the first admin at http://localhost:%d/login?setup=%s", cfg.Port, auth.SetupCode)
+		log.Printf("[workbench] (or run: opendoc user add <name> --role admin)")
+	}
 
 	return http.ListenAndServe(addr, r)
 }
+
+// serveEmbedded writes an HTML page of the workbench UI.
+func serveEmbedded(w http.ResponseWriter, publicFS fs.FS, name string) {
+	data, err := fs.ReadFile(publicFS, name)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
@@ -121,7 +121,7 @@ func RegisterSettingsRoutes(r chi.Router, workspace string, bm *BuildManager, ss
 		saveSettings(workspace, current)
 
 		if nameChanged {
-			go bm.TriggerBuild()
+			go bm.TriggerBuild("settings")
 		}
 
 		sse.Broadcast("settings-changed", current)
@@ -4,99 +4,220 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cottrellashley/opendoc/internal/core"
 	"github.com/fsnotify/fsnotify"
 )
 
 const debounceDuration = 800 * time.Millisecond
 
-// StartWatcher watches the content directory and config file for changes
-// and triggers rebuilds with debouncing.
-func StartWatcher(workspace string, bm *BuildManager, sse *SSEBroker) {
-	contentDir := filepath.Join(workspace, "content")
-	configFile := filepath.Join(workspace, "opendoc.yml")
+// projectWatcher follows the files a project's build reads, as given by
+// its config (see core.WatchSet), and rebuilds after they change.
+type projectWatcher struct {
+	workspace string
+	fsw       *fsnotify.Watcher
+	bm        *BuildManager
+	sse       *SSEBroker
+	collab    *CollabHub
+
+	set  *core.WatchSet
+	dirs map[string]bool // watched directories, absolute
+
+	mu      sync.Mutex
+	changed map[string]bool // since the last rebuild, relative to the workspace
+	timer   *time.Timer
+}
 
-	watcher, err := fsnotify.NewWatcher()
+// StartWatcher watches the project's content, opendoc.yml, shortcodes,
+// i18n tables and watch.include for changes, and rebuilds with debouncing,
+// passing the changed files to the build. The workspace itself is watched
+// too, so directories created later are picked up. Changes to files open
+// in a collaborative session, and their removal, are passed to collab,
+// which may be nil.
+func StartWatcher(workspace string, bm *BuildManager, sse *SSEBroker, collab *CollabHub) {
+	fsw, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Printf("[watcher] Failed to create watcher: %v", err)
 		return
 	}
-
-	// Add content directory (recursively) and config file
-	if _, err := os.Stat(contentDir); err == nil {
-		addDirRecursive(watcher, contentDir)
-	}
-	if _, err := os.Stat(configFile); err == nil {
-		watcher.Add(configFile)
+	w := &projectWatcher{
+		workspace: workspace,
+		fsw:       fsw,
+		bm:        bm,
+		sse:       sse,
+		collab:    collab,
+		dirs:      make(map[string]bool),
+		changed:   make(map[string]bool),
 	}
-
-	log.Println("[watcher] Watching for changes in content/ and opendoc.yml")
-
-	var timer *time.Timer
+	w.loadConfig()
+	log.Printf("[watcher] Watching for changes in %s", strings.Join(w.set.Roots, ", "))
 
 	go func() {
-		defer watcher.Close()
-
+		defer fsw.Close()
 		for {
 			select {
-			case event, ok := <-watcher.Events:
+			case event, ok := <-fsw.Events:
 				if !ok {
 					return
 				}
+				w.handle(event)
 
-				// Skip hidden files and dist directories
-				base := filepath.Base(event.Name)
-				if strings.HasPrefix(base, ".") || strings.Contains(event.Name, "/dist") {
-					continue
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
 				}
+				log.Printf("[watcher] Error: %v", err)
+			}
+		}
+	}()
+}
 
-				relPath, _ := filepath.Rel(workspace, event.Name)
-				log.Printf("[watcher] Changed: %s", relPath)
+// loadConfig reads the watch set from opendoc.yml, keeping the previous
+// one (or the defaults) when it can't be read, and watches its
+// directories.
+func (w *projectWatcher) loadConfig() {
+	if config, err := core.LoadConfig(w.workspace); err == nil {
+		w.set = config.WatchSet()
+	} else if w.set == nil {
+		w.set = (&core.OpenDocConfig{Content: core.DefaultContent, Build: core.DefaultBuild}).WatchSet()
+	}
 
-				sse.Broadcast("file-changed", map[string]any{
-					"path": relPath,
-					"time": time.Now().UnixMilli(),
-				})
+	seen := map[string]bool{w.workspace: true}
+	w.add(w.workspace)
+	for _, dir := range w.set.Dirs() {
+		abs := filepath.Join(w.workspace, filepath.FromSlash(dir))
+		if _, err := os.Stat(abs); err == nil {
+			w.addTree(abs, seen)
+		}
+	}
+	// Stop watching what is no longer wanted.
+	for dir := range w.dirs {
+		if !seen[dir] {
+			w.fsw.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+}
 
-				// If a new directory was created, watch it too
-				if event.Has(fsnotify.Create) {
-					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-						watcher.Add(event.Name)
-					}
-				}
+func (w *projectWatcher) handle(event fsnotify.Event) {
+	rel, err := filepath.Rel(w.workspace, event.Name)
+	if err != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
 
-				// Debounced rebuild
-				if timer != nil {
-					timer.Stop()
-				}
-				timer = time.AfterFunc(debounceDuration, func() {
-					bm.TriggerBuild()
-				})
+	// A renamed or removed directory takes its watches with it; its new
+	// name arrives as a Create.
+	if event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+		w.forget(event.Name)
+	}
+	if rel == "opendoc.yml" {
+		w.loadConfig()
+	}
+	info, statErr := os.Stat(event.Name)
+	if statErr == nil && info.IsDir() && event.Has(fsnotify.Create) {
+		// A new directory, perhaps moved in with files already inside.
+		w.addTree(event.Name, nil)
+	}
+	if !w.set.Watches(rel) {
+		return
+	}
+	log.Printf("[watcher] Changed: %s", rel)
 
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Printf("[watcher] Error: %v", err)
+	// The hash lets open editors tell whether their copy is stale; it is
+	// absent for directories and removed files.
+	changed := map[string]any{
+		"path": rel,
+		"time": time.Now().UnixMilli(),
+	}
+	if statErr == nil && info.Mode().IsRegular() {
+		if data, err := os.ReadFile(event.Name); err == nil {
+			changed["hash"] = core.ContentHash(data)
+			if w.collab != nil {
+				w.collab.FileChanged(rel, data)
 			}
 		}
-	}()
+	} else if os.IsNotExist(statErr) && w.collab != nil {
+		w.collab.FileRemoved(rel)
+	}
+	w.sse.Broadcast("file-changed", changed)
+	w.schedule(rel)
 }
 
-func addDirRecursive(watcher *fsnotify.Watcher, dir string) {
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// schedule records a change and rebuilds once changes stop for
+// debounceDuration.
+func (w *projectWatcher) schedule(rel string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.changed[rel] = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(debounceDuration, func() {
+		w.mu.Lock()
+		files := make([]string, 0, len(w.changed))
+		for f := range w.changed {
+			files = append(files, f)
+		}
+		w.changed = make(map[string]bool)
+		w.mu.Unlock()
+
+		sort.Strings(files)
+		w.bm.TriggerChangedBuild("watcher", files)
+	})
+}
+
+// addTree watches dir and the directories under it that the watch set
+// wants, marking them in seen when it isn't nil.
+func (w *projectWatcher) addTree(dir string, seen map[string]bool) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
 			return nil
 		}
-		if info.IsDir() {
-			name := info.Name()
-			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "dist" {
-				return filepath.SkipDir
-			}
-			watcher.Add(path)
+		if rel, _ := filepath.Rel(w.workspace, path); !w.set.Watches(filepath.ToSlash(rel)) && !w.wantsBelow(rel) {
+			return filepath.SkipDir
+		}
+		w.add(path)
+		if seen != nil {
+			seen[path] = true
 		}
 		return nil
 	})
 }
+
+// wantsBelow reports whether a directory is, or leads to, one of the
+// watch set's directories, like "themes" for "themes/mine/*.html".
+func (w *projectWatcher) wantsBelow(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, dir := range w.set.Dirs() {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *projectWatcher) add(dir string) {
+	if w.dirs[dir] {
+		return
+	}
+	if err := w.fsw.Add(dir); err != nil {
+		log.Printf("[watcher] Can't watch %s: %v", dir, err)
+		return
+	}
+	w.dirs[dir] = true
+}
+
+// forget drops the watches of a directory and everything under it.
+func (w *projectWatcher) forget(dir string) {
+	for d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, dir+string(filepath.Separator)) {
+			w.fsw.Remove(d) // fails harmlessly when the watch went with the directory
+			delete(w.dirs, d)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	ptyPkg "github.com/cottrellashley/opendoc/internal/pty"
@@ -32,15 +34,28 @@ func NewServer(cfg Config) *Server {
 		config:   cfg,
 		sessions: NewSessionManager(cfg.MaxSessions, cfg.IdleTimeout),
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins (container-internal).
-			},
+			CheckOrigin:     SameOrigin,
 			ReadBufferSize:  4096,
 			WriteBufferSize: 4096,
 		},
 	}
 }
 
+// SameOrigin accepts WebSocket handshakes from pages served by this host,
+// and from clients that send no Origin (scripts and terminals rather than
+// browsers). Other sites can't open a socket in a signed-in browser.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
 // Start starts the HTTP server.
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
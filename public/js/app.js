@@ -67,6 +67,9 @@ window.reloadFrame = function (iframe, overlay) {
     consoleCollapsed: false,
     menuOpen: false,
     settings: null,
+    presence: [],
+    git: null,
+    gitRemotes: [],
   };
 
   // ── DOM refs ────────────────────────────────────────────
@@ -410,7 +413,7 @@ window.reloadFrame = function (iframe, overlay) {
     badgeLabel.textContent = "Connecting...";
     actionsEl.innerHTML = '<span class="integration-detail">Waiting for browser authentication...</span>';
 
-    var source = new EventSource("/api/integrations/gh-login");
+    var source = new EventSource("/api/integrations/gh-login?csrf=" + encodeURIComponent(opendocAuth.csrf));
 
     source.addEventListener("output", function (e) {
       var data = JSON.parse(e.data);
@@ -515,6 +518,10 @@ window.reloadFrame = function (iframe, overlay) {
         automaticLayout: true,
       });
 
+      opendocAuth.ready.then(function () {
+        editor.updateOptions({ readOnly: !opendocAuth.can("editor") });
+      });
+
       editor.addCommand(monaco.KeyMod.CtrlCmd | monaco.KeyCode.KeyS, function () {
         saveActiveFile();
       });
@@ -555,11 +562,12 @@ window.reloadFrame = function (iframe, overlay) {
       editorModels[filePath] = monaco.editor.createModel(content, lang, uri);
       editorModels[filePath].onDidChangeContent(function () {
         var f = state.openFiles.find(function (f) { return f.path === filePath; });
-        if (f && f.content !== editorModels[filePath].getValue()) {
+        if (f && !f.collab && f.content !== editorModels[filePath].getValue()) {
           f.modified = true;
           renderOpenTabs();
         }
       });
+      attachCollab(filePath);
     }
 
     editor.setModel(editorModels[filePath]);
@@ -567,33 +575,122 @@ window.reloadFrame = function (iframe, overlay) {
     renderOpenTabs();
     highlightActiveTreeItem(filePath);
     $fileStatus.textContent = filePath;
+    var open = state.openFiles.find(function (f) { return f.path === filePath; });
+    if (open) showCollabStatus(open);
+  }
+
+  // attachCollab joins the file's co-editing session. Edits are then
+  // shared live and written to disk by the server; if the server has no
+  // session for the file, it is edited and saved on its own.
+  function attachCollab(filePath) {
+    var f = state.openFiles.find(function (f) { return f.path === filePath; });
+    if (!f || !window.OpenDocCollab) return;
+    f.collab = OpenDocCollab.attach(editor, editorModels[filePath], filePath, {
+      onStatus: function (s) { f.collabStatus = s; showCollabStatus(f); },
+      onPeers: function (names) {
+        var me = opendocAuth.user && opendocAuth.user.name;
+        f.peers = names.filter(function (n) { return n !== me; });
+        showCollabStatus(f);
+      },
+      onSaved: function (hash) { f.hash = hash; if (state.activeFile === f.path) $fileStatus.textContent = f.path + " — saved"; },
+      onUnavailable: function () { f.collab = null; },
+      onDeleted: function () {
+        f.collab = null; f.hash = null; f.modified = true;
+        if (state.activeFile === f.path) $fileStatus.textContent = f.path + " — deleted on disk; save to keep it";
+        renderOpenTabs();
+      },
+    });
+  }
+
+  function showCollabStatus(f) {
+    if (state.activeFile !== f.path || !f.collab) return;
+    var text = f.path + " — " + (f.collabStatus || "Connecting...");
+    if (f.peers && f.peers.length) text += " \u00b7 with " + f.peers.join(", ");
+    $fileStatus.textContent = text;
   }
 
   function saveActiveFile() {
     if (!state.activeFile || !editor) return;
     var f = state.openFiles.find(function (f) { return f.path === state.activeFile; });
     if (!f) return;
+    if (f.collab) { f.collab.save(); return; }
 
+    // If-Match makes the save fail if the file changed since it was read;
+    // sending the text it was read as lets the server merge instead.
     var content = editor.getValue();
-    f.content = content; f.modified = false;
+    var headers = { "Content-Type": "application/json" };
+    if (f.hash) headers["If-Match"] = '"' + f.hash + '"';
+    f.saving = true;
+
+    fetch("/api/files/" + f.path, { method: "PUT", headers: headers, body: JSON.stringify({ content: content, base: f.content }) })
+      .then(function (r) {
+        return r.json().then(function (d) {
+          if (r.status === 409) { showConflict(f, d); return; }
+          if (!r.ok) throw new Error(d.error || "Save failed");
+          if (d.merged) { content = d.content; setModelText(f.path, content); }
+          f.hash = d.hash; f.content = content; f.stale = false;
+          f.modified = editorModels[f.path] ? editorModels[f.path].getValue() !== content : false;
+          $fileStatus.textContent = f.path + (d.merged ? " — saved, merged with changes on disk" : " — saved");
+          renderOpenTabs();
+        });
+      })
+      .catch(function (e) { $fileStatus.textContent = "Error: " + e.message; })
+      .then(function () { f.saving = false; });
+  }
 
-    fetch("/api/files/" + f.path, { method: "PUT", headers: { "Content-Type": "text/plain" }, body: content })
-      .then(function (r) { if (!r.ok) throw new Error("Save failed"); $fileStatus.textContent = f.path + " — saved"; renderOpenTabs(); })
-      .catch(function (e) { $fileStatus.textContent = "Error: " + e.message; });
+  // showConflict handles a save rejected because the file changed on disk.
+  // The disk version becomes the new base and the editor gets the merge,
+  // with the lines both sides changed between conflict markers.
+  function showConflict(f, d) {
+    f.hash = d.hash; f.content = d.content; f.stale = false; f.modified = true;
+    if (d.merged) {
+      setModelText(f.path, d.merged);
+      $fileStatus.textContent = f.path + " — conflicts with changes on disk: resolve the marked lines (" + d.conflicts + ") and save";
+    } else {
+      $fileStatus.textContent = f.path + " — " + (d.exists ? "changed" : "deleted") + " on disk; save again to overwrite";
+    }
+    renderOpenTabs();
+  }
+
+  // setModelText replaces an open file's text as one undoable edit.
+  function setModelText(filePath, text) {
+    var model = editorModels[filePath];
+    if (!model || model.getValue() === text) return;
+    model.pushEditOperations([], [{ range: model.getFullModelRange(), text: text }], function () { return null; });
+  }
+
+  // refreshOpenFile follows a change on disk: unmodified files are
+  // reloaded, modified ones are marked stale and merged when saved.
+  function refreshOpenFile(f) {
+    fetch("/api/files/" + f.path).then(function (r) { return r.ok ? r.json() : null; })
+      .then(function (d) {
+        if (!d || d.hash === f.hash || f.saving) return;
+        if (!f.modified) {
+          f.content = d.content; f.hash = d.hash;
+          setModelText(f.path, d.content);
+          f.modified = false;
+        } else {
+          f.stale = true;
+          if (state.activeFile === f.path) $fileStatus.textContent = f.path + " — changed on disk; your save will be merged";
+        }
+        renderOpenTabs();
+      })
+      .catch(function () {});
   }
 
   // ── Open tabs ───────────────────────────────────────────
 
-  function addOpenFile(filePath, content) {
+  function addOpenFile(filePath, content, hash) {
     var existing = state.openFiles.find(function (f) { return f.path === filePath; });
     if (existing) { openFileInEditor(filePath, existing.content); return; }
-    state.openFiles.push({ path: filePath, content: content, modified: false });
+    state.openFiles.push({ path: filePath, content: content, hash: hash || "", modified: false });
     openFileInEditor(filePath, content);
   }
 
   function closeFile(filePath) {
     var idx = state.openFiles.findIndex(function (f) { return f.path === filePath; });
     if (idx === -1) return;
+    if (state.openFiles[idx].collab) state.openFiles[idx].collab.close();
     if (editorModels[filePath]) { editorModels[filePath].dispose(); delete editorModels[filePath]; }
     state.openFiles.splice(idx, 1);
     if (state.activeFile === filePath) {
@@ -609,7 +706,8 @@ window.reloadFrame = function (iframe, overlay) {
     $openTabs.innerHTML = "";
     state.openFiles.forEach(function (file) {
       var tab = document.createElement("button");
-      tab.className = "open-tab" + (file.path === state.activeFile ? " active" : "");
+      tab.className = "open-tab" + (file.path === state.activeFile ? " active" : "") + (file.stale ? " stale" : "");
+      if (file.stale) tab.title = "Changed on disk";
       var label = document.createElement("span");
       label.textContent = file.path.split("/").pop();
       tab.appendChild(label);
@@ -642,7 +740,7 @@ window.reloadFrame = function (iframe, overlay) {
 
   function loadFileTree() {
     fetch("/api/files").then(function (r) { return r.json(); })
-      .then(function (tree) { $fileTree.innerHTML = ""; renderTree(filterTree(tree), $fileTree, 0); })
+      .then(function (tree) { $fileTree.innerHTML = ""; renderTree(filterTree(tree), $fileTree, 0); renderPresence(); })
       .catch(function () { $fileTree.innerHTML = '<div class="tree-item" style="color:var(--danger)">Error</div>'; });
   }
 
@@ -654,8 +752,10 @@ window.reloadFrame = function (iframe, overlay) {
         dirItem.className = "tree-item dir";
         dirItem.style.paddingLeft = (8 + depth * 14) + "px";
         dirItem.innerHTML = '<span class="tree-icon">\u25BE</span><span class="tree-label">' + esc(item.name) + "</span>";
+        if (item.git) dirItem.classList.add("git-" + item.git);
         var children = document.createElement("div"); children.className = "tree-children";
         renderTree(item.children, children, depth + 1);
+        dirItem.addEventListener("contextmenu", function (e) { showTreeMenu(e, item.path, true); });
         dirItem.addEventListener("click", function () {
           children.classList.toggle("collapsed");
           dirItem.querySelector(".tree-icon").textContent = children.classList.contains("collapsed") ? "\u25B8" : "\u25BE";
@@ -668,15 +768,543 @@ window.reloadFrame = function (iframe, overlay) {
         fileItem.setAttribute("data-path", item.path);
         var icon = item.name.endsWith(".md") ? "\uD83D\uDCC4" : "\u2699";
         fileItem.innerHTML = '<span class="tree-icon">' + icon + '</span><span class="tree-label">' + esc(item.name) + "</span>";
+        if (item.git) {
+          fileItem.classList.add("git-" + item.git);
+          fileItem.insertAdjacentHTML("beforeend", '<span class="tree-git" title="' + item.git + '">' + GIT_LETTERS[item.git] + "</span>");
+        }
         fileItem.addEventListener("click", function () {
           fetch("/api/files/" + item.path).then(function (r) { return r.json(); })
-            .then(function (d) { addOpenFile(item.path, d.content); });
+            .then(function (d) { addOpenFile(item.path, d.content, d.hash); });
         });
+        fileItem.addEventListener("contextmenu", function (e) { showTreeMenu(e, item.path, false); });
         container.appendChild(fileItem);
       }
     });
   }
 
+  // renderPresence marks files that other people have open.
+  function renderPresence() {
+    var me = opendocAuth.user && opendocAuth.user.name;
+    var editing = {};
+    (state.presence || []).forEach(function (p) {
+      var others = p.users.filter(function (u) { return u !== me; });
+      if (others.length) editing[p.path] = others;
+    });
+    $fileTree.querySelectorAll(".tree-item.file").forEach(function (el) {
+      var badge = el.querySelector(".tree-presence");
+      if (badge) badge.remove();
+      var users = editing[el.getAttribute("data-path")];
+      if (!users) return;
+      badge = document.createElement("span");
+      badge.className = "tree-presence";
+      badge.textContent = users.length;
+      badge.title = "Editing: " + users.join(", ");
+      el.appendChild(badge);
+    });
+  }
+
+  // ── File operations ─────────────────────────────────────
+
+  var $treeMenu = document.getElementById("tree-menu");
+  var treeMenuTarget = null;
+
+  function showTreeMenu(e, path, isDir) {
+    e.preventDefault();
+    treeMenuTarget = { path: path, isDir: isDir };
+    $treeMenu.querySelectorAll("[data-for=file]").forEach(function (el) { el.classList.toggle("hidden", isDir); });
+    $treeMenu.classList.remove("hidden");
+    $treeMenu.style.left = Math.min(e.clientX, window.innerWidth - $treeMenu.offsetWidth - 4) + "px";
+    $treeMenu.style.top = Math.min(e.clientY, window.innerHeight - $treeMenu.offsetHeight - 4) + "px";
+  }
+
+  document.addEventListener("click", function () { $treeMenu.classList.add("hidden"); });
+
+  $treeMenu.addEventListener("click", function (e) {
+    var action = e.target.getAttribute("data-action");
+    var target = treeMenuTarget;
+    $treeMenu.classList.add("hidden");
+    if (!action || !target) return;
+    if (action === "move") moveTreeItem(target.path);
+    if (action === "copy") copyTreeItem(target.path);
+    if (action === "download") downloadTreeItem(target.path, target.isDir);
+    if (action === "history") showHistory(target.path);
+    if (action === "deleted") showDeleted(target.isDir ? target.path : "");
+  });
+
+  function affectedOpenFiles(path) {
+    return state.openFiles.filter(function (f) { return f.path === path || f.path.indexOf(path + "/") === 0; });
+  }
+
+  function fileOp(op, body) {
+    return fetch("/api/fileops/" + op, {
+      method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify(body),
+    }).then(function (r) {
+      return r.json().then(function (d) { d.status = r.status; if (!r.ok) d.failed = true; return d; });
+    });
+  }
+
+  function moveTreeItem(from) {
+    var to = prompt("Move " + from + " to:", from);
+    if (!to || to === from) return;
+    var open = affectedOpenFiles(from);
+    var unsaved = open.filter(function (f) { return f.modified && !f.collab; });
+    if (unsaved.length) { alert("Save " + unsaved.map(function (f) { return f.path; }).join(", ") + " first."); return; }
+    var rewrite = confirm("Update links to " + from + " in other pages?");
+
+    // Our own tabs hold the file open for co-editing; close them first and
+    // give the server a moment to notice.
+    open.forEach(function (f) { closeFile(f.path); });
+    var attempt = function (tries) {
+      return fileOp("move", { from: from, to: to, rewrite_links: rewrite }).then(function (d) {
+        if (d.status === 409 && open.length && tries > 0) {
+          return new Promise(function (res) { setTimeout(res, 400); }).then(function () { return attempt(tries - 1); });
+        }
+        return d;
+      });
+    };
+    attempt(5).then(function (d) {
+      loadFileTree();
+      open.forEach(function (f) {
+        var p = d.failed ? f.path : to + f.path.slice(from.length);
+        fetch("/api/files/" + p).then(function (r) { return r.json(); })
+          .then(function (file) { addOpenFile(p, file.content, file.hash); });
+      });
+      if (d.failed) { alert("Error: " + d.error); return; }
+      if (d.rewritten && d.rewritten.length) $fileStatus.textContent = "Updated links in " + d.rewritten.join(", ");
+    }).catch(function (e) { alert("Error: " + e.message); });
+  }
+
+  function copyTreeItem(from) {
+    var dot = from.lastIndexOf(".");
+    var suggested = dot > from.lastIndexOf("/") ? from.slice(0, dot) + "-copy" + from.slice(dot) : from + "-copy";
+    var to = prompt("Copy " + from + " to:", suggested);
+    if (!to || to === from) return;
+    fileOp("copy", { from: from, to: to }).then(function (d) {
+      if (d.failed) { alert("Error: " + d.error); return; }
+      loadFileTree();
+    }).catch(function (e) { alert("Error: " + e.message); });
+  }
+
+  // Directories come as a zip; files as they are on disk, so images and
+  // other binary files arrive intact.
+  function downloadTreeItem(path, isDir) {
+    var a = document.createElement("a");
+    a.href = (isDir ? "/api/fileops/export?path=" : "/api/fileops/download?path=") + encodeURIComponent(path);
+    a.click();
+  }
+
+  var $uploadInput = document.getElementById("upload-input");
+  document.getElementById("btn-upload").addEventListener("click", function () { $uploadInput.click(); });
+  document.getElementById("btn-export").addEventListener("click", function () {
+    var a = document.createElement("a"); a.href = "/api/fileops/export"; a.click();
+  });
+  document.getElementById("btn-export-build").addEventListener("click", function () {
+    var a = document.createElement("a"); a.href = "/api/fileops/export?build=1"; a.click();
+  });
+
+  $uploadInput.addEventListener("change", function () {
+    if (!$uploadInput.files.length) return;
+    var form = new FormData();
+    Array.prototype.forEach.call($uploadInput.files, function (file) { form.append("file", file); });
+    $uploadInput.value = "";
+    var send = function (overwrite) {
+      return fetch("/api/fileops/upload" + (overwrite ? "?overwrite=1" : ""), { method: "POST", body: form })
+        .then(function (r) { return r.json().then(function (d) { d.status = r.status; return d; }); });
+    };
+    send(false).then(function (d) {
+      if (d.status === 409 && confirm(d.error + ". Replace it?")) return send(true);
+      return d;
+    }).then(function (d) {
+      if (d.error) { alert("Error: " + d.error); return; }
+      $fileStatus.textContent = "Uploaded " + d.uploaded.join(", ");
+      loadFileTree();
+    }).catch(function (e) { alert("Error: " + e.message); });
+  });
+
+  // ── Version history ─────────────────────────────────────
+
+  var $historyOverlay = document.getElementById("history-overlay");
+  var $historyList = document.getElementById("history-list");
+  var $historyDiff = document.getElementById("history-diff");
+
+  var ACTION_LABELS = {
+    save: "Saved", "delete": "Deleted", restore: "Restored",
+    recover: "Recovered", external: "Changed outside the workbench",
+  };
+
+  function openHistoryDialog(title) {
+    document.getElementById("history-title").textContent = title;
+    $historyList.innerHTML = '<div class="history-empty">Loading...</div>';
+    $historyDiff.classList.add("hidden");
+    $historyOverlay.classList.remove("hidden");
+  }
+
+  function historyRow(what, rev, buttons) {
+    var row = document.createElement("div");
+    row.className = "history-row";
+    var by = rev.user || rev.source;
+    row.innerHTML = '<span class="history-what">' + esc(what) + (by ? " \u00b7 " + esc(by) : "") + "</span>" +
+      '<span class="history-when">' + esc(new Date(rev.time).toLocaleString()) + "</span>";
+    buttons.forEach(function (b) {
+      var btn = document.createElement("button");
+      btn.className = "small-btn" + (b.editor ? " needs-editor" : "");
+      btn.textContent = b.label;
+      btn.addEventListener("click", b.run);
+      row.appendChild(btn);
+    });
+    return row;
+  }
+
+  function showHistory(path) {
+    openHistoryDialog("History of " + path);
+    fetch("/api/history?path=" + encodeURIComponent(path)).then(function (r) { return r.json(); }).then(function (d) {
+      $historyList.innerHTML = "";
+      if (!d.revisions || !d.revisions.length) {
+        $historyList.innerHTML = '<div class="history-empty">No earlier versions of this file</div>';
+        return;
+      }
+      d.revisions.forEach(function (rev) {
+        $historyList.appendChild(historyRow(ACTION_LABELS[rev.action] || rev.action, rev, [
+          { label: "Diff", run: function () { showRevisionDiff(rev.id); } },
+          { label: "Restore", editor: true, run: function () { restoreRevision(rev); } },
+        ]));
+      });
+    }).catch(function (e) { $historyList.innerHTML = '<div class="history-empty">' + esc(e.message) + "</div>"; });
+  }
+
+  function showRevisionDiff(id) {
+    fetch("/api/history/diff?from=" + id).then(function (r) { return r.json(); }).then(function (d) {
+      renderDiff(d.diff || "Same as the current file");
+    });
+  }
+
+  function renderDiff(diff) {
+    var lines = diff.split("\n").map(function (l) {
+      var cls = l.indexOf("+++") === 0 || l.indexOf("---") === 0 ? "" :
+        l.charAt(0) === "+" ? "add" : l.charAt(0) === "-" ? "del" : l.indexOf("@@") === 0 ? "hunk" : "";
+      return cls ? '<span class="' + cls + '">' + esc(l) + "</span>" : esc(l);
+    });
+    $historyDiff.innerHTML = lines.join("\n");
+    $historyDiff.classList.remove("hidden");
+  }
+
+  function restoreRevision(rev) {
+    if (!confirm("Restore " + rev.path + " to this version?")) return;
+    fetch("/api/history/restore", {
+      method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify({ id: rev.id }),
+    }).then(function (r) { return r.json(); }).then(function (d) {
+      if (d.error) throw new Error(d.error);
+      $historyOverlay.classList.add("hidden");
+      var f = state.openFiles.find(function (f) { return f.path === d.path; });
+      if (f && !f.collab) refreshOpenFile(f);
+      $fileStatus.textContent = d.path + " — restored";
+    }).catch(function (e) { alert("Error: " + e.message); });
+  }
+
+  function showDeleted(prefix) {
+    openHistoryDialog(prefix ? "Deleted from " + prefix : "Recently deleted");
+    fetch("/api/history/deleted").then(function (r) { return r.json(); }).then(function (revs) {
+      $historyList.innerHTML = "";
+      revs = (revs || []).filter(function (rev) { return !prefix || rev.path.indexOf(prefix + "/") === 0; });
+      if (!revs.length) {
+        $historyList.innerHTML = '<div class="history-empty">Nothing to recover</div>';
+        return;
+      }
+      revs.forEach(function (rev) {
+        $historyList.appendChild(historyRow(rev.path, rev, [
+          { label: "Recover", editor: true, run: function () { recoverPath(rev.path); } },
+        ]));
+      });
+    });
+  }
+
+  function recoverPath(path) {
+    fetch("/api/history/recover", {
+      method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify({ path: path }),
+    }).then(function (r) { return r.json(); }).then(function (d) {
+      if (d.error) throw new Error(d.error);
+      $historyOverlay.classList.add("hidden");
+      loadFileTree();
+      $fileStatus.textContent = "Recovered " + d.recovered.join(", ");
+    }).catch(function (e) { alert("Error: " + e.message); });
+  }
+
+  document.getElementById("history-close").addEventListener("click", function () { $historyOverlay.classList.add("hidden"); });
+
+  // ── Git ─────────────────────────────────────────────────
+
+  var $gitPanel = document.getElementById("git-panel");
+  var $gitFiles = document.getElementById("git-files");
+  var $gitBranch = document.getElementById("git-branch");
+  var $gitMessage = document.getElementById("git-message");
+  var gitTimer = null;
+
+  var GIT_LETTERS = {
+    modified: "M", added: "A", deleted: "D", renamed: "R", untracked: "U", conflicted: "!",
+  };
+
+  function gitPost(action, body) {
+    return fetch("/api/git/" + action, {
+      method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify(body || {}),
+    }).then(function (r) { return r.json(); }).then(function (d) {
+      if (d.error) throw new Error(d.error);
+      return d;
+    });
+  }
+
+  function loadGitStatus() {
+    fetch("/api/git/status").then(function (r) { return r.ok ? r.json() : null; })
+      .then(function (status) { if (status) renderGitStatus(status); })
+      .catch(function () {});
+  }
+
+  // scheduleGitStatus refreshes the status once a burst of file events settles.
+  function scheduleGitStatus() {
+    clearTimeout(gitTimer);
+    gitTimer = setTimeout(loadGitStatus, 500);
+  }
+
+  function renderGitStatus(status) {
+    state.git = status;
+    document.getElementById("btn-git").classList.toggle("hidden", !status.repo);
+    if (!status.repo) {
+      if (!$gitPanel.classList.contains("hidden")) toggleGitPanel(false);
+      return;
+    }
+
+    var sync = [];
+    if (status.ahead) sync.push("\u2191" + status.ahead);
+    if (status.behind) sync.push("\u2193" + status.behind);
+    var $sync = document.getElementById("git-sync");
+    $sync.textContent = sync.join(" ");
+    $sync.title = status.upstream ? "Tracking " + status.upstream : "No upstream branch";
+    if (!$gitPanel.classList.contains("hidden") && $gitBranch.value !== status.branch) loadGitBranches();
+
+    $gitFiles.innerHTML = "";
+    if (!status.files.length) {
+      $gitFiles.innerHTML = '<div class="history-empty">No changes</div>';
+      return;
+    }
+    status.files.forEach(function (file) {
+      var row = document.createElement("div");
+      row.className = "tree-item file git-" + file.status;
+      row.title = file.from ? file.from + " \u2192 " + file.path : file.path;
+      row.innerHTML = '<input type="checkbox" class="git-stage needs-editor" title="Staged"' + (file.staged ? " checked" : "") + ">" +
+        '<span class="tree-label">' + esc(file.path) + '</span><span class="tree-git">' + GIT_LETTERS[file.status] + "</span>";
+      var box = row.querySelector("input");
+      box.addEventListener("click", function (e) {
+        e.stopPropagation();
+        gitPost(box.checked ? "stage" : "unstage", { paths: [file.path] })
+          .then(renderGitStatus)
+          .catch(function (err) { box.checked = !box.checked; alert("Error: " + err.message); });
+      });
+      row.addEventListener("click", function () { showGitDiff(file); });
+      $gitFiles.appendChild(row);
+    });
+  }
+
+  function loadGitBranches() {
+    fetch("/api/git/branches").then(function (r) { return r.json(); }).then(function (d) {
+      $gitBranch.innerHTML = "";
+      (d.branches || []).filter(function (b) { return !b.remote; }).forEach(function (b) {
+        var opt = document.createElement("option");
+        opt.value = b.name; opt.textContent = b.name; opt.selected = b.current;
+        $gitBranch.appendChild(opt);
+      });
+      if (state.git && state.git.detached) {
+        $gitBranch.insertAdjacentHTML("afterbegin", '<option value="" selected>(detached)</option>');
+      }
+      state.gitRemotes = d.remotes || [];
+    }).catch(function () {});
+  }
+
+  function showGitDiff(file) {
+    openHistoryDialog(file.path);
+    $historyList.innerHTML = "";
+    var staged = file.staged && file.worktree === " ";
+    fetch("/api/git/diff?path=" + encodeURIComponent(file.path) + (staged ? "&staged=1" : ""))
+      .then(function (r) { return r.json(); })
+      .then(function (d) {
+        if (d.error) throw new Error(d.error);
+        renderDiff(d.diff || (file.status === "deleted" ? "Deleted" : "No changes"));
+      })
+      .catch(function (e) { $historyList.innerHTML = '<div class="history-empty">' + esc(e.message) + "</div>"; });
+  }
+
+  // toggleGitPanel swaps the file tree and search for the list of changes.
+  function toggleGitPanel(open) {
+    var searching = !open && !!$searchInput.value;
+    $gitPanel.classList.toggle("hidden", !open);
+    document.querySelector(".search-box").classList.toggle("hidden", open);
+    $searchResults.classList.toggle("hidden", !searching);
+    $fileTree.classList.toggle("hidden", open || searching);
+    document.getElementById("btn-git").classList.toggle("active", open);
+    if (open) { loadGitStatus(); loadGitBranches(); }
+  }
+
+  document.getElementById("btn-git").addEventListener("click", function () {
+    toggleGitPanel($gitPanel.classList.contains("hidden"));
+  });
+
+  $gitBranch.addEventListener("change", function () {
+    if (!$gitBranch.value) return;
+    gitPost("checkout", { branch: $gitBranch.value })
+      .then(function (status) { renderGitStatus(status); loadFileTree(); })
+      .catch(function (e) { alert("Error: " + e.message); loadGitBranches(); });
+  });
+
+  document.getElementById("git-new-branch").addEventListener("click", function () {
+    var name = prompt("New branch from " + ($gitBranch.value || "HEAD") + ":");
+    if (!name) return;
+    gitPost("checkout", { branch: name.trim(), create: true })
+      .then(function (status) { renderGitStatus(status); loadGitBranches(); })
+      .catch(function (e) { alert("Error: " + e.message); });
+  });
+
+  document.getElementById("git-stage-all").addEventListener("click", function () {
+    gitPost("stage", { all: true }).then(renderGitStatus).catch(function (e) { alert("Error: " + e.message); });
+  });
+
+  document.getElementById("git-commit").addEventListener("click", function () {
+    var message = $gitMessage.value.trim();
+    if (!message) { $gitMessage.focus(); return; }
+    // Nothing staged commits every change, as the button reads.
+    var staged = state.git && state.git.files.some(function (f) { return f.staged; });
+    gitPost("commit", { message: message, all: !staged }).then(function (d) {
+      $gitMessage.value = "";
+      $fileStatus.textContent = "Committed " + (d.commit || "").slice(0, 7) + " \u2014 " + (d.subject || message);
+      loadGitStatus();
+    }).catch(function (e) { alert("Error: " + e.message); });
+  });
+
+  ["pull", "push"].forEach(function (action) {
+    var btn = document.getElementById("git-" + action);
+    btn.addEventListener("click", function () {
+      var body = {};
+      // A branch that doesn't track anything yet is pushed to the first remote.
+      if (action === "push" && state.git && !state.git.upstream) {
+        if (!state.gitRemotes || !state.gitRemotes.length) { alert("This repository has no remote"); return; }
+        body = { remote: state.gitRemotes[0], branch: state.git.branch, set_upstream: true };
+      }
+      btn.disabled = true;
+      $fileStatus.textContent = (action === "pull" ? "Pulling" : "Pushing") + "...";
+      gitPost(action, body).then(function (d) {
+        $fileStatus.textContent = (d.output || "").split("\n").pop() || "Done";
+        if (action === "pull") loadFileTree();
+      }).catch(function (e) {
+        $fileStatus.textContent = "";
+        alert(e.message);
+      }).then(function () { btn.disabled = false; loadGitStatus(); });
+    });
+  });
+
+  // ── Search and replace ──────────────────────────────────
+
+  var $searchInput = document.getElementById("search-input");
+  var $replaceInput = document.getElementById("replace-input");
+  var $searchResults = document.getElementById("search-results");
+  var searchTimer = null;
+  var searchFlags = { "case": false, regex: false };
+
+  function searchParams() {
+    return "q=" + encodeURIComponent($searchInput.value) +
+      (searchFlags["case"] ? "&case=1" : "") + (searchFlags.regex ? "&regex=1" : "");
+  }
+
+  function runSearch() {
+    var q = $searchInput.value;
+    document.getElementById("replace-row").classList.toggle("hidden", !q);
+    $searchResults.classList.toggle("hidden", !q);
+    $fileTree.classList.toggle("hidden", !!q);
+    if (!q) return;
+    fetch("/api/search?" + searchParams())
+      .then(function (r) { return r.json(); })
+      .then(function (d) { if ($searchInput.value === q) renderSearchResults(d); })
+      .catch(function () {});
+  }
+
+  function renderSearchResults(d) {
+    $searchResults.innerHTML = "";
+    var summary = document.createElement("div");
+    summary.className = "search-summary";
+    if (d.error) summary.textContent = d.error;
+    else if (!d.matches) summary.textContent = "No results";
+    else summary.textContent = d.matches + (d.truncated ? "+" : "") + " in " + d.files.length + (d.files.length === 1 ? " file" : " files");
+    $searchResults.appendChild(summary);
+
+    (d.files || []).forEach(function (file) {
+      var head = document.createElement("div");
+      head.className = "tree-item search-file";
+      head.innerHTML = '<span class="tree-label">' + esc(file.path) + '</span><span class="search-count">' + file.matches.length + "</span>";
+      $searchResults.appendChild(head);
+      file.matches.forEach(function (m) {
+        var row = document.createElement("div");
+        row.className = "search-match";
+        var text = m.text;
+        // Long lines are shortened around the match; only highlight whole ones.
+        var html = text.charAt(0) === "\u2026" ? esc(text) :
+          esc(text.slice(0, m.column - 1)) + "<mark>" + esc(text.slice(m.column - 1, m.column - 1 + m.length)) + "</mark>" + esc(text.slice(m.column - 1 + m.length));
+        row.innerHTML = '<span class="search-line">' + m.line + "</span>" + html;
+        row.addEventListener("click", function () { openSearchMatch(file.path, m); });
+        $searchResults.appendChild(row);
+      });
+    });
+  }
+
+  function openSearchMatch(path, m) {
+    var reveal = function () {
+      if (!editor || state.activeFile !== path) return;
+      editor.setSelection(new monaco.Range(m.line, m.column, m.line, m.column + m.length));
+      editor.revealLineInCenter(m.line);
+      editor.focus();
+    };
+    if (state.openFiles.find(function (f) { return f.path === path; })) {
+      openFileInEditor(path, "");
+      reveal();
+      return;
+    }
+    fetch("/api/files/" + path).then(function (r) { return r.json(); })
+      .then(function (d) { addOpenFile(path, d.content, d.hash); reveal(); });
+  }
+
+  $searchInput.addEventListener("input", function () {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(runSearch, 250);
+  });
+
+  ["case", "regex"].forEach(function (flag) {
+    var btn = document.getElementById("search-" + flag);
+    btn.addEventListener("click", function () {
+      searchFlags[flag] = !searchFlags[flag];
+      btn.classList.toggle("on", searchFlags[flag]);
+      runSearch();
+    });
+  });
+
+  // Replace all previews the change first, and asks before applying it.
+  document.getElementById("btn-replace-all").addEventListener("click", function () {
+    var body = {
+      query: $searchInput.value, replace: $replaceInput.value,
+      regex: searchFlags.regex, case_sensitive: searchFlags["case"],
+    };
+    var replace = function (dryRun) {
+      body.dry_run = dryRun;
+      return fetch("/api/replace", { method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify(body) })
+        .then(function (r) { return r.json(); });
+    };
+    replace(true).then(function (d) {
+      if (d.error) throw new Error(d.error);
+      if (!d.replacements) { alert("Nothing to replace"); return; }
+      var files = d.files.map(function (f) { return f.path; }).join("\n");
+      if (!confirm("Replace " + d.replacements + " matches in " + d.files.length + " files?\n\n" + files)) return;
+      return replace(false).then(function (d) {
+        if (d.error) throw new Error(d.error);
+        $fileStatus.textContent = "Replaced " + d.replacements + " matches";
+        runSearch();
+      });
+    }).catch(function (e) { alert("Error: " + e.message); });
+  });
+
   function highlightActiveTreeItem(filePath) {
     $fileTree.querySelectorAll(".tree-item.file").forEach(function (el) {
       el.classList.toggle("active", el.getAttribute("data-path") === filePath);
@@ -760,17 +1388,46 @@ window.reloadFrame = function (iframe, overlay) {
     var source = new EventSource("/api/events");
     source.addEventListener("build-start", function () {
       $buildStatus.textContent = "Building..."; $buildStatus.className = "building";
+      $buildStatus.title = opendocAuth.can("editor") ? "Click to cancel" : "";
+    });
+    source.addEventListener("build-progress", function (e) {
+      var p = JSON.parse(e.data);
+      if (!p.total || p.phase === "done") return;
+      $buildStatus.textContent = "Building " + Math.floor(p.done * 100 / p.total) + "%";
+      $buildStatus.className = "building";
     });
     source.addEventListener("build-complete", function (e) {
       var data = JSON.parse(e.data);
-      if (data.success) {
-        $buildStatus.textContent = "Built"; $buildStatus.className = "success";
+      var warnings = data.warnings || [];
+      warnings.forEach(function (w) { console.warn("[build] " + w); });
+      var took = data.build ? (data.build.duration_ms / 1000).toFixed(1) + "s, " + data.build.triggers.join(", ") : "";
+      $buildStatus.title = [took].concat(warnings).filter(Boolean).join("\n");
+      if (data.cancelled) {
+        $buildStatus.textContent = "Cancelled"; $buildStatus.className = "";
+        setTimeout(function () { if ($buildStatus.textContent === "Cancelled") $buildStatus.textContent = ""; }, 3000);
+      } else if (data.success) {
+        $buildStatus.textContent = warnings.length ? "Built \u00b7 " + warnings.length + (warnings.length === 1 ? " warning" : " warnings") : "Built";
+        $buildStatus.className = "success";
         document.querySelectorAll(".user-site-frame").forEach(function (f) { window.reloadFrame(f); });
         setTimeout(function () { $buildStatus.textContent = ""; $buildStatus.className = ""; }, 3000);
       } else { $buildStatus.textContent = "Failed"; $buildStatus.className = "error"; }
     });
-    source.addEventListener("file-changed", function () { loadFileTree(); });
-    source.addEventListener("file-deleted", function () { loadFileTree(); });
+    source.addEventListener("file-changed", function (e) {
+      loadFileTree();
+      scheduleGitStatus();
+      var d = JSON.parse(e.data);
+      var f = state.openFiles.find(function (f) { return f.path === d.path; });
+      if (f && !f.collab && d.hash && d.hash !== f.hash && !f.saving) refreshOpenFile(f);
+    });
+    source.addEventListener("collab-presence", function (e) {
+      state.presence = JSON.parse(e.data);
+      renderPresence();
+    });
+    source.addEventListener("file-deleted", function () { loadFileTree(); scheduleGitStatus(); });
+    source.addEventListener("git-status", function (e) {
+      renderGitStatus(JSON.parse(e.data));
+      loadFileTree();
+    });
     source.addEventListener("settings-changed", function (e) {
       var s = JSON.parse(e.data);
       state.settings = s;
@@ -847,10 +1504,15 @@ window.reloadFrame = function (iframe, overlay) {
   document.getElementById("btn-build").addEventListener("click", function () {
     fetch("/api/opendoc/build", { method: "POST" })
       .then(function (r) { return r.json(); })
-      .then(function (d) { if (!d.success && d.error) { $buildStatus.textContent = d.error; $buildStatus.className = "error"; } })
+      .then(function (d) { if (!d.success && !d.cancelled && d.error) { $buildStatus.textContent = d.error; $buildStatus.className = "error"; } })
       .catch(function () { $buildStatus.textContent = "Failed"; $buildStatus.className = "error"; });
   });
 
+  $buildStatus.addEventListener("click", function () {
+    if ($buildStatus.className !== "building" || !opendocAuth.can("editor")) return;
+    fetch("/api/opendoc/build/cancel", { method: "POST" }).catch(function () {});
+  });
+
   // ── Publish build ──────────────────────────────────────
 
   var $publishStatus = document.getElementById("publish-status");
@@ -886,11 +1548,14 @@ window.reloadFrame = function (iframe, overlay) {
 
   var $deployOverlay = document.getElementById("deploy-overlay");
   var $deployRepo = document.getElementById("deploy-repo");
+  var $deployTarget = document.getElementById("deploy-target");
   var $deployLog = document.getElementById("deploy-log");
   var $deployLogArea = document.getElementById("deploy-log-area");
   var $deployResult = document.getElementById("deploy-result");
   var $deployStatus = document.getElementById("deploy-status");
   var $btnDeployStart = document.getElementById("btn-deploy-start");
+  var $deployPreview = document.getElementById("deploy-preview");
+  var deployPlan = null; // the previewed plan awaiting confirmation
 
   document.getElementById("btn-publish-deploy").addEventListener("click", openDeployModal);
   document.getElementById("deploy-close").addEventListener("click", closeDeployModal);
@@ -905,15 +1570,57 @@ window.reloadFrame = function (iframe, overlay) {
     $deployLog.textContent = "";
     $deployStatus.textContent = "";
     $btnDeployStart.disabled = true;
-    $btnDeployStart.innerHTML = '<svg width="14" height="14" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M22 2L11 13"/><polygon points="22 2 15 22 11 13 2 9 22 2"/></svg> Deploy Now';
+    resetDeployPreview();
 
     // Pre-fill repo from settings
     if (state.settings && state.settings.github_repo) {
       $deployRepo.value = state.settings.github_repo;
     }
 
-    // Run preflight checks
+    // Load deploy targets, then run preflight checks
+    loadDeployTargets().then(runDeployChecks);
+  }
+
+  // Deploy targets come from opendoc.yml. Only github-pages targets need
+  // the gh CLI and a repository.
+  function loadDeployTargets() {
+    return fetch("/api/integrations/deploy-targets").then(function (r) { return r.json(); })
+      .then(function (targets) {
+        if (!Array.isArray(targets)) targets = [];
+        $deployTarget.innerHTML = "";
+        targets.forEach(function (t) {
+          var opt = document.createElement("option");
+          opt.value = t.name;
+          opt.textContent = t.name + " (" + t.type + ")";
+          opt.dataset.type = t.type;
+          if (t.default) opt.selected = true;
+          $deployTarget.appendChild(opt);
+        });
+        document.getElementById("deploy-target-field").classList.toggle("hidden", targets.length < 2);
+      })
+      .catch(function () {});
+  }
+
+  function isGitHubTarget() {
+    var opt = $deployTarget.options[$deployTarget.selectedIndex];
+    return !opt || opt.dataset.type === "github-pages";
+  }
+
+  $deployTarget.addEventListener("change", function () {
+    resetDeployPreview();
     runDeployChecks();
+  });
+
+  function setDeployButton(label) {
+    $btnDeployStart.innerHTML = '<svg width="14" height="14" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M22 2L11 13"/><polygon points="22 2 15 22 11 13 2 9 22 2"/></svg> ' + label;
+  }
+
+  // Deploying is two steps: review the changes against the deployed site,
+  // then confirm. Changing the target or repository starts over.
+  function resetDeployPreview() {
+    deployPlan = null;
+    $deployPreview.classList.add("hidden");
+    setDeployButton("Review Changes");
   }
 
   function closeDeployModal() {
@@ -921,6 +1628,14 @@ window.reloadFrame = function (iframe, overlay) {
   }
 
   function runDeployChecks() {
+    var github = isGitHubTarget();
+    document.getElementById("deploy-repo-field").classList.toggle("hidden", !github);
+    document.getElementById("deploy-checks").classList.toggle("hidden", !github);
+    if (!github) {
+      $btnDeployStart.disabled = false;
+      return;
+    }
+
     var checkGH = document.getElementById("deploy-check-gh");
     var checkAuth = document.getElementById("deploy-check-auth");
     var checkRepo = document.getElementById("deploy-check-repo");
@@ -978,6 +1693,7 @@ window.reloadFrame = function (iframe, overlay) {
 
   // Re-check when repo input changes
   $deployRepo.addEventListener("input", function () {
+    resetDeployPreview();
     var checkRepo = document.getElementById("deploy-check-repo");
     var val = $deployRepo.value.trim();
     if (val && val.indexOf("/") !== -1) {
@@ -996,12 +1712,87 @@ window.reloadFrame = function (iframe, overlay) {
 
   $btnDeployStart.addEventListener("click", function () {
     var repo = $deployRepo.value.trim();
-    if (!repo) return;
+    var github = isGitHubTarget();
+    if (github && !repo) return;
+    var request = { repo: github ? repo : "", target: $deployTarget.value };
+    if (deployPlan) startDeploy(request); else previewDeploy(request);
+  });
+
+  function previewDeploy(request) {
+    $btnDeployStart.disabled = true;
+    $btnDeployStart.innerHTML = '<span class="deploy-spinner"></span> Building...';
+    $deployStatus.style.color = "";
+    $deployStatus.textContent = "Building and comparing with the deployed site...";
+    $deployLogArea.classList.add("hidden");
+    $deployResult.classList.add("hidden");
+
+    fetch("/api/integrations/publish-preview", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(request),
+    })
+      .then(function (r) { return r.json(); })
+      .then(function (d) {
+        $btnDeployStart.disabled = false;
+        if (!d.success) {
+          $deployStatus.textContent = d.error || "Preview failed";
+          $deployStatus.style.color = "var(--danger)";
+          setDeployButton("Review Changes");
+          return;
+        }
+        deployPlan = d;
+        renderDeployPreview(d.diff);
+        $deployStatus.textContent = d.diff.pages.length + " page(s) changed on " + d.destination;
+        setDeployButton("Confirm Deploy");
+      })
+      .catch(function (e) {
+        $deployStatus.textContent = "Network error: " + e.message;
+        $deployStatus.style.color = "var(--danger)";
+        $btnDeployStart.disabled = false;
+        setDeployButton("Review Changes");
+      });
+  }
+
+  function renderDeployPreview(diff) {
+    var summary = "Changes";
+    if (diff.baseline === "none") summary = "Changes (nothing deployed yet)";
+    else if (diff.baseline === "manifest") summary = "Changes since the last deploy from this project";
+    document.getElementById("deploy-preview-summary").textContent = summary;
+
+    var markers = { added: "+", modified: "~", deleted: "-" };
+    var html = "";
+    diff.pages.forEach(function (p) {
+      var count = p.status === "modified" ? "+" + p.added + " -" + p.removed : "";
+      var lines = p.diff.split("\n").slice(2).map(function (l) {
+        var cls = l.charAt(0) === "+" ? "add" : l.charAt(0) === "-" ? "del" : l.indexOf("@@") === 0 ? "hunk" : "";
+        return cls ? '<span class="' + cls + '">' + esc(l) + "</span>" : esc(l);
+      });
+      html += '<details class="deploy-preview-page ' + p.status + '"><summary>' +
+        '<span class="deploy-preview-status">' + markers[p.status] + "</span>" +
+        '<span class="deploy-preview-url">' + esc(p.url) + "</span>" +
+        '<span class="deploy-preview-title">' + esc(p.title) + "</span>" +
+        '<span class="deploy-preview-count">' + count + "</span>" +
+        '</summary><pre class="deploy-preview-diff">' + lines.join("\n") + "</pre></details>";
+    });
+    if (diff.files.length) {
+      html += '<div class="deploy-preview-files">' + diff.files.length + " other file(s): assets and layout changes</div>";
+    }
+    if (!diff.pages.length && !diff.files.length) {
+      html = '<div class="deploy-preview-files">No changes since the last deploy</div>';
+    }
+    document.getElementById("deploy-preview-list").innerHTML = html;
+    $deployPreview.classList.remove("hidden");
+  }
+
+  function startDeploy(request) {
+    request.expect = deployPlan.fingerprint;
 
     // Show spinner
     $btnDeployStart.disabled = true;
     $btnDeployStart.innerHTML = '<span class="deploy-spinner"></span> Deploying...';
+    $deployStatus.style.color = "";
     $deployStatus.textContent = "Building and deploying...";
+    $deployPreview.classList.add("hidden");
     $deployLogArea.classList.remove("hidden");
     $deployResult.classList.add("hidden");
     $deployLog.textContent = "Starting publish build...\n";
@@ -1009,36 +1800,38 @@ window.reloadFrame = function (iframe, overlay) {
     fetch("/api/integrations/publish-deploy", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
-      body: JSON.stringify({ repo: repo }),
+      body: JSON.stringify(request),
     })
       .then(function (r) { return r.json(); })
       .then(function (d) {
         if (d.log) $deployLog.textContent += d.log + "\n";
+        deployPlan = null;
 
         if (d.success) {
           $deployStatus.textContent = "";
           $deployResult.classList.remove("hidden");
           document.getElementById("deploy-result-icon").textContent = "🎉";
-          document.getElementById("deploy-result-text").textContent = "Successfully deployed to " + d.repo;
+          document.getElementById("deploy-result-text").textContent = "Successfully deployed to " + (d.destination || d.repo);
           var link = document.getElementById("deploy-result-link");
           if (d.url) { link.textContent = d.url; link.href = d.url; } else { link.textContent = ""; }
-          $btnDeployStart.innerHTML = '<svg width="14" height="14" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M22 2L11 13"/><polygon points="22 2 15 22 11 13 2 9 22 2"/></svg> Deploy Again';
+          setDeployButton("Review Changes");
           $btnDeployStart.disabled = false;
         } else {
           $deployStatus.textContent = d.error || "Deploy failed";
           $deployStatus.style.color = "var(--danger)";
           $deployLog.textContent += "\nError: " + (d.error || "Unknown error") + "\n";
-          $btnDeployStart.innerHTML = '<svg width="14" height="14" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M22 2L11 13"/><polygon points="22 2 15 22 11 13 2 9 22 2"/></svg> Retry';
+          setDeployButton("Review Again");
           $btnDeployStart.disabled = false;
         }
       })
       .catch(function (e) {
+        deployPlan = null;
         $deployStatus.textContent = "Network error: " + e.message;
         $deployStatus.style.color = "var(--danger)";
-        $btnDeployStart.innerHTML = '<svg width="14" height="14" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M22 2L11 13"/><polygon points="22 2 15 22 11 13 2 9 22 2"/></svg> Retry';
+        setDeployButton("Review Again");
         $btnDeployStart.disabled = false;
       });
-  });
+  }
 
   // ── New file dialog ─────────────────────────────────────
 
@@ -1067,29 +1860,43 @@ window.reloadFrame = function (iframe, overlay) {
     }
     fetch("/api/files/" + fp, { method: "POST", headers: { "Content-Type": "text/plain" }, body: content })
       .then(function (r) { if (!r.ok) throw new Error("Failed"); return r.json(); })
-      .then(function () { $dialogOverlay.classList.add("hidden"); loadFileTree(); switchMode("editor"); addOpenFile(fp, content); })
+      .then(function (d) { $dialogOverlay.classList.add("hidden"); loadFileTree(); switchMode("editor"); addOpenFile(fp, content, d.hash); })
       .catch(function (e) { alert("Error: " + e.message); });
   }
 
   // ── Keyboard shortcuts ──────────────────────────────────
 
   document.addEventListener("keydown", function (e) {
-    if ((e.metaKey || e.ctrlKey) && e.key === "b") { e.preventDefault(); document.getElementById("btn-build").click(); }
+    if ((e.metaKey || e.ctrlKey) && e.key === "b") { e.preventDefault(); if (opendocAuth.can("editor")) document.getElementById("btn-build").click(); }
     if ((e.metaKey || e.ctrlKey) && e.key === "1") { e.preventDefault(); switchMode("editor"); }
     if ((e.metaKey || e.ctrlKey) && e.key === "2") { e.preventDefault(); switchMode("user"); }
     if ((e.metaKey || e.ctrlKey) && e.key === "3") { e.preventDefault(); switchMode("publish"); }
     if (e.key === "Escape") {
       if (state.menuOpen) closeMenu();
       $dialogOverlay.classList.add("hidden");
+      $historyOverlay.classList.add("hidden");
     }
   });
 
+  document.getElementById("btn-sign-out").addEventListener("click", function () {
+    opendocAuth.logout();
+  });
+
   // ── Init ────────────────────────────────────────────────
 
   function init() {
     loadFileTree();
+    loadGitStatus();
+    fetch("/api/collab/presence").then(function (r) { return r.ok ? r.json() : []; })
+      .then(function (list) { state.presence = list; renderPresence(); })
+      .catch(function () {});
     initEditor();
-    initTerminal();
+    opendocAuth.ready.then(function (user) {
+      document.getElementById("menu-user-name").textContent = "Sign out " + user.name;
+      document.getElementById("menu-user-role").textContent = user.role;
+      // The console is a shell on the server: admins only.
+      if (opendocAuth.can("admin")) initTerminal();
+    });
     initResizer();
     connectSSE();
 
@@ -0,0 +1,63 @@
+/**
+ * OpenDoc Workbench — Session
+ *
+ * Loads the signed-in user, adds the CSRF token to every request that
+ * changes something, and returns to the sign-in page when the session
+ * ends. Elements marked needs-editor, needs-publisher or needs-admin are
+ * hidden from users below that role (see workbench.css).
+ */
+(function () {
+  "use strict";
+
+  var ROLES = ["viewer", "editor", "publisher", "admin"];
+  var nativeFetch = window.fetch.bind(window);
+
+  var auth = { user: null, csrf: "" };
+
+  function toLogin() {
+    location.href = "/login";
+  }
+
+  // can reports whether the signed-in user has at least the given role.
+  auth.can = function (role) {
+    return !!auth.user && ROLES.indexOf(auth.user.role) >= ROLES.indexOf(role);
+  };
+
+  // ready resolves with the user once the session is known. It never
+  // resolves when signed out: the page is on its way to /login.
+  auth.ready = nativeFetch("/api/auth/me").then(function (r) {
+    if (r.status === 401) {
+      toLogin();
+      return new Promise(function () {});
+    }
+    return r.json();
+  }).then(function (me) {
+    auth.user = { name: me.name, role: me.role };
+    auth.csrf = me.csrf_token || "";
+    document.documentElement.setAttribute("data-role", me.role);
+    return auth.user;
+  });
+
+  window.fetch = function (input, init) {
+    init = init || {};
+    var method = (init.method || "GET").toUpperCase();
+    var unsafe = method !== "GET" && method !== "HEAD";
+    return (unsafe ? auth.ready : Promise.resolve()).then(function () {
+      if (unsafe) {
+        var headers = new Headers(init.headers || {});
+        headers.set("X-CSRF-Token", auth.csrf);
+        init = Object.assign({}, init, { headers: headers });
+      }
+      return nativeFetch(input, init);
+    }).then(function (r) {
+      if (r.status === 401) toLogin();
+      return r;
+    });
+  };
+
+  auth.logout = function () {
+    return window.fetch("/api/auth/logout", { method: "POST" }).then(toLogin, toLogin);
+  };
+
+  window.opendocAuth = auth;
+})();
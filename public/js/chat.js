@@ -58,6 +58,7 @@
     sparkle: '<svg width="18" height="18" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round"><path d="M12 3l1.5 5.5L19 10l-5.5 1.5L12 17l-1.5-5.5L5 10l5.5-1.5L12 3z"/></svg>',
     file: '<svg width="12" height="12" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"><path d="M14.5 2H6a2 2 0 0 0-2 2v16a2 2 0 0 0 2 2h12a2 2 0 0 0 2-2V7.5L14.5 2z"/><polyline points="14 2 14 8 20 8"/></svg>',
     copy: '<svg width="11" height="11" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><rect x="9" y="9" width="13" height="13" rx="2"/><path d="M5 15H4a2 2 0 0 1-2-2V4a2 2 0 0 1 2-2h9a2 2 0 0 1 2 2v1"/></svg>',
+    search: '<svg width="12" height="12" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"><circle cx="11" cy="11" r="7"/><line x1="21" y1="21" x2="16.65" y2="16.65"/></svg>',
     copied: '<svg width="11" height="11" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><polyline points="20 6 9 17 4 12"/></svg>',
   };
 
@@ -67,6 +68,8 @@
     write_file: { icon: "pencil",  label: "Write file",      detailKey: "path" },
     edit_file:  { icon: "edit",    label: "Edit file",       detailKey: "path" },
     list_files: { icon: "folder",  label: "List files",      detailKey: "path" },
+    search_files: { icon: "search", label: "Search files",  detailKey: "query" },
+    replace_in_files: { icon: "edit", label: "Replace in files", detailKey: "query" },
     build:      { icon: "hammer",  label: "Build site",      detailKey: null },
     get_config: { icon: "settings",label: "Read config",     detailKey: null },
     update_nav: { icon: "nav",     label: "Update navigation", detailKey: null },
@@ -0,0 +1,362 @@
+/**
+ * OpenDoc Workbench — Collaborative editing
+ *
+ * Keeps a Monaco model in sync with everyone else editing the same file,
+ * through /api/collab/ws. Edits travel as operations in the ot.js format
+ * ([retain, "insert", -delete]); the server orders them and this client
+ * transforms what it hasn't had confirmed yet past what others did.
+ * Other people's cursors are shown as coloured decorations.
+ */
+(function () {
+  "use strict";
+
+  // ── Operations ──────────────────────────────────────────
+
+  function isRetain(c) { return typeof c === "number" && c > 0; }
+  function isDelete(c) { return typeof c === "number" && c < 0; }
+  function isInsert(c) { return typeof c === "string"; }
+
+  function Op() { this.ops = []; }
+
+  Op.prototype.retain = function (n) {
+    if (n <= 0) return this;
+    var last = this.ops.length - 1;
+    if (last >= 0 && isRetain(this.ops[last])) this.ops[last] += n;
+    else this.ops.push(n);
+    return this;
+  };
+
+  Op.prototype.insert = function (s) {
+    if (!s) return this;
+    var ops = this.ops, last = ops.length - 1;
+    if (last >= 0 && isInsert(ops[last])) ops[last] += s;
+    else if (last >= 0 && isDelete(ops[last])) {
+      // Inserts go before deletes, so equal edits have one form.
+      if (last > 0 && isInsert(ops[last - 1])) ops[last - 1] += s;
+      else { ops.push(ops[last]); ops[last] = s; }
+    } else ops.push(s);
+    return this;
+  };
+
+  Op.prototype.delete = function (n) {
+    if (n <= 0) return this;
+    var last = this.ops.length - 1;
+    if (last >= 0 && isDelete(this.ops[last])) this.ops[last] -= n;
+    else this.ops.push(-n);
+    return this;
+  };
+
+  Op.prototype.baseLength = function () {
+    var n = 0;
+    this.ops.forEach(function (c) { if (isRetain(c)) n += c; else if (isDelete(c)) n -= c; });
+    return n;
+  };
+
+  Op.prototype.apply = function (doc) {
+    var out = [], i = 0;
+    this.ops.forEach(function (c) {
+      if (isRetain(c)) { out.push(doc.slice(i, i + c)); i += c; }
+      else if (isInsert(c)) out.push(c);
+      else i -= c;
+    });
+    return out.join("");
+  };
+
+  // transformIndex moves a position through the operation.
+  Op.prototype.transformIndex = function (pos) {
+    var newPos = pos, i = 0;
+    for (var k = 0; k < this.ops.length && i <= pos; k++) {
+      var c = this.ops[k];
+      if (isRetain(c)) i += c;
+      else if (isInsert(c)) newPos += c.length;
+      else { newPos -= Math.min(pos - i, -c); i -= c; }
+    }
+    return newPos;
+  };
+
+  Op.fromJSON = function (ops) {
+    var op = new Op();
+    ops.forEach(function (c) {
+      if (isRetain(c)) op.retain(c); else if (isDelete(c)) op.delete(-c); else op.insert(c);
+    });
+    return op;
+  };
+
+  // compose returns one operation doing a then b.
+  Op.compose = function (a, b) {
+    var out = new Op(), i = 0, j = 0;
+    var x = a.ops[i++], y = b.ops[j++];
+    while (x !== undefined || y !== undefined) {
+      if (isDelete(x)) { out.delete(-x); x = a.ops[i++]; continue; }
+      if (isInsert(y)) { out.insert(y); y = b.ops[j++]; continue; }
+      if (x === undefined || y === undefined) throw new Error("compose: length mismatch");
+
+      if (isRetain(x) && isRetain(y)) {
+        var n = Math.min(x, y); out.retain(n);
+        x = x > n ? x - n : a.ops[i++]; y = y > n ? y - n : b.ops[j++];
+      } else if (isInsert(x) && isDelete(y)) {
+        var m = Math.min(x.length, -y);
+        x = x.length > m ? x.slice(m) : a.ops[i++]; y = -y > m ? y + m : b.ops[j++];
+      } else if (isInsert(x) && isRetain(y)) {
+        var p = Math.min(x.length, y); out.insert(x.slice(0, p));
+        x = x.length > p ? x.slice(p) : a.ops[i++]; y = y > p ? y - p : b.ops[j++];
+      } else { // retain, delete
+        var q = Math.min(x, -y); out.delete(q);
+        x = x > q ? x - q : a.ops[i++]; y = -y > q ? y + q : b.ops[j++];
+      }
+    }
+    return out;
+  };
+
+  // transform returns [a', b'] so that a then b' equals b then a'. When
+  // both insert at one place, a's text comes first, as on the server.
+  Op.transform = function (a, b) {
+    var a2 = new Op(), b2 = new Op(), i = 0, j = 0;
+    var x = a.ops[i++], y = b.ops[j++];
+    while (x !== undefined || y !== undefined) {
+      if (isInsert(x)) { a2.insert(x); b2.retain(x.length); x = a.ops[i++]; continue; }
+      if (isInsert(y)) { a2.retain(y.length); b2.insert(y); y = b.ops[j++]; continue; }
+      if (x === undefined || y === undefined) throw new Error("transform: length mismatch");
+
+      var xn = Math.abs(x), yn = Math.abs(y), n = Math.min(xn, yn);
+      if (isRetain(x) && isRetain(y)) { a2.retain(n); b2.retain(n); }
+      else if (isDelete(x) && isRetain(y)) a2.delete(n);
+      else if (isRetain(x) && isDelete(y)) b2.delete(n);
+
+      x = xn > n ? x - Math.sign(x) * n : a.ops[i++];
+      y = yn > n ? y - Math.sign(y) * n : b.ops[j++];
+    }
+    return [a2, b2];
+  };
+
+  // replaceOp turns text a into text b with one replacement.
+  function replaceOp(a, b) {
+    var prefix = 0;
+    while (prefix < a.length && prefix < b.length && a[prefix] === b[prefix]) prefix++;
+    var suffix = 0;
+    while (suffix < a.length - prefix && suffix < b.length - prefix &&
+      a[a.length - 1 - suffix] === b[b.length - 1 - suffix]) suffix++;
+    return new Op().retain(prefix).insert(b.slice(prefix, b.length - suffix))
+      .delete(a.length - prefix - suffix).retain(suffix);
+  }
+
+  // ── Session ─────────────────────────────────────────────
+
+  var PEER_COLORS = 6;
+
+  /**
+   * attach connects a model to the co-editing session for path.
+   * hooks: onStatus(text), onPeers(names), onSaved(hash),
+   * onUnavailable() when the server has no session for the file.
+   */
+  function attach(editor, model, path, hooks) {
+    var session = {
+      path: path, rev: 0, ready: false, closed: false,
+      outstanding: null, buffer: null, peers: {},
+    };
+    var ws = null, applying = false, decorations = [], retry = 1000;
+    var lastSynced = null;
+
+    model.setEOL(monaco.editor.EndOfLineSequence.LF);
+
+    function send(msg) { if (ws && ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify(msg)); }
+
+    function selection() {
+      if (editor.getModel() !== model) return null;
+      var sel = editor.getSelection();
+      return { anchor: model.getOffsetAt(sel.getSelectionStart()), head: model.getOffsetAt(sel.getPosition()) };
+    }
+
+    function sendOp(op) {
+      send({ type: "op", rev: session.rev, op: op.ops, cursor: selection() });
+    }
+
+    // Apply an operation from the server to the model as one edit.
+    function applyToModel(op) {
+      var edits = [], i = 0;
+      op.ops.forEach(function (c) {
+        if (isRetain(c)) { i += c; return; }
+        var start = model.getPositionAt(i);
+        if (isInsert(c)) {
+          edits.push({ range: new monaco.Range(start.lineNumber, start.column, start.lineNumber, start.column), text: c, forceMoveMarkers: true });
+        } else {
+          var end = model.getPositionAt(i - c);
+          edits.push({ range: new monaco.Range(start.lineNumber, start.column, end.lineNumber, end.column), text: "" });
+          i -= c;
+        }
+      });
+      applying = true;
+      try { model.pushEditOperations(editor.getModel() === model ? editor.getSelections() : [], edits, function () { return null; }); }
+      finally { applying = false; }
+      Object.keys(session.peers).forEach(function (id) { movePeer(session.peers[id], op); });
+      renderPeers();
+    }
+
+    // Local edits become operations.
+    var changeSub = model.onDidChangeContent(function (e) {
+      // Edits made while reconnecting are kept and sent afterwards.
+      if (applying || lastSynced === null || session.readOnly) return;
+      var changes = e.changes.slice().sort(function (a, b) { return a.rangeOffset - b.rangeOffset; });
+      var inserted = 0, removed = 0;
+      changes.forEach(function (c) { inserted += c.text.length; removed += c.rangeLength; });
+      var before = model.getValueLength() - inserted + removed;
+      var op = new Op(), pos = 0;
+      changes.forEach(function (c) {
+        op.retain(c.rangeOffset - pos).insert(c.text).delete(c.rangeLength);
+        pos = c.rangeOffset + c.rangeLength;
+      });
+      op.retain(before - pos);
+
+      Object.keys(session.peers).forEach(function (id) { movePeer(session.peers[id], op); });
+      renderPeers();
+
+      if (session.buffer) session.buffer = Op.compose(session.buffer, op);
+      else if (session.outstanding) session.buffer = op;
+      else { session.outstanding = op; sendOp(op); }
+      if (hooks.onStatus) hooks.onStatus("Editing");
+    });
+
+    var cursorTimer = null;
+    var cursorSub = editor.onDidChangeCursorSelection(function () {
+      if (!session.ready || editor.getModel() !== model || session.outstanding) return;
+      clearTimeout(cursorTimer);
+      cursorTimer = setTimeout(function () { send({ type: "cursor", rev: session.rev, cursor: selection() }); }, 80);
+    });
+
+    function movePeer(peer, op) {
+      if (!peer.cursor) return;
+      peer.cursor = { anchor: op.transformIndex(peer.cursor.anchor), head: op.transformIndex(peer.cursor.head) };
+    }
+
+    function renderPeers() {
+      var next = [];
+      Object.keys(session.peers).forEach(function (id) {
+        var p = session.peers[id];
+        if (!p.cursor) return;
+        var color = " c" + (p.client % PEER_COLORS);
+        var a = model.getPositionAt(p.cursor.anchor), h = model.getPositionAt(p.cursor.head);
+        var from = p.cursor.anchor < p.cursor.head ? a : h, to = p.cursor.anchor < p.cursor.head ? h : a;
+        if (p.cursor.anchor !== p.cursor.head) {
+          next.push({ range: new monaco.Range(from.lineNumber, from.column, to.lineNumber, to.column),
+            options: { className: "collab-selection" + color } });
+        }
+        next.push({ range: new monaco.Range(h.lineNumber, h.column, h.lineNumber, h.column),
+          options: { className: "collab-cursor" + color, hoverMessage: { value: p.name },
+            stickiness: monaco.editor.TrackedRangeStickiness.NeverGrowsWhenTypingAtEdges } });
+      });
+      decorations = model.deltaDecorations(decorations, next);
+      if (hooks.onPeers) {
+        var names = [];
+        Object.keys(session.peers).forEach(function (id) {
+          var n = session.peers[id].name;
+          if (names.indexOf(n) === -1) names.push(n);
+        });
+        hooks.onPeers(names);
+      }
+    }
+
+    function onMessage(msg) {
+      switch (msg.type) {
+        case "init":
+          var pending = session.outstanding ? (session.buffer ? Op.compose(session.outstanding, session.buffer) : session.outstanding) : null;
+          session.rev = msg.rev; session.client = msg.client; session.readOnly = msg.readOnly;
+          session.outstanding = null; session.buffer = null; session.peers = {};
+          (msg.peers || []).forEach(function (p) { session.peers[p.client] = p; });
+          var local = model.getValue();
+          session.ready = true;
+          if (pending && local !== msg.content) {
+            // Reconnected with edits the server never confirmed: keep them.
+            session.outstanding = replaceOp(msg.content, local);
+            sendOp(session.outstanding);
+          } else if (local !== msg.content) {
+            applyToModel(replaceOp(local, msg.content));
+          }
+          lastSynced = msg.content;
+          retry = 1000;
+          renderPeers();
+          if (hooks.onStatus) hooks.onStatus(msg.readOnly ? "Read only" : "Live");
+          break;
+        case "ack":
+          session.rev = msg.rev;
+          session.outstanding = session.buffer; session.buffer = null;
+          if (session.outstanding) sendOp(session.outstanding);
+          break;
+        case "op":
+          session.rev = msg.rev;
+          var op = Op.fromJSON(msg.op);
+          if (session.outstanding) {
+            var t = Op.transform(session.outstanding, op);
+            session.outstanding = t[0]; op = t[1];
+            if (session.buffer) {
+              var u = Op.transform(session.buffer, op);
+              session.buffer = u[0]; op = u[1];
+            }
+          }
+          applyToModel(op);
+          if (msg.client && session.peers[msg.client] && msg.cursor) {
+            session.peers[msg.client].cursor = msg.cursor;
+            renderPeers();
+          }
+          break;
+        case "cursor":
+          if (session.peers[msg.client]) { session.peers[msg.client].cursor = msg.cursor; renderPeers(); }
+          break;
+        case "join":
+          session.peers[msg.client] = { client: msg.client, name: msg.name, cursor: null };
+          renderPeers();
+          break;
+        case "leave":
+          delete session.peers[msg.client];
+          renderPeers();
+          break;
+        case "saved":
+          if (hooks.onSaved) hooks.onSaved(msg.hash);
+          break;
+        case "deleted":
+          // The file is gone: keep the text, and save it on its own.
+          if (hooks.onDeleted) hooks.onDeleted();
+          session.close();
+          break;
+        case "error":
+          console.warn("[collab] " + msg.error);
+          break;
+      }
+    }
+
+    function connect() {
+      if (session.closed) return;
+      var proto = location.protocol === "https:" ? "wss:" : "ws:";
+      var opened = false;
+      ws = new WebSocket(proto + "//" + location.host + "/api/collab/ws?path=" + encodeURIComponent(path));
+      ws.onopen = function () { opened = true; };
+      ws.onmessage = function (e) { onMessage(JSON.parse(e.data)); };
+      ws.onclose = function () {
+        session.ready = false;
+        if (session.closed) return;
+        if (!opened && lastSynced === null) {
+          // No session for this file (old server, or not a file): plain editing.
+          if (hooks.onUnavailable) hooks.onUnavailable();
+          session.close();
+          return;
+        }
+        if (hooks.onStatus) hooks.onStatus("Reconnecting...");
+        setTimeout(connect, retry);
+        retry = Math.min(retry * 2, 16000);
+      };
+    }
+
+    session.save = function () { send({ type: "save" }); };
+
+    session.close = function () {
+      session.closed = true;
+      changeSub.dispose(); cursorSub.dispose();
+      if (!model.isDisposed()) decorations = model.deltaDecorations(decorations, []);
+      if (ws) { ws.onclose = null; ws.close(); }
+    };
+
+    connect();
+    return session;
+  }
+
+  window.OpenDocCollab = { attach: attach, Op: Op };
+})();
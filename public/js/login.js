@@ -0,0 +1,71 @@
+/**
+ * OpenDoc Workbench — Sign-in page
+ *
+ * Signs in, or creates the first admin account while there is none. The
+ * setup code comes from the workbench log, which also prints it as a
+ * ready-made /login?setup=… link.
+ */
+(function () {
+  "use strict";
+
+  var params = new URLSearchParams(location.search);
+  var setup = false;
+
+  var $form = document.getElementById("login-form");
+  var $title = document.getElementById("login-title");
+  var $submit = document.getElementById("login-submit");
+  var $error = document.getElementById("login-error");
+  var $code = document.getElementById("setup-code");
+  var $name = document.getElementById("login-name");
+  var $password = document.getElementById("login-password");
+
+  function showSetup() {
+    setup = true;
+    $title.textContent = "Create admin account";
+    $submit.textContent = "Create account";
+    document.getElementById("setup-desc").classList.remove("hidden");
+    document.getElementById("setup-code-field").classList.remove("hidden");
+    $password.setAttribute("autocomplete", "new-password");
+    $code.value = params.get("setup") || "";
+    if (!$code.value) $code.focus();
+  }
+
+  function showError(message) {
+    $error.textContent = message;
+    $error.classList.remove("hidden");
+  }
+
+  fetch("/api/auth/me")
+    .then(function (r) {
+      if (r.ok) { location.replace("/"); return null; }
+      return r.json();
+    })
+    .then(function (data) { if (data && data.setup) showSetup(); })
+    .catch(function () {});
+
+  $form.addEventListener("submit", function (e) {
+    e.preventDefault();
+    $error.classList.add("hidden");
+    $submit.disabled = true;
+
+    var body = { name: $name.value.trim(), password: $password.value };
+    if (setup) body.code = $code.value.trim();
+
+    fetch(setup ? "/api/auth/setup" : "/api/auth/login", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    })
+      .then(function (r) {
+        return r.json().then(function (data) {
+          if (!r.ok) throw new Error(data.error || "Sign-in failed");
+          location.replace("/");
+        });
+      })
+      .catch(function (err) {
+        showError(err.message);
+        $submit.disabled = false;
+        $password.select();
+      });
+  });
+})();
@@ -0,0 +1,102 @@
+/* OpenDoc — unlocks pages published with build.private_mode: encrypt */
+
+(function () {
+    "use strict";
+
+    var STORAGE_KEY = "opendoc-passphrase";
+
+    var payloadEl = document.getElementById("protected-payload");
+    var form = document.getElementById("protected-form");
+    var input = document.getElementById("protected-passphrase");
+    var error = document.getElementById("protected-error");
+    if (!payloadEl || !form) return;
+
+    var payload = JSON.parse(payloadEl.textContent);
+
+    function bytes(b64) {
+        var bin = atob(b64);
+        var out = new Uint8Array(bin.length);
+        for (var i = 0; i < bin.length; i++) out[i] = bin.charCodeAt(i);
+        return out;
+    }
+
+    // PBKDF2-SHA256, then the HKDF "enc" subkey for AES-256-GCM,
+    // matching internal/core/encrypt.go.
+    function decrypt(passphrase) {
+        var subtle = window.crypto.subtle;
+        var encoder = new TextEncoder();
+        return subtle.importKey("raw", encoder.encode(passphrase), "PBKDF2", false, ["deriveBits"])
+            .then(function (base) {
+                return subtle.deriveBits(
+                    { name: "PBKDF2", hash: "SHA-256", salt: bytes(payload.salt), iterations: payload.iterations },
+                    base,
+                    256
+                );
+            })
+            .then(function (master) {
+                return subtle.importKey("raw", master, "HKDF", false, ["deriveKey"]);
+            })
+            .then(function (master) {
+                return subtle.deriveKey(
+                    { name: "HKDF", hash: "SHA-256", salt: new Uint8Array(0), info: encoder.encode("enc") },
+                    master,
+                    { name: "AES-GCM", length: 256 },
+                    false,
+                    ["decrypt"]
+                );
+            })
+            .then(function (key) {
+                return subtle.decrypt({ name: "AES-GCM", iv: bytes(payload.iv) }, key, bytes(payload.data));
+            })
+            .then(function (plain) {
+                return new TextDecoder().decode(plain);
+            });
+    }
+
+    // Replace the whole document with the decrypted page, so its own
+    // head, styles and scripts load as if it had been served directly.
+    function show(html) {
+        document.open();
+        document.write(html);
+        document.close();
+    }
+
+    function unlock(passphrase, remembered) {
+        form.querySelector("button").disabled = true;
+        return decrypt(passphrase)
+            .then(function (html) {
+                try { sessionStorage.setItem(STORAGE_KEY, passphrase); } catch (e) { /* storage disabled */ }
+                show(html);
+            })
+            .catch(function () {
+                form.querySelector("button").disabled = false;
+                if (remembered) {
+                    try { sessionStorage.removeItem(STORAGE_KEY); } catch (e) { /* storage disabled */ }
+                    return;
+                }
+                error.hidden = false;
+                input.select();
+            });
+    }
+
+    if (!window.crypto || !window.crypto.subtle) {
+        // Web Crypto is only available over HTTPS (or on localhost).
+        form.hidden = true;
+        return;
+    }
+
+    form.addEventListener("submit", function (e) {
+        e.preventDefault();
+        error.hidden = true;
+        unlock(input.value, false);
+    });
+
+    // Pages unlocked earlier in the session open without asking again.
+    var saved = null;
+    try { saved = sessionStorage.getItem(STORAGE_KEY); } catch (e) { /* storage disabled */ }
+    if (saved) {
+        unlock(saved, true);
+    } else {
+        input.focus();
+    }
+})();